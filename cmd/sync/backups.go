@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"nats-pocketbase-sync/internal/config"
+	"nats-pocketbase-sync/internal/filemanager"
+	"go.uber.org/zap"
+)
+
+// runListBackups prints the config file's backups with their fingerprints and sizes, newest first
+func runListBackups(cfg *config.Config, log *zap.Logger) error {
+	fileManager := newFileManager(cfg, cfg.NATS.ConfigFile, cfg.NATS.ConfigBackupDir, log)
+	backups, err := fileManager.ListBackups()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FINGERPRINT\tCREATED\tSIZE\tPATH")
+	for _, backup := range backups {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", backup.Fingerprint, backup.Created.Format(time.RFC3339), backup.Size, backup.Path)
+	}
+	return w.Flush()
+}
+
+// runRestoreBackup restores the config file from the backup chosen by restore and, unless
+// noReload is set, reloads NATS
+func runRestoreBackup(cfg *config.Config, restore func(*filemanager.FileManager) (filemanager.Backup, error), noReload bool, log *zap.Logger) error {
+	fileManager := newFileManager(cfg, cfg.NATS.ConfigFile, cfg.NATS.ConfigBackupDir, log)
+	if _, err := restore(fileManager); err != nil {
+		return err
+	}
+	if noReload {
+		log.Info("Backup restored, NATS not reloaded")
+		return nil
+	}
+
+	if err := newReloader(cfg, log).ReloadConfig(); err != nil {
+		return fmt.Errorf("failed to reload NATS: %w", err)
+	}
+	return nil
+}
+
+// verifyBackups checks the newest backups of each file and logs a summary
+func verifyBackups(fileManagers []*filemanager.FileManager, count int, log *zap.Logger) {
+	checked, failed := 0, 0
+	for _, fm := range fileManagers {
+		checks, err := fm.VerifyBackups(count)
+		if err != nil {
+			log.Warn("Failed to verify backups", zap.Error(err))
+			continue
+		}
+		for _, check := range checks {
+			checked++
+			if check.Err != nil {
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		log.Error("Backup verification found corrupt backups", zap.Int("checked", checked), zap.Int("failed", failed))
+		return
+	}
+	log.Info("Backup verification passed", zap.Int("checked", checked))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"nats-pocketbase-sync/internal/filemanager"
+	"go.uber.org/zap"
+)
+
+// clusterReloader reloads one cluster and holds back reloads outside its limits
+type clusterReloader interface {
+	ReloadConfig() error
+	Pending() bool
+	Stop()
+}
+
+// cluster is a destination with its own reload command. Each cluster is written and
+// reloaded independently, so one failing cluster does not hold back the others.
+type cluster struct {
+	name          string
+	fileManager   *filemanager.FileManager
+	reloader      clusterReloader
+	lastSuccess   time.Time // Last cycle the cluster was applied without error
+	failures      int       // Consecutive failed cycles
+	reloadPending bool      // The written config has not been reloaded yet
+}
+
+// apply writes the config to the cluster if it changed and reloads the cluster. A
+// failed reload is retried on the next cycle even if the config is unchanged by then.
+func (c *cluster) apply(content string) error {
+	changed, err := c.fileManager.HasConfigChanged(content)
+	if err != nil {
+		return fmt.Errorf("failed to check if config changed: %w", err)
+	}
+	if changed {
+		if err := c.fileManager.WriteConfigFile(content); err != nil {
+			// The check above saved the new hash, forget it so the next cycle writes again
+			c.fileManager.ForgetContentHash()
+			return fmt.Errorf("failed to write config: %w", err)
+		}
+		c.reloadPending = true
+	}
+	if !c.reloadPending {
+		return nil
+	}
+	if err := c.reloader.ReloadConfig(); err != nil {
+		return fmt.Errorf("failed to reload NATS: %w", err)
+	}
+	c.reloadPending = false
+	return nil
+}
+
+// applyClusters applies the config to every cluster, at most concurrency at a time,
+// and logs how many succeeded. Failures are logged per cluster and do not fail the cycle.
+func (s *syncer) applyClusters(content string) {
+	var wg sync.WaitGroup
+	results := make([]error, len(s.clusters))
+	slots := make(chan struct{}, max(s.clusterConcurrency, 1))
+	for i, c := range s.clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = c.apply(content)
+		}()
+	}
+	wg.Wait()
+
+	succeeded := 0
+	now := time.Now()
+	for i, c := range s.clusters {
+		if s.metrics != nil {
+			s.metrics.ObserveCluster(c.name, results[i])
+		}
+		if err := results[i]; err != nil {
+			c.failures++
+			fields := []zap.Field{
+				zap.String("cluster", c.name),
+				zap.Int("consecutive_failures", c.failures),
+				zap.Error(err),
+			}
+			if !c.lastSuccess.IsZero() {
+				fields = append(fields, zap.Time("last_success", c.lastSuccess))
+			}
+			s.log.Error("Failed to apply config to cluster", fields...)
+			continue
+		}
+		c.failures = 0
+		c.lastSuccess = now
+		succeeded++
+	}
+
+	fields := []zap.Field{zap.Int("succeeded", succeeded), zap.Int("total", len(s.clusters))}
+	if succeeded < len(s.clusters) {
+		s.log.Warn(fmt.Sprintf("Applied config to %d of %d clusters", succeeded, len(s.clusters)), fields...)
+		return
+	}
+	s.log.Debug("Applied config to all clusters", fields...)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/filemanager"
+	"nats-pocketbase-sync/internal/metrics"
+	"go.uber.org/zap"
+)
+
+func TestApplyClustersRetriesFailedWrite(t *testing.T) {
+	// The east cluster's directory is missing, so its first write fails after the change check
+	root := t.TempDir()
+	eastDir := filepath.Join(root, "east")
+	east := &cluster{
+		name:        "east",
+		fileManager: filemanager.NewFileManager(filepath.Join(eastDir, "nats.conf"), filepath.Join(root, "backups-east"), zap.NewNop()),
+		reloader:    &fakeReloader{},
+	}
+	west := &cluster{
+		name:        "west",
+		fileManager: filemanager.NewFileManager(filepath.Join(root, "west.conf"), filepath.Join(root, "backups-west"), zap.NewNop()),
+		reloader:    &fakeReloader{},
+	}
+	s := &syncer{clusters: []*cluster{east, west}, clusterConcurrency: 2, metrics: metrics.New(), log: zap.NewNop()}
+
+	const config = "port: 4222\n"
+	s.applyClusters(config)
+	health := s.metrics.Clusters()
+	if len(health) != 2 || health[0].Healthy || !health[1].Healthy {
+		t.Fatalf("cluster health after the failed write = %+v, want east unhealthy and west healthy", health)
+	}
+
+	if err := os.MkdirAll(eastDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	s.applyClusters(config)
+	if got := readTestFile(t, filepath.Join(eastDir, "nats.conf")); got != config {
+		t.Errorf("east config = %q, want the retried content", got)
+	}
+	if reloads := east.reloader.(*fakeReloader).reloads; reloads != 1 {
+		t.Errorf("east reloaded %d times, want 1", reloads)
+	}
+
+	health = s.metrics.Clusters()
+	if !health[0].Healthy || health[0].Applies != 2 || health[0].Failures != 1 {
+		t.Errorf("east health = %+v, want healthy after 2 applies with 1 failure", health[0])
+	}
+	var out strings.Builder
+	s.metrics.WriteTo(&out)
+	for _, line := range []string{
+		`nats_pocketbase_sync_cluster_failures_total{cluster="east"} 1`,
+		`nats_pocketbase_sync_cluster_healthy{cluster="east"} 1`,
+		`nats_pocketbase_sync_cluster_applies_total{cluster="west"} 2`,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("metrics lack %q:\n%s", line, out.String())
+		}
+	}
+}
+
+// readTestFile returns the content of path, failing the test if it cannot be read
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
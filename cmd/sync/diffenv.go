@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"nats-pocketbase-sync/internal/config"
+	"nats-pocketbase-sync/internal/envdiff"
+	"go.uber.org/zap"
+)
+
+// runDiffEnv fetches users and roles from the environments of two configurations
+// and prints how the second differs from the first, to outPath or stdout
+func runDiffEnv(ctx context.Context, cfg *config.Config, otherPath string, asJSON bool, outPath string, log *zap.Logger) error {
+	otherCfg, err := config.LoadConfig(otherPath, log)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", otherPath, err)
+	}
+
+	from, err := fetchSnapshot(ctx, cfg, log)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", cfg.PocketBase.URL, err)
+	}
+	to, err := fetchSnapshot(ctx, otherCfg, log)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", otherCfg.PocketBase.URL, err)
+	}
+
+	result := envdiff.Compare(from, to)
+	log.Info("Compared environments",
+		zap.String("from", cfg.PocketBase.URL),
+		zap.String("to", otherCfg.PocketBase.URL),
+		zap.Bool("identical", result.Empty()))
+
+	// Logs go to stdout, so a file keeps the result machine-readable
+	out := os.Stdout
+	if outPath != "" {
+		file, err := os.Create(outPath)
+		if err != nil {
+			return fmt.Errorf("failed to create diff output: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(result)
+	}
+	return result.Write(out)
+}
+
+// fetchSnapshot fetches all users and roles from the environment of a configuration
+func fetchSnapshot(ctx context.Context, cfg *config.Config, log *zap.Logger) (envdiff.Snapshot, error) {
+	pbClient, err := newPocketBaseClient(ctx, cfg, log)
+	if err != nil {
+		return envdiff.Snapshot{}, err
+	}
+
+	roles, err := pbClient.GetAllMqttRoles(ctx)
+	if err != nil {
+		return envdiff.Snapshot{}, fmt.Errorf("failed to get roles: %w", err)
+	}
+	users, err := pbClient.GetAllMqttUsers(ctx)
+	if err != nil {
+		return envdiff.Snapshot{}, fmt.Errorf("failed to get users: %w", err)
+	}
+	return envdiff.Snapshot{Roles: roles, Users: users}, nil
+}
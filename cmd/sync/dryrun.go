@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// runDryRun prints the diff a sync would apply to stdout, or to outPath if set
+func runDryRun(ctx context.Context, s *syncer, outPath string) error {
+	// Logs go to stdout, so a file keeps the diff usable as a patch
+	var out io.Writer = os.Stdout
+	if outPath != "" {
+		file, err := os.Create(outPath)
+		if err != nil {
+			return fmt.Errorf("failed to create dry run output: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	return s.dryRun(ctx, out)
+}
+
+// dryRun generates the config and writes a unified diff from the current config file
+// to w. Nothing is written and NATS is not reloaded; the freeze file and version record
+// are ignored so the diff always reflects the current PocketBase data.
+func (s *syncer) dryRun(ctx context.Context, w io.Writer) error {
+	if _, err := s.resolveDatedPaths(time.Now()); err != nil {
+		return err
+	}
+
+	generated, err := s.generate(ctx)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.fileManager.Diff(generated.config)
+	if err != nil {
+		return fmt.Errorf("failed to diff config: %w", err)
+	}
+	if _, err := io.WriteString(w, result.Diff); err != nil {
+		return err
+	}
+
+	s.log.Info("Dry run completed, nothing written",
+		zap.String("config_file", s.fileManager.ConfigFile()),
+		zap.Int("added_lines", result.Added),
+		zap.Int("removed_lines", result.Removed))
+	return nil
+}
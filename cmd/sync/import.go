@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"nats-pocketbase-sync/internal/config"
+	"nats-pocketbase-sync/internal/generator"
+	"nats-pocketbase-sync/internal/pocketbase"
+	"go.uber.org/zap"
+)
+
+// importSystemFields are set by PocketBase and dropped before creating records
+var importSystemFields = []string{"collectionId", "collectionName", "created", "updated", "expand"}
+
+// createdRecord is a record created by the current import run
+type createdRecord struct {
+	collection string
+	id         string
+}
+
+// runImport creates the roles and users in dir (roles.json and users.json, in the fixture
+// format) in PocketBase. With atomic set, records created by this run are deleted again
+// when a later create fails, so a failed import can be retried from a clean state.
+func runImport(ctx context.Context, cfg *config.Config, dir string, atomic bool, log *zap.Logger) error {
+	if cfg.PocketBase.RoleCollection == "" || cfg.PocketBase.UserCollection == "" {
+		return fmt.Errorf("pocketbase.role_collection and pocketbase.user_collection are required to import")
+	}
+
+	roles, err := generator.LoadRawRecordsFile(filepath.Join(dir, generator.FixtureRolesFile))
+	if err != nil {
+		return fmt.Errorf("failed to load roles: %w", err)
+	}
+	users, err := generator.LoadRawRecordsFile(filepath.Join(dir, generator.FixtureUsersFile))
+	if err != nil {
+		return fmt.Errorf("failed to load users: %w", err)
+	}
+
+	pbClient, err := newPocketBaseClient(ctx, cfg, log)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with PocketBase: %w", err)
+	}
+
+	// Roles first, so users can reference them
+	batches := []struct {
+		collection string
+		records    []map[string]interface{}
+	}{
+		{cfg.PocketBase.RoleCollection, roles},
+		{cfg.PocketBase.UserCollection, users},
+	}
+
+	var created []createdRecord
+	for _, batch := range batches {
+		for i, record := range batch.records {
+			for _, field := range importSystemFields {
+				delete(record, field)
+			}
+
+			id, err := pbClient.CreateRecord(ctx, batch.collection, record)
+			if err != nil {
+				err = fmt.Errorf("failed to create record %d in %s: %w", i+1, batch.collection, err)
+				if !atomic {
+					log.Error("Import stopped, records created so far are kept", zap.Int("created", len(created)))
+					return err
+				}
+				// Clean up even when the import failed because it was interrupted
+				return rollbackImport(context.WithoutCancel(ctx), pbClient, created, err, log)
+			}
+			created = append(created, createdRecord{collection: batch.collection, id: id})
+			log.Debug("Created record", zap.String("collection", batch.collection), zap.String("id", id))
+		}
+	}
+
+	log.Info("Import completed", zap.Int("roles", len(roles)), zap.Int("users", len(users)))
+	return nil
+}
+
+// rollbackImport deletes the records created by a failed import, newest first
+func rollbackImport(ctx context.Context, pbClient *pocketbase.Client, created []createdRecord, cause error, log *zap.Logger) error {
+	log.Warn("Import failed, deleting the records it created", zap.Int("created", len(created)), zap.Error(cause))
+
+	failed := 0
+	for i := len(created) - 1; i >= 0; i-- {
+		record := created[i]
+		if err := pbClient.DeleteRecord(ctx, record.collection, record.id); err != nil {
+			failed++
+			log.Error("Failed to delete imported record",
+				zap.String("collection", record.collection),
+				zap.String("id", record.id),
+				zap.Error(err))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w; rollback left %d of %d records behind", cause, failed, len(created))
+	}
+	log.Info("Rolled back import", zap.Int("deleted", len(created)))
+	return fmt.Errorf("%w; rolled back %d records", cause, len(created))
+}
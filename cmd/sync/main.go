@@ -1,26 +1,91 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"nats-pocketbase-sync/internal/config"
+	"nats-pocketbase-sync/internal/creds"
+	"nats-pocketbase-sync/internal/drift"
+	"nats-pocketbase-sync/internal/fieldcrypt"
 	"nats-pocketbase-sync/internal/filemanager"
 	"nats-pocketbase-sync/internal/generator"
+	"nats-pocketbase-sync/internal/kv"
+	"nats-pocketbase-sync/internal/metrics"
+	"nats-pocketbase-sync/internal/models"
 	"nats-pocketbase-sync/internal/nats"
 	"nats-pocketbase-sync/internal/pocketbase"
+	"nats-pocketbase-sync/internal/resolver"
+	"nats-pocketbase-sync/internal/secrets"
 	"nats-pocketbase-sync/pkg/logger"
 	"go.uber.org/zap"
 )
 
+// exitCodeStale is the exit code used when no sync has succeeded within app.max_stale_duration
+const exitCodeStale = 3
+
+
 func main() {
 	// Define command-line flags
-	configPath := flag.String("config", "", "Path to the configuration file")
+	var configPaths configPathList
+	flag.Var(&configPaths, "config", "Configuration directory, or config files merged left to right (comma-separated or repeated)")
+	diffEnvPath := flag.String("diff-env", "", "Compare users and roles with the PocketBase environment of this configuration, then exit")
+	diffJSON := flag.Bool("diff-json", false, "Print the -diff-env result as JSON")
+	diffOut := flag.String("diff-out", "", "Write the -diff-env result to this file instead of stdout")
+	listBackups := flag.Bool("list-backups", false, "List config backups with their fingerprints, then exit")
+	restoreFingerprint := flag.String("restore-fingerprint", "", "Restore the newest backup with this fingerprint (or prefix), reload NATS, then exit")
+	restoreFile := flag.String("restore-backup", "", "Restore the backup with this file name, as printed by -list-backups, reload NATS, then exit")
+	noReload := flag.Bool("no-reload", false, "Restore with -restore-fingerprint or -restore-backup without reloading NATS")
+	genConfig := flag.Bool("gen-config", false, "Print a sample config.yaml documenting every option with its default, then exit")
+	genConfigOut := flag.String("gen-config-out", "", "Write the -gen-config sample to this file instead of stdout")
+	importDir := flag.String("import", "", "Create the roles and users in this directory (roles.json, users.json) in PocketBase, then exit")
+	importAtomic := flag.Bool("import-atomic", false, "Delete the records created by -import if any create fails")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration and where each value came from, then exit")
+	tailLog := flag.String("tail", "", "Follow this JSON log file and print it in a readable, colorized form")
+	once := flag.Bool("once", false, "Run a single sync cycle and exit, with status 1 if it failed")
+	dryRun := flag.Bool("dry-run", false, "Print a diff of the config a sync would write, without writing or reloading, then exit")
+	dryRunOut := flag.String("dry-run-out", "", "Write the -dry-run diff to this file instead of stdout")
 	flag.Parse()
+	configPath := configPaths.String()
+
+	// Print the sample config before anything is logged to stdout
+	if *genConfig {
+		if err := writeSampleConfig(*genConfigOut); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write sample config:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *printConfig {
+		cfg, err := config.LoadConfig(configPath, zap.NewNop())
+		if err == nil {
+			err = cfg.WriteSettings(os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to print config:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *tailLog != "" {
+		if err := runTail(*tailLog, os.Stdout, colorOutput()); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to tail log:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Cancelled on SIGINT or SIGTERM, which aborts in-flight PocketBase requests
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
 	// Initialize the logger with console output only for now
 	logger.Init(logger.LogConfig{
@@ -33,7 +98,7 @@ func main() {
 	log.Info("Starting NATS PocketBase sync service")
 
 	// Load configuration
-	cfg, err := config.LoadConfig(*configPath, log)
+	cfg, err := config.LoadConfig(configPath, log)
 	if err != nil {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
@@ -45,138 +110,684 @@ func main() {
 	})
 	log = logger.GetLogger()
 	
+	// Compare two environments instead of syncing
+	if *diffEnvPath != "" {
+		if err := runDiffEnv(ctx, cfg, *diffEnvPath, *diffJSON, *diffOut, log); err != nil {
+			logger.Fatal("Failed to compare environments", zap.Error(err))
+		}
+		return
+	}
+
+	// Seed PocketBase instead of syncing
+	if *importDir != "" {
+		if err := runImport(ctx, cfg, *importDir, *importAtomic, log); err != nil {
+			logger.Fatal("Failed to import records", zap.Error(err))
+		}
+		return
+	}
+
+	// Inspect or restore backups instead of syncing
+	if *listBackups {
+		if err := runListBackups(cfg, log); err != nil {
+			logger.Fatal("Failed to list backups", zap.Error(err))
+		}
+		return
+	}
+	if *restoreFingerprint != "" {
+		if err := runRestoreBackup(cfg, func(fm *filemanager.FileManager) (filemanager.Backup, error) {
+			return fm.RestoreBackup(*restoreFingerprint)
+		}, *noReload, log); err != nil {
+			logger.Fatal("Failed to restore backup", zap.Error(err))
+		}
+		return
+	}
+	if *restoreFile != "" {
+		if err := runRestoreBackup(cfg, func(fm *filemanager.FileManager) (filemanager.Backup, error) {
+			return fm.RestoreBackupFile(*restoreFile)
+		}, *noReload, log); err != nil {
+			logger.Fatal("Failed to restore backup", zap.Error(err))
+		}
+		return
+	}
+
 	log.Info("Configuration loaded",
 		zap.String("pb_url", cfg.PocketBase.URL),
 		zap.String("nats_config", cfg.NATS.ConfigFile),
 		zap.Int("sync_interval", cfg.App.SyncInterval))
 
-	// Create PocketBase client
-	pbClient := pocketbase.NewClient(
-		cfg.PocketBase.URL,
-		cfg.PocketBase.UserCollection,
-		cfg.PocketBase.RoleCollection,
-		log.With(zap.String("component", "pocketbase")),
-	)
+	// Create and authenticate the PocketBase client
+	pbClient, err := newPocketBaseClient(ctx, cfg, log)
+	if err != nil {
+		logger.Fatal("Failed to authenticate with PocketBase", zap.Error(err))
+	}
 
-	// Set log level to debug temporarily for authentication troubleshooting
-	log.With(zap.String("component", "pocketbase")).Debug(
-		"Authenticating with PocketBase",
-		zap.String("url", cfg.PocketBase.URL),
-		zap.String("identity", cfg.PocketBase.AdminEmail),
-	)
+	// Tell a permission problem apart from empty collections before anything is written
+	if cfg.PocketBase.AccessCheck != "off" {
+		if err := pbClient.CheckAccess(ctx); err != nil {
+			if cfg.PocketBase.AccessCheck == "fail" {
+				logger.Fatal("PocketBase access check failed", zap.Error(err))
+			}
+			log.Warn("PocketBase access check failed", zap.Error(err))
+		}
+	}
 
-	// Authenticate with PocketBase
-	if err := pbClient.Authenticate(cfg.PocketBase.AdminEmail, cfg.PocketBase.AdminPassword); err != nil {
-		logger.Fatal("Failed to authenticate with PocketBase", zap.Error(err))
+	// Fail fast when the collections do not have the fields we decode
+	if cfg.PocketBase.ValidateSchema {
+		if err := pbClient.ValidateSchema(ctx); err != nil {
+			logger.Fatal("PocketBase schema validation failed", zap.Error(err))
+		}
 	}
 
-	// Create file manager
-	fileManager := filemanager.NewFileManager(
-		cfg.NATS.ConfigFile,
-		cfg.NATS.ConfigBackupDir,
-		log.With(zap.String("component", "filemanager")),
-	)
+	// Dated paths may point into a directory that does not exist yet
+	for i, tmpl := range cfg.DatedPaths() {
+		if tmpl == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(cfg.ConfigFiles()[i]), 0755); err != nil {
+			logger.Fatal("Failed to create config file directory", zap.Error(err))
+		}
+	}
+
+	// Create file managers for the primary config file and any extra destinations
+	fileManager := newFileManager(cfg, cfg.NATS.ConfigFile, cfg.NATS.ConfigBackupDir, log)
+	fileManagers := []*filemanager.FileManager{fileManager}
+	for _, dest := range cfg.NATS.Destinations {
+		fileManagers = append(fileManagers, newFileManager(cfg, dest.ConfigFile, dest.ConfigBackupDir, log))
+	}
+
+	// Destinations with their own reload command are applied as separate clusters,
+	// the rest share the primary reload command
+	sharedManagers := []*filemanager.FileManager{fileManager}
+	for i, dest := range cfg.NATS.Destinations {
+		if dest.ReloadCommand == "" {
+			sharedManagers = append(sharedManagers, fileManagers[i+1])
+		}
+	}
 
 	// Create config generator
-	generator := generator.NewGenerator(
+	configGenerator := generator.NewGenerator(
 		cfg.NATS.DefaultPermissions.Publish,
 		cfg.NATS.DefaultPermissions.Subscribe,
 		log.With(zap.String("component", "generator")),
 	)
 
-	// Create NATS reloader
-	reloader := nats.NewReloader(
-		cfg.NATS.ReloadCommand,
-		log.With(zap.String("component", "reloader")),
-	)
+	// Apply manual user overrides from configuration
+	forceInclude := make([]models.MqttUser, 0, len(cfg.App.ForceIncludeUsers))
+	for _, u := range cfg.App.ForceIncludeUsers {
+		forceInclude = append(forceInclude, models.MqttUser{
+			Username: u.Username,
+			Password: u.Password,
+			RoleID:   u.Role,
+			Active:   true,
+		})
+	}
+	configGenerator.SetUserOverrides(forceInclude, cfg.App.ExcludeUsers)
+	configGenerator.SetLogSummary(cfg.App.LogSummary)
+	configGenerator.SetEmptyCredentialAction(cfg.App.OnEmptyPassword)
+	configGenerator.SetExpiry(cfg.App.SkipExpiredUsers, cfg.App.ExpiryWarning)
+	configGenerator.SetOutputMode(cfg.NATS.OutputMode)
+	configGenerator.SetAnnotateRoles(cfg.NATS.AnnotateRoles)
+	configGenerator.SetSystemAccount(cfg.NATS.SystemAccount)
+	configGenerator.SetWrapAccount(cfg.NATS.WrapInAccount)
+	configGenerator.SetAuthToken(cfg.NATS.TokenAuth.Token)
+	configGenerator.SetSubjectPrefix(cfg.NATS.SubjectPrefix, cfg.NATS.SubjectPrefixMode)
+	configGenerator.SetDuplicateUsernamePolicy(cfg.NATS.DuplicateUsernamePolicy)
+	configGenerator.SetInvalidSubjectPolicy(cfg.NATS.InvalidSubjectPolicy)
+	configGenerator.SetAccountOrdering(cfg.NATS.AccountOrder, cfg.NATS.GroupAccounts)
+	if err := configGenerator.SetTargetVersion(cfg.NATS.TargetVersion); err != nil {
+		logger.Fatal("Invalid NATS target version", zap.Error(err))
+	}
+	configGenerator.SetUsernameAffixes(cfg.NATS.UsernamePrefix, cfg.NATS.UsernameSuffix)
+	if cfg.NATS.SchemaMarker {
+		configGenerator.SetSchemaVersion(cfg.NATS.SchemaVersion)
+	}
+	if cfg.NATS.Leafnodes.Enabled {
+		configGenerator.SetLeafnodes(cfg.NATS.Leafnodes.Port)
+	}
+	if len(cfg.NATS.Mappings) > 0 {
+		mappings := make(map[string][]models.SubjectMapping)
+		for _, m := range cfg.NATS.Mappings {
+			mappings[m.Account] = append(mappings[m.Account], models.SubjectMapping{
+				From:   m.From,
+				To:     m.To,
+				Weight: m.Weight,
+			})
+		}
+		configGenerator.SetMappings(mappings)
+	}
+	configGenerator.SetPermissionPolicy(generator.PermissionPolicy{
+		ForbiddenPatterns: cfg.NATS.ForbiddenPatterns,
+		AllowedRoles:      cfg.NATS.ForbiddenAllowlist,
+		Action:            cfg.NATS.ForbiddenAction,
+	})
+
+	// Static read-only user for the system account
+	if mu := cfg.NATS.MonitoringUser; mu.Username != "" {
+		configGenerator.SetMonitoringUser(generator.MonitoringUser{
+			Account:   mu.Account,
+			Username:  mu.Username,
+			Password:  mu.Password,
+			Subscribe: mu.Subscribe,
+		})
+	}
+
+	// Decrypt encrypted password fields when a field key is configured
+	if cfg.PocketBase.FieldKey != "" {
+		key, err := fieldcrypt.ParseKey(cfg.PocketBase.FieldKey)
+		if err != nil {
+			logger.Fatal("Invalid PocketBase field key", zap.Error(err))
+		}
+		passwordCipher, err := fieldcrypt.NewCipher(key)
+		if err != nil {
+			logger.Fatal("Failed to create field cipher", zap.Error(err))
+		}
+		configGenerator.SetPasswordCipher(passwordCipher)
+	}
+	if cfg.NATS.HashPasswords {
+		configGenerator.SetHashPasswords(true, cfg.NATS.PasswordHashCost)
 
-	// Set up signal handling for graceful shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		// Reuse the hashes already on disk so a restart does not rewrite every user
+		hashes, err := drift.Passwords(cfg.NATS.ConfigFile)
+		if err != nil {
+			log.Warn("Failed to read password hashes from the current config, all passwords will be rehashed", zap.Error(err))
+		} else {
+			configGenerator.SeedPasswordHashes(hashes)
+		}
+	}
+
+	// Create NATS reloader
+	reloader := newReloader(cfg, log)
+	if len(cfg.App.ReloadWindows) > 0 {
+		windows, loc, err := reloadWindows(cfg)
+		if err != nil {
+			logger.Fatal("Invalid reload windows", zap.Error(err))
+		}
+		reloader.SetReloadWindows(windows, loc)
+	}
 
 	// Create a ticker for periodic syncing
 	ticker := time.NewTicker(time.Duration(cfg.App.SyncInterval) * time.Second)
 	defer ticker.Stop()
 
+	// Create the syncer that runs each cycle
+	syncer := &syncer{
+		pbClient:    pbClient,
+		generator:   configGenerator,
+		fileManager: fileManager,
+		writer: filemanager.NewMultiWriter(
+			sharedManagers,
+			cfg.NATS.WriteConcurrency,
+			cfg.NATS.WriteFailurePolicy,
+			log.With(zap.String("component", "writer")),
+		),
+		writePolicy: cfg.NATS.WriteFailurePolicy,
+		reloader:    reloader,
+		log:         log,
+		freezeFile:  cfg.App.FreezeFile,
+		doubleCheck: cfg.App.DoubleCheckGenerate,
+	}
+	for i, tmpl := range cfg.DatedPaths() {
+		if tmpl != nil {
+			syncer.datedPaths = append(syncer.datedPaths, datedPath{fileManager: fileManagers[i], template: tmpl})
+		}
+	}
+	for i, dest := range cfg.NATS.Destinations {
+		if dest.ReloadCommand == "" {
+			continue
+		}
+		clusterReloader := nats.NewReloader(dest.ReloadCommand,
+			log.With(zap.String("component", "reloader"), zap.String("cluster", dest.Name)))
+		clusterReloader.SetSkipMode(cfg.NATS.ReloadSkipMode)
+		clusterReloader.SetMaxReloadsPerHour(cfg.NATS.MaxReloadsPerHour)
+		if len(cfg.App.ReloadWindows) > 0 {
+			windows, loc, err := reloadWindows(cfg)
+			if err != nil {
+				logger.Fatal("Invalid reload windows", zap.Error(err))
+			}
+			clusterReloader.SetReloadWindows(windows, loc)
+		}
+		syncer.clusters = append(syncer.clusters, &cluster{
+			name:        dest.Name,
+			fileManager: fileManagers[i+1],
+			reloader:    clusterReloader,
+		})
+	}
+	syncer.clusterConcurrency = cfg.NATS.WriteConcurrency
+	if cfg.NATS.SchemaMarker {
+		syncer.schemaVersion = cfg.NATS.SchemaVersion
+	}
+	if cfg.NATS.PostGenerateCommand != "" {
+		syncer.postProcessor = nats.NewPostProcessor(
+			cfg.NATS.PostGenerateCommand,
+			cfg.NATS.PostGenerateTimeout,
+			log.With(zap.String("component", "post_generate")),
+		)
+	}
+	if cfg.App.StrictApply {
+		syncer.validator = nats.NewValidator(cfg.NATS.ValidateCommand, filepath.Dir(cfg.NATS.ConfigFile))
+	}
+	if cfg.NATS.PostReloadConnectCheck.Enabled && cfg.NATS.MonitorURL == "" {
+		// Signal reloads are asynchronous, so the check may run against the old config
+		log.Warn("Connect check enabled without nats.monitor_url, the check may run before NATS applies the reload")
+	}
+	if cc := cfg.NATS.PostReloadConnectCheck; cc.Enabled && cc.Rollback {
+		// Only the primary config file can be restored on its own
+		if len(cfg.NATS.Destinations) > 0 || cfg.NATS.SplitByAccount || cfg.NATS.SplitSecrets {
+			log.Warn("Connect check rollback is not supported with destinations, split_by_account or split_secrets, disabling rollback")
+		} else {
+			syncer.rollback = true
+		}
+	}
+	if cfg.NATS.RestoreOnReloadFailure {
+		// The last backup only covers the primary config file
+		if len(cfg.NATS.Destinations) > 0 || cfg.NATS.SplitByAccount || cfg.NATS.SplitSecrets {
+			log.Debug("Restoring on reload failure is not supported with destinations, split_by_account or split_secrets")
+		} else {
+			syncer.restoreOnReloadFailure = true
+		}
+	}
+	if cfg.NATS.SplitByAccount {
+		syncer.includeDir = "accounts"
+		syncer.splitWriter = filemanager.NewSplitWriter(
+			filepath.Join(filepath.Dir(cfg.NATS.ConfigFile), syncer.includeDir),
+			filepath.Join(cfg.NATS.ConfigBackupDir, "accounts"),
+			func(fm *filemanager.FileManager) {
+				fm.SetLineEnding(cfg.NATS.LineEnding)
+				fm.SetCollapseWhitespace(cfg.NATS.CollapseWhitespace)
+				fm.SetFollowSymlink(cfg.NATS.FollowSymlink)
+				fm.SetBackupRequired(cfg.NATS.BackupRequired)
+				fm.SetCompressBackups(cfg.NATS.CompressBackups)
+			},
+			log.With(zap.String("component", "splitwriter")),
+		)
+	}
+	if cfg.NATS.SplitSecrets {
+		secretsFile := filepath.Join(filepath.Dir(cfg.NATS.ConfigFile), cfg.NATS.SecretsFile)
+		syncer.secretsManager = filemanager.NewFileManager(
+			secretsFile,
+			filepath.Join(cfg.NATS.ConfigBackupDir, "secrets"),
+			log.With(zap.String("component", "filemanager"), zap.String("config_file", secretsFile)),
+		)
+		syncer.secretsManager.SetLineEnding(cfg.NATS.LineEnding)
+		syncer.secretsManager.SetCollapseWhitespace(cfg.NATS.CollapseWhitespace)
+		syncer.secretsManager.SetFileMode(0600)
+		syncer.secretsManager.SetBackupRequired(cfg.NATS.BackupRequired)
+		syncer.secretsManager.SetCompressBackups(cfg.NATS.CompressBackups)
+		configGenerator.SetSecretsInclude(cfg.NATS.SecretsFile)
+	}
+	if cfg.NATS.WriteCreds {
+		syncer.credsWriter = creds.NewWriter(cfg.NATS.CredsDir, cfg.NATS.CredsURL, log.With(zap.String("component", "creds")))
+		configGenerator.AddTransform(syncer.credsWriter.Capture)
+	}
+	if cfg.PocketBase.VersionRecord.Collection != "" {
+		syncer.versionRecord = &pocketbase.RecordRef{
+			Collection: cfg.PocketBase.VersionRecord.Collection,
+			ID:         cfg.PocketBase.VersionRecord.ID,
+			Field:      cfg.PocketBase.VersionRecord.Field,
+		}
+	}
+
+	// Store the config in Consul instead of a file; consul-template renders and reloads it
+	if cfg.NATS.OutputTarget == "consul" {
+		syncer.writer = kv.NewConsulWriter(kv.ConsulConfig{
+			Address:    cfg.NATS.Consul.Address,
+			Key:        cfg.NATS.Consul.Key,
+			Token:      cfg.NATS.Consul.Token,
+			Datacenter: cfg.NATS.Consul.Datacenter,
+		}, log.With(zap.String("component", "consul")))
+		syncer.reloader = nil
+	}
+
+	// Push account JWTs to a resolver instead of writing a config file
+	if cfg.NATS.OutputTarget == "resolver" {
+		operatorKey, err := secrets.ReadFile(cfg.NATS.Resolver.OperatorSigningKeyFile)
+		if err != nil {
+			logger.Fatal("Failed to read operator signing key", zap.Error(err))
+		}
+		accountSeed, err := secrets.ReadFile(cfg.NATS.Resolver.AccountSeedFile)
+		if err != nil {
+			logger.Fatal("Failed to read account seed", zap.Error(err))
+		}
+		var signingKeys []resolver.SigningKey
+		for _, k := range cfg.NATS.Resolver.SigningKeys {
+			signingKeys = append(signingKeys, resolver.SigningKey{Key: k.Key, Role: k.Role, Description: k.Description})
+		}
+		publisher, err := resolver.NewPublisher(resolver.Config{
+			URL:                cfg.NATS.Resolver.URL,
+			OperatorSigningKey: operatorKey,
+			AccountSeed:        accountSeed,
+			AccountName:        cfg.NATS.Resolver.AccountName,
+			SigningKeys:        signingKeys,
+			UserJWTDir:         cfg.NATS.Resolver.UserJWTDir,
+		}, log.With(zap.String("component", "resolver")))
+		if err != nil {
+			logger.Fatal("Failed to create resolver publisher", zap.Error(err))
+		}
+		syncer.publisher = publisher
+		configGenerator.AddTransform(publisher.Capture)
+		syncer.defaultPublish = models.PermissionList(cfg.NATS.DefaultPermissions.Publish)
+		syncer.defaultSubscribe = models.PermissionList(cfg.NATS.DefaultPermissions.Subscribe)
+	}
+
+	// Show what a sync would change instead of applying it
+	if *dryRun {
+		if cfg.NATS.OutputTarget != "file" {
+			logger.Fatal("-dry-run requires nats.output_target file")
+		}
+		if err := runDryRun(ctx, syncer, *dryRunOut); err != nil {
+			logger.Fatal("Dry run failed", zap.Error(err))
+		}
+		return
+	}
+
+	// Export sync health for Prometheus; a single cycle is not worth scraping
+	runOnce := *once || cfg.App.RunOnce
+	if cfg.App.MetricsAddr != "" && !runOnce {
+		syncer.metrics = metrics.New()
+		metricsServer := metrics.NewServer(cfg.App.MetricsAddr, log.With(zap.String("component", "metrics")))
+		metricsServer.Handle("/metrics", syncer.metrics)
+		if len(syncer.clusters) > 0 {
+			metricsServer.Handle("/clusters", syncer.metrics.ClusterHealthHandler())
+		}
+		if cfg.App.HistorySize > 0 {
+			syncer.history = metrics.NewHistory(cfg.App.HistorySize)
+			metricsServer.Handle("/history", syncer.history)
+		}
+		if err := metricsServer.Start(); err != nil {
+			logger.Fatal("Failed to start metrics server", zap.Error(err))
+		}
+		defer metricsServer.Shutdown()
+	}
+
+	// Give dependencies time to start before the first sync
+	if cfg.App.InitialDelay > 0 {
+		log.Info("Delaying initial sync", zap.Duration("initial_delay", cfg.App.InitialDelay))
+		select {
+		case <-time.After(cfg.App.InitialDelay):
+		case <-ctx.Done():
+			log.Info("Shutting down gracefully")
+			return
+		}
+	}
+
+	// Report what the first sync is about to change
+	if cfg.App.StartupReconcile {
+		if err := syncer.reconcile(ctx, cfg.NATS.ConfigFile); err != nil {
+			log.Error("Startup reconciliation failed", zap.Error(err))
+		}
+	}
+
 	// Run the initial sync
-	if err := runSync(pbClient, generator, fileManager, reloader, log); err != nil {
-		log.Error("Initial sync failed", zap.Error(err))
+	lastSuccess := time.Now()
+	syncErr := syncer.runSync(ctx)
+	if syncErr != nil {
+		if ctx.Err() != nil {
+			log.Info("Initial sync aborted for shutdown", zap.Error(syncErr))
+		} else {
+			log.Error("Initial sync failed", zap.Error(syncErr))
+		}
+	} else {
+		lastSuccess = time.Now()
+	}
+
+	// Cron and CI runs report the single cycle through the exit code
+	if runOnce {
+		cleanupBackups(backupManagers(fileManagers, syncer), cfg, log)
+
+		// A deferred reload would never run once the process exits
+		reloadPending := reloader.Pending()
+		reloader.Stop()
+		for _, c := range syncer.clusters {
+			if c.reloader.Pending() {
+				reloadPending = true
+			}
+			c.reloader.Stop()
+		}
+		// A held back reload can't run after exit, so the cycle counts as failed
+		if syncErr != nil || reloadPending {
+			if reloadPending {
+				log.Error("Config was written but NATS was not reloaded, exiting")
+			}
+			logger.Sync()
+			os.Exit(1)
+		}
+		log.Info("Sync cycle completed, exiting")
+		return
+	}
+
+	// Periodically check that backups are usable before a rollback needs them
+	var verifyTick <-chan time.Time
+	if cfg.NATS.VerifyBackupsInterval > 0 {
+		verifyTicker := time.NewTicker(cfg.NATS.VerifyBackupsInterval)
+		defer verifyTicker.Stop()
+		verifyTick = verifyTicker.C
 	}
 
 	// Main loop
 	log.Info("Entering main loop", zap.Int("sync_interval", cfg.App.SyncInterval))
 	for {
 		select {
+		case <-verifyTick:
+			verifyBackups(backupManagers(fileManagers, syncer), cfg.NATS.VerifyBackupsCount, log)
+
 		case <-ticker.C:
 			// Run sync
-			if err := runSync(pbClient, generator, fileManager, reloader, log); err != nil {
+			if err := syncer.runSync(ctx); err != nil {
+				if ctx.Err() != nil {
+					// Interrupted by shutdown, which the next select picks up
+					log.Info("Sync aborted for shutdown", zap.Error(err))
+					continue
+				}
 				log.Error("Sync failed", zap.Error(err))
+			} else {
+				lastSuccess = time.Now()
 			}
 
-			// Cleanup old backups (keep backups for 30 days)
-			if err := fileManager.CleanupOldBackups(30 * 24 * time.Hour); err != nil {
-				log.Warn("Failed to clean up old backups", zap.Error(err))
+			// Exit so the orchestrator can restart or fail over a stuck instance
+			if cfg.App.MaxStaleDuration > 0 && time.Since(lastSuccess) > cfg.App.MaxStaleDuration {
+				log.Error("No successful sync within max stale duration, exiting",
+					zap.Duration("max_stale_duration", cfg.App.MaxStaleDuration),
+					zap.Time("last_success", lastSuccess),
+					zap.Int("exit_code", exitCodeStale))
+				logger.Sync()
+				os.Exit(exitCodeStale)
 			}
 
-		case <-stop:
+			cleanupBackups(backupManagers(fileManagers, syncer), cfg, log)
+
+		case <-ctx.Done():
 			log.Info("Shutting down gracefully")
+			reloader.Stop()
+			for _, c := range syncer.clusters {
+				c.reloader.Stop()
+			}
 			return
 		}
 	}
 }
 
-// runSync performs a single synchronization cycle
-func runSync(
-	pbClient *pocketbase.Client,
-	generator *generator.Generator,
-	fileManager *filemanager.FileManager,
-	reloader *nats.Reloader,
-	log *zap.Logger,
-) error {
-	log.Info("Starting sync cycle")
-
-	// Get roles from PocketBase
-	roles, err := pbClient.GetAllMqttRoles()
-	if err != nil {
-		return fmt.Errorf("failed to get roles: %w", err)
+// cleanupBackups applies the configured backup retention: backups older than
+// backup_max_age, beyond backup_retention_count and, if enabled, duplicates are removed
+func cleanupBackups(fileManagers []*filemanager.FileManager, cfg *config.Config, log *zap.Logger) {
+	for _, fm := range fileManagers {
+		if cfg.NATS.BackupMaxAge > 0 {
+			if err := fm.CleanupOldBackups(cfg.NATS.BackupMaxAge); err != nil {
+				log.Warn("Failed to clean up old backups", zap.Error(err))
+			}
+		}
+		if err := fm.CleanupBackupsKeepingLast(cfg.NATS.BackupRetentionCount); err != nil {
+			log.Warn("Failed to clean up backups beyond the retention count", zap.Error(err))
+		}
+		if cfg.NATS.DedupeBackups {
+			if err := fm.DedupeBackups(); err != nil {
+				log.Warn("Failed to remove duplicate backups", zap.Error(err))
+			}
+		}
 	}
+}
 
-	// Get users from PocketBase
-	users, err := pbClient.GetAllMqttUsers()
-	if err != nil {
-		return fmt.Errorf("failed to get users: %w", err)
+// backupManagers returns the file managers whose files are backed up
+func backupManagers(fileManagers []*filemanager.FileManager, s *syncer) []*filemanager.FileManager {
+	if s.secretsManager == nil {
+		return fileManagers
 	}
+	return append(fileManagers[:len(fileManagers):len(fileManagers)], s.secretsManager)
+}
 
-	// Generate NATS configuration
-	config, err := generator.GenerateConfig(roles, users)
-	if err != nil {
-		return fmt.Errorf("failed to generate config: %w", err)
+// newPocketBaseClient creates a PocketBase client from the configuration and authenticates it
+func newPocketBaseClient(ctx context.Context, cfg *config.Config, log *zap.Logger) (*pocketbase.Client, error) {
+	pbClient := pocketbase.NewClient(
+		cfg.PocketBase.URL,
+		cfg.PocketBase.UserCollection,
+		cfg.PocketBase.RoleCollection,
+		log.With(zap.String("component", "pocketbase")),
+	)
+
+	if cfg.PocketBase.ReadURL != "" {
+		pbClient.SetReadURL(cfg.PocketBase.ReadURL)
+	}
+	pbClient.SetLimits(cfg.PocketBase.MaxUsers, cfg.PocketBase.MaxRoles, cfg.PocketBase.LimitAction)
+	pbClient.SetPageSize(cfg.PocketBase.PageSize)
+	pbClient.SetTimeout(cfg.PocketBase.HTTPTimeout)
+	pbClient.SetAuthCollection(cfg.PocketBase.AuthCollection)
+	pbClient.SetTransportOptions(pocketbase.TransportOptions{
+		MaxIdleConns:        cfg.PocketBase.HTTP.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.PocketBase.HTTP.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.PocketBase.HTTP.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.PocketBase.HTTP.IdleConnTimeout,
+	})
+	if cfg.PocketBase.TLS.ServerName != "" {
+		pbClient.SetTLSServerName(cfg.PocketBase.TLS.ServerName)
+	}
+
+	// Re-read the password file whenever the client re-authenticates
+	if cfg.PocketBase.AdminPasswordFile != "" {
+		passwordFile := secrets.NewFile(cfg.PocketBase.AdminPasswordFile)
+		pbClient.SetCredentials(cfg.PocketBase.AdminEmail, passwordFile.Read)
 	}
 
-	// Check if config has changed
-	changed, err := fileManager.HasConfigChanged(config)
+	log.With(zap.String("component", "pocketbase")).Debug(
+		"Authenticating with PocketBase",
+		zap.String("url", cfg.PocketBase.URL),
+		zap.String("identity", cfg.PocketBase.AdminEmail),
+	)
+
+	// Wait for a PocketBase that is still starting instead of exiting at once
+	if cfg.PocketBase.AuthRetryTimeout > 0 {
+		err := pbClient.AuthenticateWithRetry(ctx, cfg.PocketBase.AdminEmail, cfg.PocketBase.AdminPassword, cfg.PocketBase.AuthRetryTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return pbClient, nil
+	}
+	if err := pbClient.Authenticate(ctx, cfg.PocketBase.AdminEmail, cfg.PocketBase.AdminPassword); err != nil {
+		return nil, err
+	}
+	return pbClient, nil
+}
+
+// configPathList collects -config values so the flag can be repeated
+type configPathList []string
+
+func (l *configPathList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *configPathList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// writeSampleConfig writes the documented sample config to path, or stdout if path is empty
+func writeSampleConfig(path string) error {
+	if path == "" {
+		return config.WriteSample(os.Stdout)
+	}
+
+	file, err := os.Create(path)
 	if err != nil {
-		return fmt.Errorf("failed to check if config changed: %w", err)
+		return err
+	}
+	if err := config.WriteSample(file); err != nil {
+		file.Close()
+		return err
 	}
+	return file.Close()
+}
 
-	// Only write and reload if the config has changed
-	if changed {
-		log.Debug("Configuration has changed, updating file and reloading NATS")
-		
-		// Write configuration file
-		if err := fileManager.WriteConfigFile(config); err != nil {
-			return fmt.Errorf("failed to write config file: %w", err)
+// reloadWindows converts the configured reload windows and their time zone
+func reloadWindows(cfg *config.Config) ([]nats.ReloadWindow, *time.Location, error) {
+	loc := time.Local
+	if cfg.App.ReloadTimezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(cfg.App.ReloadTimezone); err != nil {
+			return nil, nil, err
 		}
+	}
 
-		// Reload NATS
-		if err := reloader.ReloadConfig(); err != nil {
-			return fmt.Errorf("failed to reload NATS: %w", err)
+	windows := make([]nats.ReloadWindow, 0, len(cfg.App.ReloadWindows))
+	for _, window := range cfg.App.ReloadWindows {
+		days, start, end, err := window.Parse()
+		if err != nil {
+			return nil, nil, err
 		}
+		windows = append(windows, nats.ReloadWindow{Days: days, Start: start, End: end})
+	}
+	return windows, loc, nil
+}
 
-		log.Info("Sync completed successfully with config changes")
-	} else {
-		log.Info("Sync completed, no config changes detected")
+// newReloader creates the NATS reloader from the configuration
+func newReloader(cfg *config.Config, log *zap.Logger) *nats.Reloader {
+	reloader := nats.NewReloader(
+		cfg.NATS.ReloadCommand,
+		log.With(zap.String("component", "reloader")),
+	)
+	reloader.SetSkipMode(cfg.NATS.ReloadSkipMode)
+	reloader.SetMaxReloadsPerHour(cfg.NATS.MaxReloadsPerHour)
+	if cfg.NATS.MonitorURL != "" {
+		reloader.SetVerification(cfg.NATS.MonitorURL, cfg.NATS.VerifyTimeout)
+	}
+	if cfg.NATS.ReloadMode == "ssh" {
+		reloader.SetSSHTarget(nats.SSHConfig{
+			Host:                  cfg.NATS.SSH.Host,
+			Port:                  cfg.NATS.SSH.Port,
+			User:                  cfg.NATS.SSH.User,
+			KeyPath:               cfg.NATS.SSH.KeyPath,
+			KnownHostsFile:        cfg.NATS.SSH.KnownHostsFile,
+			InsecureIgnoreHostKey: cfg.NATS.SSH.InsecureIgnoreHostKey,
+			Timeout:               cfg.NATS.SSH.Timeout,
+		})
 	}
+	if cc := cfg.NATS.PostReloadConnectCheck; cc.Enabled {
+		reloader.SetConnectCheck(nats.ConnectCheck{
+			URL:      cc.URL,
+			Username: cc.Username,
+			Password: cc.Password,
+			Timeout:  cc.Timeout,
+		})
+	}
+	return reloader
+}
 
-	return nil
+// newFileManager creates a file manager for a config file with the shared output settings
+func newFileManager(cfg *config.Config, configFile, backupDir string, log *zap.Logger) *filemanager.FileManager {
+	fm := filemanager.NewFileManager(
+		configFile,
+		backupDir,
+		log.With(zap.String("component", "filemanager"), zap.String("config_file", configFile)),
+	)
+	fm.SetLineEnding(cfg.NATS.LineEnding)
+	fm.SetCollapseWhitespace(cfg.NATS.CollapseWhitespace)
+	fm.SetFollowSymlink(cfg.NATS.FollowSymlink)
+	fm.SetWriteFingerprint(cfg.NATS.WriteFingerprint)
+	fm.SetBackupRequired(cfg.NATS.BackupRequired)
+	fm.SetCompressBackups(cfg.NATS.CompressBackups)
+	// Strict apply already validated the config before anything is written
+	if cfg.NATS.ValidateCommand != "" && !cfg.App.StrictApply {
+		fm.SetValidator(nats.NewValidator(cfg.NATS.ValidateCommand, "").ValidateFile)
+	}
+	if err := fm.ValidateConfigPath(); err != nil {
+		logger.Fatal("Invalid NATS config file path", zap.Error(err))
+	}
+	return fm
 }
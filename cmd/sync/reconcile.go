@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"nats-pocketbase-sync/internal/drift"
+)
+
+// reconcile compares the config on disk with the one PocketBase would produce and logs
+// the drift. It only reports; the first sync applies the changes as usual.
+func (s *syncer) reconcile(ctx context.Context, configFile string) error {
+	roles, err := s.pbClient.GetAllMqttRoles(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get roles: %w", err)
+	}
+	users, err := s.pbClient.GetAllMqttUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get users: %w", err)
+	}
+
+	data, err := s.generator.GenerateConfigData(roles, users)
+	if err != nil {
+		return fmt.Errorf("failed to generate config data: %w", err)
+	}
+
+	report, err := drift.Compare(configFile, data)
+	if err != nil {
+		return err
+	}
+	report.Log(s.log)
+	return nil
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"nats-pocketbase-sync/internal/config"
+	"nats-pocketbase-sync/internal/creds"
+	"nats-pocketbase-sync/internal/filemanager"
+	"nats-pocketbase-sync/internal/generator"
+	"nats-pocketbase-sync/internal/metrics"
+	"nats-pocketbase-sync/internal/models"
+	"nats-pocketbase-sync/internal/nats"
+	"nats-pocketbase-sync/internal/pocketbase"
+	"nats-pocketbase-sync/internal/resolver"
+	"go.uber.org/zap"
+)
+
+// configWriter stores the generated config and reports whether it changed
+type configWriter interface {
+	WriteIfChanged(content string) (bool, error)
+}
+
+// configReloader makes NATS pick up a written config
+type configReloader interface {
+	ReloadConfig() error
+	ReloadNow() error
+}
+
+// currentReader returns the config a writer currently stores, for writers that keep it
+// somewhere other than the config file
+type currentReader interface {
+	Current() (string, error)
+}
+
+// syncer holds the components and state shared across synchronization cycles
+type syncer struct {
+	pbClient    *pocketbase.Client
+	generator   *generator.Generator
+	fileManager *filemanager.FileManager
+	writer      configWriter // Writes the primary config file and any extra destinations, or a KV key
+	writePolicy string
+	reloader    configReloader // Nil when another process picks up the change
+	log         *zap.Logger
+
+	// When set, each account is written to its own include file
+	splitWriter *filemanager.SplitWriter
+	includeDir  string
+
+	// When set, passwords are written to a separate secrets file included by the config
+	secretsManager *filemanager.FileManager
+
+	// When set, a changed config is generated twice and only applied if both match
+	doubleCheck   bool
+	lastGenerated *generatedConfig
+
+	// When set, the previous config is restored if the post-reload connect check fails
+	rollback bool
+
+	// When set, the last backup is restored if NATS fails to reload the new config
+	restoreOnReloadFailure bool
+
+	// When set, the generated config is piped through this command before it is used
+	postProcessor *nats.PostProcessor
+
+	// Destinations with their own reload command, applied independently of the rest
+	clusters           []*cluster
+	clusterConcurrency int
+
+	// When set, a changed config is only written if the validator accepts it
+	validator    *nats.Validator
+	lastAccepted string
+	rejections   uint64
+
+	// When set, a credentials file is written per generated user
+	credsWriter *creds.Writer
+
+	// When set, account JWTs are pushed to a resolver instead of writing a config file
+	publisher        *resolver.Publisher
+	defaultPublish   []string
+	defaultSubscribe []string
+
+	// Config files whose path contains the date, resolved at the start of each cycle
+	datedPaths []datedPath
+
+	// Syncing is paused while this file exists
+	freezeFile string
+	frozen     bool
+
+	// When set, nothing is written or reloaded while the current config has a newer schema
+	schemaVersion int
+
+	// When set, cycle outcomes and PocketBase counts are exported for Prometheus
+	// and the most recent cycles are kept for the history endpoint
+	metrics *metrics.Metrics
+	history *metrics.History
+	cycle   cycleStats
+
+	// Optional change trigger: only run a full sync when this record's value changes
+	versionRecord *pocketbase.RecordRef
+	lastVersion   string
+}
+
+// cycleStats is what a cycle reports to the metrics and the history
+type cycleStats struct {
+	skipped bool
+	changed bool
+	fetched bool // Users and roles were fetched
+	users   int
+	roles   int
+}
+
+// runSync performs a single synchronization cycle and records it in the metrics and history
+func (s *syncer) runSync(ctx context.Context) error {
+	s.cycle = cycleStats{}
+	start := time.Now()
+	err := s.runCycle(ctx)
+	duration := time.Since(start)
+
+	if s.metrics != nil {
+		s.metrics.ObserveCycle(duration, err)
+		if s.cycle.fetched {
+			s.metrics.SetCounts(s.cycle.users, s.cycle.roles)
+		}
+	}
+	if s.history != nil {
+		s.history.Record(s.cycleRecord(ctx, start, duration, err))
+	}
+	return err
+}
+
+// cycleRecord builds the history entry of the cycle that just ran
+func (s *syncer) cycleRecord(ctx context.Context, start time.Time, duration time.Duration, err error) metrics.Cycle {
+	record := metrics.Cycle{
+		Time:     start,
+		Outcome:  metrics.OutcomeSuccess,
+		Changed:  s.cycle.changed,
+		Duration: duration.Seconds(),
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		record.Outcome = metrics.OutcomeAborted
+	case err != nil:
+		record.Outcome = metrics.OutcomeFailed
+		record.Error = err.Error()
+	case s.cycle.skipped:
+		record.Outcome = metrics.OutcomeSkipped
+	}
+	if s.cycle.fetched {
+		users, roles := s.cycle.users, s.cycle.roles
+		record.Users, record.Roles = &users, &roles
+	}
+	return record
+}
+
+// runCycle performs a single synchronization cycle
+func (s *syncer) runCycle(ctx context.Context) error {
+	log := s.log
+
+	// Skip the cycle entirely while the freeze file is present
+	if s.isFrozen() {
+		log.Info("Sync skipped, freeze file present", zap.String("freeze_file", s.freezeFile))
+		s.cycle.skipped = true
+		return nil
+	}
+
+	// Resolve dated paths once, so the whole cycle uses the same files
+	moved, err := s.resolveDatedPaths(time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Skip the full sync if the version record has not changed, unless a file moved
+	version, skip := s.checkVersion(ctx)
+	if skip && !moved {
+		log.Info("Sync skipped, version record unchanged", zap.String("version", version))
+		s.cycle.skipped = true
+		return nil
+	}
+
+	log.Info("Starting sync cycle")
+
+	generated, err := s.generate(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Confirm a new config with a second fetch before applying it
+	if s.doubleCheck && !generated.equal(s.lastGenerated) {
+		log.Debug("Generated config changed, regenerating to confirm")
+		confirm, err := s.generate(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to confirm generated config: %w", err)
+		}
+		if !generated.equal(confirm) {
+			return fmt.Errorf("generated config differs between two consecutive fetches, not applying")
+		}
+	}
+	config, accountFiles := generated.config, generated.accountFiles
+
+	// Push to the account resolver instead of the config file
+	if s.publisher != nil {
+		pushed, err := s.publisher.Publish(s.defaultPublish, s.defaultSubscribe, generated.roles, generated.users)
+		if err != nil {
+			return fmt.Errorf("failed to publish to resolver: %w", err)
+		}
+		log.Info("Sync completed", zap.Bool("resolver_updated", pushed))
+		s.cycle.changed = pushed
+		s.lastVersion = version
+		return nil
+	}
+
+	// Keep the running config when NATS would reject the new one
+	if s.validator != nil && config != s.lastAccepted {
+		if err := s.validator.Validate(config); err != nil {
+			s.rejections++
+			log.Error("Generated config failed validation, keeping the current config",
+				zap.Uint64("rejections", s.rejections),
+				zap.Error(err))
+			return fmt.Errorf("strict apply rejected the generated config: %w", err)
+		}
+		s.lastAccepted = config
+	}
+
+	// Leave a config written by an instance with a newer schema alone
+	if s.schemaVersion > 0 {
+		if err := s.checkSchema(); err != nil {
+			return err
+		}
+	}
+
+	// Clusters are applied on their own, so the primary config's outcome does not block them
+	if len(s.clusters) > 0 {
+		s.applyClusters(config)
+	}
+
+	// Write account include files before the main config that references them
+	accountsChanged := false
+	if s.splitWriter != nil {
+		accountsChanged, err = s.splitWriter.WriteFiles(accountFiles)
+		if err != nil {
+			return fmt.Errorf("failed to write account files: %w", err)
+		}
+	}
+
+	// Write the secrets file before the config that includes it
+	secretsChanged := false
+	if s.secretsManager != nil {
+		secretsChanged, err = s.writeSecrets(generated.secrets)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Keep the current config so a change that locks users out can be rolled back
+	var previous string
+	if s.rollback {
+		previous, err = s.fileManager.ReadConfigFile()
+		if err != nil {
+			return fmt.Errorf("failed to read current config for rollback: %w", err)
+		}
+	}
+
+	// Write every destination whose config has changed
+	changed, writeErr := s.writer.WriteIfChanged(config)
+	if writeErr != nil && (!changed || s.writePolicy == filemanager.WritePolicyFailFast) {
+		return fmt.Errorf("failed to write config: %w", writeErr)
+	}
+	if changed {
+		s.recordFingerprint(s.fileManager.LastFingerprint())
+	}
+	changed = changed || accountsChanged || secretsChanged
+	s.cycle.changed = changed
+
+	// Only reload if the config has changed
+	if changed {
+		log.Debug("Configuration has changed, reloading NATS")
+
+		// Reload NATS, unless another process picks up the change
+		if s.reloader != nil {
+			if err := s.reloader.ReloadConfig(); err != nil {
+				if errors.Is(err, nats.ErrConnectCheckFailed) {
+					if s.rollback {
+						s.rollbackConfig(previous)
+					}
+				} else if s.restoreOnReloadFailure {
+					s.restoreLastBackup()
+				}
+				return fmt.Errorf("failed to reload NATS: %w", err)
+			}
+		}
+
+		log.Info("Sync completed successfully with config changes",
+			zap.String("fingerprint", s.fileManager.LastFingerprint()))
+	} else {
+		log.Info("Sync completed, no config changes detected")
+		// The config on disk matches the generated one, e.g. after a restart
+		if s.fileManager.LastFingerprint() == "" {
+			s.recordFingerprint(s.fileManager.Fingerprint(config))
+		}
+	}
+
+	// Distribute per-user credentials once the server config is in place
+	if s.credsWriter != nil {
+		if err := s.credsWriter.Write(); err != nil {
+			return fmt.Errorf("failed to write credentials: %w", err)
+		}
+	}
+
+	// Report partial write failures after reloading the destinations that succeeded
+	if writeErr != nil {
+		return fmt.Errorf("failed to write config to some destinations: %w", writeErr)
+	}
+
+	// Remember the version only once the full sync has succeeded
+	s.lastVersion = version
+	s.lastGenerated = generated
+	return nil
+}
+
+// generatedConfig is the output of one generation
+type generatedConfig struct {
+	config       string
+	accountFiles map[string]string
+	secrets      string
+	roles        []models.MqttRole // Fetched roles and users, for resolver signing key scopes and user JWTs
+	users        []models.MqttUser
+}
+
+// equal reports whether two generations produced identical output
+func (g *generatedConfig) equal(other *generatedConfig) bool {
+	return other != nil &&
+		g.config == other.config &&
+		g.secrets == other.secrets &&
+		maps.Equal(g.accountFiles, other.accountFiles)
+}
+
+// generate fetches roles and users from PocketBase and generates the config
+func (s *syncer) generate(ctx context.Context) (*generatedConfig, error) {
+	// Get roles from PocketBase
+	roles, err := s.pbClient.GetAllMqttRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	// Get users from PocketBase
+	users, err := s.pbClient.GetAllMqttUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	s.cycle.fetched, s.cycle.users, s.cycle.roles = true, len(users), len(roles)
+
+	// Generate NATS configuration
+	generated := &generatedConfig{}
+	if s.splitWriter != nil {
+		generated.config, generated.accountFiles, err = s.generator.GenerateSplitConfig(roles, users, s.includeDir)
+	} else {
+		generated.config, err = s.generator.GenerateConfig(roles, users)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate config: %w", err)
+	}
+	generated.secrets = s.generator.SecretsFile()
+
+	// Signing key scopes and user JWTs are built from the records, so they get the same
+	// subject prefix and inheritance
+	if s.publisher != nil {
+		generated.roles, generated.users, err = s.generator.ApplySubjectPrefix(roles, users)
+		if err != nil {
+			return nil, err
+		}
+		generated.roles = s.generator.InheritPermissions(generated.roles)
+	}
+
+	// Let an external formatter or policy check have the final say
+	if s.postProcessor != nil {
+		generated.config, err = s.postProcessor.Process(generated.config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return generated, nil
+}
+
+// isFrozen reports whether the freeze file exists, logging transitions
+func (s *syncer) isFrozen() bool {
+	if s.freezeFile == "" {
+		return false
+	}
+
+	_, err := os.Stat(s.freezeFile)
+	frozen := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		s.log.Warn("Failed to check freeze file, continuing sync", zap.Error(err))
+	}
+
+	if frozen && !s.frozen {
+		s.log.Warn("Freeze file detected, pausing sync", zap.String("freeze_file", s.freezeFile))
+	} else if !frozen && s.frozen {
+		s.log.Info("Freeze file removed, resuming sync", zap.String("freeze_file", s.freezeFile))
+	}
+	s.frozen = frozen
+	return frozen
+}
+
+// checkVersion fetches the version record and reports whether the full sync can be skipped.
+// A missing or unreadable version record always falls back to a full sync.
+func (s *syncer) checkVersion(ctx context.Context) (string, bool) {
+	if s.versionRecord == nil {
+		return "", false
+	}
+
+	version, err := s.pbClient.GetRecordField(ctx, *s.versionRecord)
+	if err != nil {
+		if errors.Is(err, pocketbase.ErrRecordNotFound) {
+			s.log.Warn("Version record not found, running full sync",
+				zap.String("collection", s.versionRecord.Collection),
+				zap.String("id", s.versionRecord.ID))
+		} else {
+			s.log.Warn("Failed to fetch version record, running full sync", zap.Error(err))
+		}
+		return "", false
+	}
+
+	if s.lastVersion != "" && version == s.lastVersion {
+		return version, true
+	}
+
+	s.log.Debug("Version record changed",
+		zap.String("previous", s.lastVersion),
+		zap.String("current", version))
+	return version, false
+}
+
+// checkSchema fails when the stored config has a newer schema version than this
+// instance generates, e.g. during a rolling upgrade
+func (s *syncer) checkSchema() error {
+	var current string
+	var err error
+	if reader, ok := s.writer.(currentReader); ok {
+		current, err = reader.Current()
+	} else {
+		current, err = s.fileManager.ReadConfigFile()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read current config for schema check: %w", err)
+	}
+	if version, ok := models.ParseSchemaMarker(current); ok && version > s.schemaVersion {
+		return fmt.Errorf("current config has schema %d, newer than this instance's schema %d, not writing or reloading", version, s.schemaVersion)
+	}
+	return nil
+}
+
+// rollbackConfig restores the config that was in place before this cycle and reloads NATS
+func (s *syncer) rollbackConfig(previous string) {
+	if previous == "" {
+		s.log.Warn("No previous config to roll back to")
+		return
+	}
+
+	s.log.Warn("Rolling back to the previous config")
+	if err := s.fileManager.WriteConfigFile(previous); err != nil {
+		s.log.Error("Failed to restore previous config", zap.Error(err))
+		return
+	}
+	// The rejected config is no longer on disk, so the next cycle must not see it as unchanged
+	s.fileManager.ForgetContentHash()
+	if err := s.reloader.ReloadNow(); err != nil {
+		s.log.Error("Failed to reload NATS after rollback", zap.Error(err))
+		return
+	}
+	s.log.Info("Rolled back to the previous config",
+		zap.String("fingerprint", s.fileManager.LastFingerprint()))
+	s.recordFingerprint(s.fileManager.LastFingerprint())
+}
+
+// restoreLastBackup restores the config backed up by this cycle's write and reloads NATS
+func (s *syncer) restoreLastBackup() {
+	s.log.Warn("Reload failed, restoring the last backup")
+	backup, err := s.fileManager.RestoreLastBackup()
+	if err != nil {
+		s.log.Error("Failed to restore the last backup", zap.Error(err))
+		return
+	}
+	if err := s.reloader.ReloadNow(); err != nil {
+		s.log.Error("Failed to reload NATS after restoring the last backup", zap.Error(err))
+		return
+	}
+	s.log.Info("Restored the last backup",
+		zap.String("backup", backup.Path),
+		zap.String("fingerprint", s.fileManager.LastFingerprint()))
+	s.recordFingerprint(s.fileManager.LastFingerprint())
+}
+
+// recordFingerprint exports the fingerprint of the config now in place, if known
+func (s *syncer) recordFingerprint(fingerprint string) {
+	if s.metrics != nil && fingerprint != "" {
+		s.metrics.SetConfigFingerprint(fingerprint)
+	}
+}
+
+// writeSecrets writes the secrets file if it changed and reports whether it did
+func (s *syncer) writeSecrets(content string) (bool, error) {
+	changed, err := s.secretsManager.HasConfigChanged(content)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if secrets changed: %w", err)
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if err := s.secretsManager.WriteConfigFile(content); err != nil {
+		return false, fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	return true, nil
+}
+
+// datedPath is a config file whose path changes with the date
+type datedPath struct {
+	fileManager *filemanager.FileManager
+	template    *config.PathTemplate
+}
+
+// resolveDatedPaths points each dated file manager at the path for now and reports
+// whether any path changed
+func (s *syncer) resolveDatedPaths(now time.Time) (bool, error) {
+	moved := false
+	for _, dated := range s.datedPaths {
+		path, err := dated.template.Resolve(now)
+		if err != nil {
+			return false, err
+		}
+		if path != dated.fileManager.ConfigFile() {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return false, fmt.Errorf("failed to create config file directory: %w", err)
+			}
+			dated.fileManager.SetConfigFile(path)
+			moved = true
+		}
+	}
+	return moved, nil
+}
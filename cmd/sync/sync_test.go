@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/filemanager"
+	"nats-pocketbase-sync/internal/generator"
+	"nats-pocketbase-sync/internal/metrics"
+	"nats-pocketbase-sync/internal/nats"
+	"nats-pocketbase-sync/internal/pocketbase"
+	"go.uber.org/zap"
+)
+
+// fakeReloader fails ReloadConfig with err and records reloads of a restored config
+type fakeReloader struct {
+	err        error
+	reloads    int
+	reloadsNow int
+	onReload   func() // Called on every reload, e.g. to capture the config NATS would load
+}
+
+func (r *fakeReloader) ReloadConfig() error {
+	r.reloads++
+	if r.onReload != nil {
+		r.onReload()
+	}
+	return r.err
+}
+
+func (r *fakeReloader) ReloadNow() error {
+	r.reloadsNow++
+	if r.onReload != nil {
+		r.onReload()
+	}
+	return nil
+}
+
+func (r *fakeReloader) Pending() bool { return false }
+
+func (r *fakeReloader) Stop() {}
+
+// newTestPocketBase serves one role and one user and returns a client authenticated against it
+func newTestPocketBase(t *testing.T) *pocketbase.Client {
+	t.Helper()
+
+	responses := map[string]string{
+		"/api/collections/_superusers/auth-with-password": `{"token": "test-token-0123456789"}`,
+		"/api/collections/mqtt_roles/records": `{"page": 1, "perPage": 100, "totalItems": 1, "totalPages": 1, "items": [
+			{"id": "r1", "name": "reader", "publish_permissions": ["sensors.>"], "subscribe_permissions": ["sensors.>"]}]}`,
+		"/api/collections/mqtt_users/records": `{"page": 1, "perPage": 100, "totalItems": 1, "totalPages": 1, "items": [
+			{"id": "u1", "username": "alice", "password": "secret", "role_id": "r1", "active": true}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	client := pocketbase.NewClient(server.URL, "mqtt_users", "mqtt_roles", zap.NewNop())
+	if err := client.Authenticate(context.Background(), "admin@example.com", "secret"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	return client
+}
+
+func TestRunCycleRestoresBackupWhenReloadFails(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "nats.conf")
+	const previous = "# config NATS is running\nport: 4222\n"
+	if err := os.WriteFile(configFile, []byte(previous), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fm := filemanager.NewFileManager(configFile, filepath.Join(dir, "backups"), zap.NewNop())
+	var loaded []string
+	reloader := &fakeReloader{err: errors.New("nats-server: configuration error")}
+	reloader.onReload = func() {
+		content, err := os.ReadFile(configFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded = append(loaded, string(content))
+	}
+
+	s := &syncer{
+		pbClient:    newTestPocketBase(t),
+		generator:   generator.NewGenerator("PUBLIC.>", []interface{}{"PUBLIC.>", "_INBOX.>"}, zap.NewNop()),
+		fileManager: fm,
+		writer: filemanager.NewMultiWriter([]*filemanager.FileManager{fm}, 1,
+			filemanager.WritePolicyFailFast, zap.NewNop()),
+		writePolicy:            filemanager.WritePolicyFailFast,
+		reloader:               reloader,
+		log:                    zap.NewNop(),
+		restoreOnReloadFailure: true,
+	}
+
+	err := s.runSync(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failed to reload NATS") {
+		t.Fatalf("runSync error = %v, want the reload failure", err)
+	}
+
+	// NATS was asked to load the new config, then the restored one
+	if reloader.reloads != 1 || reloader.reloadsNow != 1 {
+		t.Fatalf("got %d reloads and %d reloads of the restored config, want 1 and 1", reloader.reloads, reloader.reloadsNow)
+	}
+	if !strings.Contains(loaded[0], `"alice"`) {
+		t.Errorf("first reload saw %q, want the new config", loaded[0])
+	}
+
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != previous {
+		t.Errorf("config file after failed reload = %q, want the previous config %q", content, previous)
+	}
+	if loaded[1] != previous {
+		t.Errorf("second reload saw %q, want the previous config", loaded[1])
+	}
+
+	// The restored file is what is on disk now, so the next cycle applies the new config again
+	if err := s.runSync(context.Background()); err == nil {
+		t.Fatal("second runSync succeeded, want the reload failure again")
+	}
+	if reloader.reloads != 2 {
+		t.Errorf("got %d reloads after the second cycle, want the new config retried", reloader.reloads)
+	}
+}
+
+func TestRunCycleRetriesAfterRollback(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "nats.conf")
+	const previous = "# config NATS is running\nport: 4222\n"
+	if err := os.WriteFile(configFile, []byte(previous), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fm := filemanager.NewFileManager(configFile, filepath.Join(dir, "backups"), zap.NewNop())
+	reloader := &fakeReloader{err: fmt.Errorf("alice rejected: %w", nats.ErrConnectCheckFailed)}
+	s := &syncer{
+		pbClient:    newTestPocketBase(t),
+		generator:   generator.NewGenerator("PUBLIC.>", []interface{}{"PUBLIC.>", "_INBOX.>"}, zap.NewNop()),
+		fileManager: fm,
+		writer: filemanager.NewMultiWriter([]*filemanager.FileManager{fm}, 1,
+			filemanager.WritePolicyFailFast, zap.NewNop()),
+		writePolicy: filemanager.WritePolicyFailFast,
+		reloader:    reloader,
+		log:         zap.NewNop(),
+		rollback:    true,
+	}
+
+	for cycle := 1; cycle <= 2; cycle++ {
+		if err := s.runSync(context.Background()); err == nil {
+			t.Fatalf("cycle %d succeeded, want the connect check failure", cycle)
+		}
+		if reloader.reloads != cycle || reloader.reloadsNow != cycle {
+			t.Fatalf("after cycle %d got %d reloads and %d rollback reloads, want %d of each",
+				cycle, reloader.reloads, reloader.reloadsNow, cycle)
+		}
+		if got := readTestFile(t, configFile); got != previous {
+			t.Errorf("config file after cycle %d = %q, want the previous config", cycle, got)
+		}
+	}
+}
+
+func TestRunCycleExportsConfigFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	fm := filemanager.NewFileManager(filepath.Join(dir, "nats.conf"), filepath.Join(dir, "backups"), zap.NewNop())
+	s := &syncer{
+		pbClient:    newTestPocketBase(t),
+		generator:   generator.NewGenerator("PUBLIC.>", []interface{}{"PUBLIC.>", "_INBOX.>"}, zap.NewNop()),
+		fileManager: fm,
+		writer: filemanager.NewMultiWriter([]*filemanager.FileManager{fm}, 1,
+			filemanager.WritePolicyFailFast, zap.NewNop()),
+		writePolicy: filemanager.WritePolicyFailFast,
+		reloader:    &fakeReloader{},
+		log:         zap.NewNop(),
+		metrics:     metrics.New(),
+	}
+
+	if err := s.runSync(context.Background()); err != nil {
+		t.Fatalf("runSync: %v", err)
+	}
+	var out strings.Builder
+	s.metrics.WriteTo(&out)
+	want := `nats_pocketbase_sync_config_info{fingerprint="` + fm.LastFingerprint() + `"} 1`
+	if fm.LastFingerprint() == "" || !strings.Contains(out.String(), want) {
+		t.Errorf("metrics lack %q:\n%s", want, out.String())
+	}
+}
+
+// fakeKVWriter stores the config in memory, like the Consul writer
+type fakeKVWriter struct {
+	value string
+}
+
+func (w *fakeKVWriter) WriteIfChanged(content string) (bool, error) {
+	changed := content != w.value
+	w.value = content
+	return changed, nil
+}
+
+func (w *fakeKVWriter) Current() (string, error) {
+	return w.value, nil
+}
+
+func TestCheckSchemaReadsStoredConfig(t *testing.T) {
+	dir := t.TempDir()
+	fm := filemanager.NewFileManager(filepath.Join(dir, "nats.conf"), filepath.Join(dir, "backups"), zap.NewNop())
+	s := &syncer{
+		fileManager: fm,
+		writer: filemanager.NewMultiWriter([]*filemanager.FileManager{fm}, 1,
+			filemanager.WritePolicyFailFast, zap.NewNop()),
+		schemaVersion: 2,
+		log:           zap.NewNop(),
+	}
+
+	if err := s.checkSchema(); err != nil {
+		t.Errorf("checkSchema without a config = %v, want nil", err)
+	}
+	if err := fm.WriteConfigFile("# schema: 3\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkSchema(); err == nil {
+		t.Error("checkSchema passed over a newer schema on disk")
+	}
+
+	// A KV writer's stored value is checked instead of the file
+	s.writer = &fakeKVWriter{value: "# schema: 1\n"}
+	if err := s.checkSchema(); err != nil {
+		t.Errorf("checkSchema over an older stored schema = %v, want nil", err)
+	}
+	s.writer = &fakeKVWriter{value: "# schema: 3\n"}
+	if err := s.checkSchema(); err == nil {
+		t.Error("checkSchema passed over a newer stored schema")
+	}
+}
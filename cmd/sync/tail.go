@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// tailBacklog is how much of the end of the log -tail prints before following it
+	tailBacklog = 16 * 1024
+	// tailPollInterval is how often -tail checks the log for new lines
+	tailPollInterval = 500 * time.Millisecond
+)
+
+// ANSI colors used by -tail
+const (
+	colorReset  = "\033[0m"
+	colorDim    = "\033[2m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+	colorCyan   = "\033[36m"
+)
+
+// levelColors maps zap levels to the color their label is printed in
+var levelColors = map[string]string{
+	"debug":  colorBlue,
+	"info":   colorCyan,
+	"warn":   colorYellow,
+	"error":  colorRed,
+	"dpanic": colorRed,
+	"panic":  colorRed,
+	"fatal":  colorRed,
+}
+
+// runTail prints the end of the JSON log at path in a readable form, then follows it
+// like tail -f, reopening the file when it is truncated or rotated
+func runTail(path string, out io.Writer, color bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log: %w", err)
+	}
+	defer func() { file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat log: %w", err)
+	}
+	offset := info.Size() - tailBacklog
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek log: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	if offset > 0 {
+		// Skip the partial line the backlog starts in
+		if _, err := reader.ReadString('\n'); err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+	}
+	position := offset
+
+	var pending string
+	for {
+		line, err := reader.ReadString('\n')
+		position += int64(len(line))
+		pending += line
+		if err == nil {
+			fmt.Fprintln(out, formatLogLine(strings.TrimRight(pending, "\r\n"), color))
+			pending = ""
+			continue
+		}
+		if err != io.EOF {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+
+		time.Sleep(tailPollInterval)
+
+		current, statErr := os.Stat(path)
+		if statErr != nil {
+			// Rotated away and not recreated yet
+			continue
+		}
+		if os.SameFile(info, current) && current.Size() >= position {
+			continue
+		}
+
+		// Truncated or replaced: start over from the beginning of the new file
+		reopened, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		file.Close()
+		file = reopened
+		if info, err = file.Stat(); err != nil {
+			return fmt.Errorf("failed to stat log: %w", err)
+		}
+		reader = bufio.NewReader(file)
+		position = 0
+		pending = ""
+	}
+}
+
+// formatLogLine renders a JSON log entry as level, time, message and the remaining
+// fields as key=value. Lines that are not JSON objects are returned unchanged.
+func formatLogLine(line string, color bool) string {
+	// UseNumber keeps large integers such as byte counts out of exponent notation
+	var entry map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&entry); err != nil || entry == nil {
+		return line
+	}
+
+	paint := func(code, text string) string {
+		if !color || code == "" {
+			return text
+		}
+		return code + text + colorReset
+	}
+
+	level, _ := entry["level"].(string)
+	timestamp, _ := entry["ts"].(string)
+	message, _ := entry["msg"].(string)
+	caller, _ := entry["caller"].(string)
+	if t, err := time.Parse("2006-01-02T15:04:05.000Z0700", timestamp); err == nil {
+		timestamp = t.Format("2006-01-02 15:04:05.000")
+	}
+
+	var b strings.Builder
+	b.WriteString(paint(colorDim, timestamp))
+	b.WriteString(" ")
+	b.WriteString(paint(levelColors[level], fmt.Sprintf("%-5s", strings.ToUpper(level))))
+	b.WriteString(" ")
+	b.WriteString(message)
+
+	keys := make([]string, 0, len(entry))
+	for key := range entry {
+		switch key {
+		case "level", "ts", "msg", "caller", "stacktrace":
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString(" ")
+		b.WriteString(paint(colorDim, key+"="))
+		b.WriteString(formatLogValue(entry[key]))
+	}
+
+	if caller != "" {
+		b.WriteString(" ")
+		b.WriteString(paint(colorDim, caller))
+	}
+	if stack, ok := entry["stacktrace"].(string); ok && stack != "" {
+		b.WriteString("\n")
+		b.WriteString(paint(colorDim, stack))
+	}
+	return b.String()
+}
+
+// formatLogValue formats a log field value, quoting strings that contain spaces
+func formatLogValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if v == "" || strings.ContainsAny(v, " \t\"=") {
+			return fmt.Sprintf("%q", v)
+		}
+		return v
+	case nil:
+		return "null"
+	case json.Number, bool:
+		return fmt.Sprint(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// colorOutput reports whether -tail should color its output: only on a terminal
+// and when NO_COLOR is not set
+func colorOutput() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
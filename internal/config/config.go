@@ -1,77 +1,716 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
+
+	"nats-pocketbase-sync/internal/secrets"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// Config represents the application configuration
+// DefaultValidateCommand validates configs for app.strict_apply when nats.validate_command is empty
+const DefaultValidateCommand = "nats-server -t -c {config}"
+
+// Config represents the application configuration.
+// The desc tags document each option in the sample generated by WriteSample.
 type Config struct {
 	App struct {
-		SyncInterval int    `mapstructure:"sync_interval"`
-		LogLevel     string `mapstructure:"log_level"`
-		LogFile      string `mapstructure:"log_file"`
+		SyncInterval int    `mapstructure:"sync_interval" desc:"Seconds between sync cycles"`
+		LogLevel     string `mapstructure:"log_level" desc:"debug, info, warn or error"`
+		LogFile      string `mapstructure:"log_file" desc:"Also write logs to this file"`
+		LogSummary   bool   `mapstructure:"log_summary" desc:"Log per-role user counts each cycle"`
+		FreezeFile   string `mapstructure:"freeze_file" desc:"Syncing is paused while this file exists"`
+		InitialDelay time.Duration `mapstructure:"initial_delay" desc:"Wait before the first sync"`
+		MaxStaleDuration time.Duration `mapstructure:"max_stale_duration" desc:"Exit with code 3 if no sync succeeds for this long, 0 to disable"`
+		RunOnce      bool   `mapstructure:"run_once" desc:"Run a single sync cycle and exit, with status 1 if it failed"`
+		MetricsAddr  string `mapstructure:"metrics_addr" desc:"Serve Prometheus metrics on this address, e.g. :9090, empty to disable"`
+		HistorySize  int    `mapstructure:"history_size" desc:"Recent sync cycles served as JSON at /history on metrics_addr, 0 to disable"`
+
+		// Manual overrides applied on top of PocketBase state
+		ForceIncludeUsers []StaticUser `mapstructure:"force_include_users" desc:"Users merged in if not present in PocketBase"`
+		ExcludeUsers      []string     `mapstructure:"exclude_users" desc:"Usernames dropped even if active in PocketBase"`
+		OnEmptyPassword   string       `mapstructure:"on_empty_password" desc:"allow, skip or fail on users with an empty username or password"`
+		SkipExpiredUsers  bool          `mapstructure:"skip_expired_users" desc:"Leave out users whose expires_at has passed"`
+		ExpiryWarning     time.Duration `mapstructure:"expiry_warning" desc:"Warn about users expiring within this window, 0 to disable"`
+		DoubleCheckGenerate bool       `mapstructure:"double_check_generate" desc:"Regenerate a changed config and apply it only if both match"`
+		StrictApply       bool         `mapstructure:"strict_apply" desc:"Only write a changed config if nats.validate_command accepts it"`
+		StartupReconcile  bool         `mapstructure:"startup_reconcile" desc:"Log drift between the config on disk and PocketBase before the first sync"`
+		ReloadWindows     []ReloadWindow `mapstructure:"reload_windows" desc:"Reload NATS only within these periods, any time when empty"`
+		ReloadTimezone    string       `mapstructure:"reload_timezone" desc:"IANA time zone of reload_windows, empty for the local zone"`
 	} `mapstructure:"app"`
 
 	PocketBase struct {
-		URL            string `mapstructure:"url"`
-		AdminEmail     string `mapstructure:"admin_email"`    // Username/email for the _superusers collection
-		AdminPassword  string `mapstructure:"admin_password"` // Password for authentication
-		UserCollection string `mapstructure:"user_collection"`
-		RoleCollection string `mapstructure:"role_collection"`
+		URL            string `mapstructure:"url" desc:"PocketBase base URL"`
+		ReadURL        string `mapstructure:"read_url" desc:"Optional read replica for user and role fetches"`
+		AdminEmail     string `mapstructure:"admin_email" desc:"Username/email in auth_collection"`
+		AdminPassword  string `mapstructure:"admin_password" desc:"Password for authentication"`
+		AdminPasswordFile string `mapstructure:"admin_password_file" desc:"File containing the password, re-read on re-authentication"`
+		AuthCollection string `mapstructure:"auth_collection" desc:"Auth collection admin_email is checked against, _superusers by default"`
+		AuthRetryTimeout time.Duration `mapstructure:"auth_retry_timeout" desc:"Keep retrying the first authentication this long, e.g. while PocketBase starts, 0 to fail at once"`
+		UserCollection string `mapstructure:"user_collection" desc:"Collection holding MQTT users"`
+		RoleCollection string `mapstructure:"role_collection" desc:"Collection holding MQTT roles"`
+		FieldKey       string `mapstructure:"field_key" desc:"Hex or base64 AES-256 key for encrypted password fields"`
+		FieldKeyFile   string `mapstructure:"field_key_file" desc:"File containing the field key"`
+		ValidateSchema bool   `mapstructure:"validate_schema" desc:"Check collection fields at startup"`
+		AccessCheck    string `mapstructure:"access_check" desc:"fail, warn or off when the collections cannot be listed at startup"`
+		MaxUsers       int    `mapstructure:"max_users" desc:"Safety cap on fetched users, 0 for unlimited"`
+		MaxRoles       int    `mapstructure:"max_roles" desc:"Safety cap on fetched roles, 0 for unlimited"`
+		LimitAction    string `mapstructure:"limit_action" desc:"fail or truncate when a cap is exceeded"`
+		PageSize       int    `mapstructure:"page_size" desc:"Records requested per page when listing users and roles"`
+		HTTPTimeout    time.Duration `mapstructure:"http_timeout" desc:"Timeout for each PocketBase request, e.g. 30s for large pages"`
+
+		// Connection reuse tuning, zero values keep the net/http defaults
+		HTTP struct {
+			MaxIdleConns        int           `mapstructure:"max_idle_conns" desc:"Idle connections kept across all hosts"`
+			MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host" desc:"Idle connections kept per host"`
+			MaxConnsPerHost     int           `mapstructure:"max_conns_per_host" desc:"Concurrent connections per host, 0 for unlimited"`
+			IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout" desc:"How long an idle connection is kept open"`
+		} `mapstructure:"http" desc:"Connection reuse tuning, 0 keeps the Go defaults"`
+
+		TLS struct {
+			ServerName string `mapstructure:"server_name" desc:"Overrides the host used for SNI and certificate verification"`
+		} `mapstructure:"tls"`
+
+		// Optional record whose value changes whenever users or roles change
+		VersionRecord struct {
+			Collection string `mapstructure:"collection"`
+			ID         string `mapstructure:"id"`
+			Field      string `mapstructure:"field"`
+		} `mapstructure:"version_record" desc:"Only run a full sync when this record's field changes"`
 	} `mapstructure:"pocketbase"`
 
 	NATS struct {
-		ConfigFile     string `mapstructure:"config_file"`
-		ConfigBackupDir string `mapstructure:"config_backup_dir"`
-		ReloadCommand  string `mapstructure:"reload_command"`
+		ConfigFile     string `mapstructure:"config_file" desc:"Generated NATS config file, may use {{.Env.NAME}} and {{.Date}}"`
+		ConfigBackupDir string `mapstructure:"config_backup_dir" desc:"Backups of replaced config files"`
+		BackupRequired bool `mapstructure:"backup_required" desc:"Do not write a config whose predecessor could not be backed up"`
+		CompressBackups bool `mapstructure:"compress_backups" desc:"Gzip backups as .conf.gz"`
+		VerifyBackupsInterval time.Duration `mapstructure:"verify_backups_interval" desc:"Check the newest backups for corruption this often, 0 to disable"`
+		VerifyBackupsCount    int           `mapstructure:"verify_backups_count" desc:"Newest backups checked per file"`
+		DedupeBackups bool `mapstructure:"dedupe_backups" desc:"Remove backups with the same content as an earlier backup during cleanup"`
+		BackupMaxAge         time.Duration `mapstructure:"backup_max_age" desc:"Remove backups older than this after each sync, 0 to keep them regardless of age"`
+		BackupRetentionCount int           `mapstructure:"backup_retention_count" desc:"Keep only this many newest backups per file, 0 for no limit"`
+		Destinations []Destination `mapstructure:"destinations" desc:"Extra config files written alongside config_file"`
+		WriteConcurrency   int    `mapstructure:"write_concurrency" desc:"Destinations written in parallel"`
+		WriteFailurePolicy string `mapstructure:"write_failure_policy" desc:"fail_fast or best_effort"`
+		LineEnding     string `mapstructure:"line_ending" desc:"lf or crlf"`
+		CollapseWhitespace bool `mapstructure:"collapse_whitespace" desc:"Collapse insignificant whitespace so whitespace-only changes never reload"`
+		FollowSymlink  bool   `mapstructure:"follow_symlink" desc:"Write to the target of a symlinked config file"`
+		WriteFingerprint bool `mapstructure:"write_fingerprint" desc:"Write <config_file>.fingerprint after each write"`
+		OutputTarget   string `mapstructure:"output_target" desc:"file, resolver or consul"`
+		OutputMode     string `mapstructure:"output_mode" desc:"authorization or accounts"`
+		TargetVersion  string `mapstructure:"target_version" desc:"NATS server version the config is generated for, e.g. 2.10 or 2.1.9"`
+		SplitByAccount bool   `mapstructure:"split_by_account" desc:"Write each account to accounts/<name>.conf"`
+		UsernamePrefix string `mapstructure:"username_prefix" desc:"Prepended to every emitted username"`
+		UsernameSuffix string `mapstructure:"username_suffix" desc:"Appended to every emitted username"`
+		SystemAccount  string `mapstructure:"system_account" desc:"Account emitted as system_account, accounts mode only"`
+		AccountOrder   string `mapstructure:"account_order" desc:"name or priority (role sort_order), accounts mode only"`
+		GroupAccounts  bool   `mapstructure:"group_accounts" desc:"Cluster accounts by role group with separator comments, accounts mode only"`
+		WrapInAccount  string `mapstructure:"wrap_in_account" desc:"Emit all users inside this one account instead of the authorization block, authorization mode only"`
+		DuplicateUsernamePolicy string `mapstructure:"duplicate_username_policy" desc:"skip keeps the earliest created of users sharing a username, error fails the cycle"`
+		InvalidSubjectPolicy    string `mapstructure:"invalid_subject_policy" desc:"skip leaves out roles (with their users) and users granting a malformed subject, error fails the cycle"`
+		HashPasswords    bool `mapstructure:"hash_passwords" desc:"Emit user passwords as bcrypt hashes instead of plaintext"`
+		PasswordHashCost int  `mapstructure:"password_hash_cost" desc:"bcrypt cost used by hash_passwords"`
+		SubjectPrefix     string `mapstructure:"subject_prefix" desc:"Every subject permission from PocketBase must start with this, e.g. prod."`
+		SubjectPrefixMode string `mapstructure:"subject_prefix_mode" desc:"enforce fails on subjects outside subject_prefix, auto prepends it"`
+		AnnotateRoles  bool   `mapstructure:"annotate_roles" desc:"Emit role description and metadata as comments"`
+		SplitSecrets   bool   `mapstructure:"split_secrets" desc:"Move passwords into an included secrets file"`
+		SecretsFile    string `mapstructure:"secrets_file" desc:"Secrets file name, next to config_file"`
+		WriteCreds     bool   `mapstructure:"write_creds" desc:"Write a credentials file per user to creds_dir"`
+		CredsDir       string `mapstructure:"creds_dir" desc:"Directory for per-user credentials files"`
+		CredsURL       string `mapstructure:"creds_url" desc:"Server URL included in credentials files"`
+		Mappings       []AccountMapping `mapstructure:"mappings" desc:"Subject mappings per account, accounts mode only"`
+		Resolver struct {
+			URL                    string `mapstructure:"url"`
+			OperatorSigningKeyFile string `mapstructure:"operator_signing_key_file"`
+			AccountSeedFile        string `mapstructure:"account_seed_file"`
+			AccountName            string `mapstructure:"account_name"`
+			SigningKeys            []SigningKey `mapstructure:"signing_keys" desc:"Scoped signing keys whose user template comes from a PocketBase role"`
+			UserJWTDir             string `mapstructure:"user_jwt_dir" desc:"Directory a JWT is written to for every nkey user, empty to not issue user JWTs"`
+		} `mapstructure:"resolver" desc:"Account resolver, used when output_target is resolver"`
+		Consul struct {
+			Address    string `mapstructure:"address"`
+			Key        string `mapstructure:"key"`
+			Token      string `mapstructure:"token"`
+			TokenFile  string `mapstructure:"token_file"`
+			Datacenter string `mapstructure:"datacenter"`
+		} `mapstructure:"consul" desc:"Consul KV, used when output_target is consul"`
+		Leafnodes struct {
+			Enabled bool `mapstructure:"enabled" desc:"Emit a leafnodes block authenticating users flagged as leaf"`
+			Port    int  `mapstructure:"port" desc:"Leafnode listen port"`
+		} `mapstructure:"leafnodes" desc:"Hub-side leafnode users from PocketBase"`
+		ReloadCommand  string `mapstructure:"reload_command" desc:"Command that makes NATS reload its config"`
+		ValidateCommand string `mapstructure:"validate_command" desc:"Command that must accept a config before it is written, {config} is replaced with its path (empty = no validation)"`
+		PostGenerateCommand string `mapstructure:"post_generate_command" desc:"Command that receives the generated config on stdin and prints the config to write"`
+		PostGenerateTimeout time.Duration `mapstructure:"post_generate_timeout" desc:"How long post_generate_command may run"`
+		ReloadMode     string `mapstructure:"reload_mode" desc:"local or ssh"`
+		ReloadSkipMode string `mapstructure:"reload_skip_mode" desc:"drop or defer reloads requested too soon"`
+		MaxReloadsPerHour int `mapstructure:"max_reloads_per_hour" desc:"Token bucket limit on reloads, 0 for unlimited"`
+		MonitorURL     string `mapstructure:"monitor_url" desc:"NATS monitoring URL used to verify reloads"`
+		VerifyTimeout  time.Duration `mapstructure:"verify_timeout" desc:"How long to poll /varz after a reload"`
+		SchemaMarker   bool `mapstructure:"schema_marker" desc:"Mark the config with its schema version and leave configs with a newer schema alone"`
+		SchemaVersion  int  `mapstructure:"schema_version" desc:"Schema version written by schema_marker, bump it for incompatible config changes"`
+		RestoreOnReloadFailure bool `mapstructure:"restore_on_reload_failure" desc:"Restore and reload the last backup when NATS fails to reload the new config"`
+		PostReloadConnectCheck struct {
+			Enabled      bool          `mapstructure:"enabled" desc:"Connect as a canary user after each reload"`
+			URL          string        `mapstructure:"url" desc:"NATS URL to connect to"`
+			Username     string        `mapstructure:"username" desc:"Canary user from the generated config"`
+			Password     string        `mapstructure:"password"`
+			PasswordFile string        `mapstructure:"password_file"`
+			Timeout      time.Duration `mapstructure:"timeout" desc:"Connection timeout"`
+			Rollback     bool          `mapstructure:"rollback" desc:"Restore and reload the previous config when the check fails"`
+		} `mapstructure:"post_reload_connect_check" desc:"Confirm a representative user can authenticate after each reload"`
+		SSH struct {
+			Host                  string        `mapstructure:"host"`
+			Port                  int           `mapstructure:"port"`
+			User                  string        `mapstructure:"user"`
+			KeyPath               string        `mapstructure:"key_path"`
+			KnownHostsFile        string        `mapstructure:"known_hosts_file"`
+			InsecureIgnoreHostKey bool          `mapstructure:"insecure_ignore_host_key"`
+			Timeout               time.Duration `mapstructure:"timeout"`
+		} `mapstructure:"ssh" desc:"Remote host, used when reload_mode is ssh"`
+		ForbiddenPatterns []string `mapstructure:"forbidden_patterns" desc:"Subjects no role may grant, e.g. \">\""`
+		ForbiddenAllowlist []string `mapstructure:"forbidden_allowlist" desc:"Roles exempt from forbidden_patterns"`
+		ForbiddenAction string `mapstructure:"forbidden_action" desc:"fail or warn"`
+		MonitoringUser struct {
+			Username     string   `mapstructure:"username"`
+			Password     string   `mapstructure:"password"`
+			PasswordFile string   `mapstructure:"password_file"`
+			Account      string   `mapstructure:"account"`
+			Subscribe    []string `mapstructure:"subscribe"`
+		} `mapstructure:"monitoring_user" desc:"Static read-only user emitted into the system account"`
+		TokenAuth struct {
+			Token     string `mapstructure:"token"`
+			TokenFile string `mapstructure:"token_file"`
+		} `mapstructure:"token_auth" desc:"Shared token every client presents instead of a PocketBase user"`
 		DefaultPermissions struct {
-			Publish   interface{} `mapstructure:"publish"`
-			Subscribe interface{} `mapstructure:"subscribe"`
-		} `mapstructure:"default_permissions"`
+			Publish   interface{} `mapstructure:"publish" desc:"A subject or list of subjects"`
+			Subscribe interface{} `mapstructure:"subscribe" desc:"A subject or list of subjects"`
+		} `mapstructure:"default_permissions" desc:"Permissions for users and roles that grant none"`
 	} `mapstructure:"nats"`
+
+	settings   []Setting       // Effective values and their sources, see Settings
+	datedPaths []*PathTemplate // Config file paths resolved every cycle, see DatedPaths
+}
+
+// StaticUser is a user defined directly in the configuration rather than in PocketBase
+type StaticUser struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Role     string `mapstructure:"role" desc:"Role ID or role name in PocketBase"`
+}
+
+// AccountMapping is a subject mapping defined in the configuration for one account
+type AccountMapping struct {
+	Account string `mapstructure:"account" desc:"Account (normalized role) name"`
+	From    string `mapstructure:"from"`
+	To      string `mapstructure:"to"`
+	Weight  int    `mapstructure:"weight" desc:"Optional percentage for weighted mappings"`
+}
+
+// SigningKey is an account signing key whose issued users are scoped to a role's permissions
+type SigningKey struct {
+	Key         string `mapstructure:"key" desc:"Public account signing key (A...)"`
+	Role        string `mapstructure:"role" desc:"PocketBase role providing the scope template"`
+	Description string `mapstructure:"description"`
+}
+
+// Destination is an additional config file the generated config is written to
+type Destination struct {
+	ConfigFile      string `mapstructure:"config_file"`
+	ConfigBackupDir string `mapstructure:"config_backup_dir"`
+	Name            string `mapstructure:"name" desc:"Label used in logs, defaults to destination-N"`
+	ReloadCommand   string `mapstructure:"reload_command" desc:"Reload this destination's NATS cluster on its own, applied independently of the others"`
+}
+
+// natsVersionPattern matches a NATS server version such as 2.10 or v2.10.22
+var natsVersionPattern = regexp.MustCompile(`^v?\d+\.\d+(\.\d+)?$`)
+
+// subjectPrefixPattern matches literal subject tokens ending in a dot, such as prod. or eu.prod.
+// The trailing dot keeps "prod" from also matching "production.>".
+var subjectPrefixPattern = regexp.MustCompile(`^([^.*>\s]+\.)+$`)
+
+// accountNamePattern matches account names that can be emitted as unquoted config keys
+var accountNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// setDefaults registers the default value of every option that has one
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("app.sync_interval", 60)
+	v.SetDefault("app.log_level", "info")
+	v.SetDefault("app.log_file", "")
+	v.SetDefault("app.initial_delay", 0)
+	v.SetDefault("app.on_empty_password", "allow")
+	v.SetDefault("app.skip_expired_users", true)
+	v.SetDefault("app.expiry_warning", 0)
+	v.SetDefault("app.history_size", 100)
+	v.SetDefault("pocketbase.limit_action", "fail")
+	v.SetDefault("pocketbase.page_size", 100)
+	v.SetDefault("pocketbase.http_timeout", "10s")
+	v.SetDefault("pocketbase.auth_collection", "_superusers")
+	v.SetDefault("pocketbase.access_check", "fail")
+	v.SetDefault("nats.config_backup_dir", "./backups")
+	v.SetDefault("nats.post_generate_timeout", "30s")
+	v.SetDefault("nats.verify_backups_count", 3)
+	v.SetDefault("nats.backup_max_age", "720h")
+	v.SetDefault("nats.output_target", "file")
+	v.SetDefault("nats.consul.address", "http://127.0.0.1:8500")
+	v.SetDefault("nats.output_mode", "authorization")
+	v.SetDefault("nats.subject_prefix_mode", "enforce")
+	v.SetDefault("nats.password_hash_cost", 11)
+	v.SetDefault("nats.duplicate_username_policy", "skip")
+	v.SetDefault("nats.invalid_subject_policy", "skip")
+	v.SetDefault("nats.target_version", "2.10.0")
+	v.SetDefault("nats.schema_version", 1)
+	v.SetDefault("nats.account_order", "name")
+	v.SetDefault("nats.line_ending", "lf")
+	v.SetDefault("nats.secrets_file", "secrets.conf")
+	v.SetDefault("nats.write_concurrency", 4)
+	v.SetDefault("nats.write_failure_policy", "best_effort")
+	v.SetDefault("nats.reload_mode", "local")
+	v.SetDefault("nats.leafnodes.port", 7422)
+	v.SetDefault("nats.post_reload_connect_check.url", "nats://127.0.0.1:4222")
+	v.SetDefault("nats.post_reload_connect_check.timeout", "5s")
+	v.SetDefault("nats.post_reload_connect_check.rollback", true)
+	v.SetDefault("nats.reload_skip_mode", "drop")
+	v.SetDefault("nats.restore_on_reload_failure", true)
+	v.SetDefault("nats.verify_timeout", "5s")
+	v.SetDefault("nats.forbidden_action", "fail")
+	v.SetDefault("nats.monitoring_user.account", "$SYS")
+	v.SetDefault("nats.monitoring_user.subscribe", []string{"$SYS.>"})
+	v.SetDefault("nats.ssh.port", 22)
+	v.SetDefault("nats.ssh.timeout", "10s")
 }
 
 // LoadConfig loads the configuration from config.yaml or environment variables
 func LoadConfig(configPath string, logger *zap.Logger) (*Config, error) {
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
+	// Use a fresh instance so several configs can be loaded in one process
+	v := viper.New()
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
 	
 	// Set default config path if not provided
+	files := configFiles(configPath)
 	if configPath == "" {
-		viper.AddConfigPath(".")
-		viper.AddConfigPath("./config")
-	} else {
-		viper.AddConfigPath(configPath)
+		v.AddConfigPath(".")
+		v.AddConfigPath("./config")
+	} else if !isStdinConfig(configPath) && !isRemoteConfig(configPath) && len(files) == 0 {
+		v.AddConfigPath(configPath)
 	}
 
 	// Read environment variables with the prefix APP_
-	viper.SetEnvPrefix("APP")
-	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-
-	// Set defaults
-	viper.SetDefault("app.sync_interval", 60)
-	viper.SetDefault("app.log_level", "info")
-	viper.SetDefault("app.log_file", "")
-	viper.SetDefault("nats.config_backup_dir", "./backups")
-
-	// Read config file
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			logger.Warn("Config file not found, using defaults and environment variables")
-		} else {
+	v.SetEnvPrefix("APP")
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+
+	setDefaults(v)
+
+	// Read config from stdin, a URL, a list of files merged in order, or a config directory
+	sources := make(map[string]string)
+	switch {
+	case isStdinConfig(configPath):
+		if err := v.ReadConfig(os.Stdin); err != nil {
+			return nil, fmt.Errorf("failed to read config from stdin: %w", err)
+		}
+		recordSources(v, sources, "stdin")
+	case isRemoteConfig(configPath):
+		data, err := fetchRemoteConfig(configPath, os.Getenv(configAuthorizationEnv))
+		if err != nil {
+			return nil, err
+		}
+		if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("failed to parse remote config: %w", err)
+		}
+		recordSources(v, sources, configPath)
+	case len(files) > 0:
+		if err := readConfigFiles(v, files, sources); err != nil {
 			return nil, err
 		}
+	default:
+		if err := v.ReadInConfig(); err != nil {
+			if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+				logger.Warn("Config file not found, using defaults and environment variables")
+			} else {
+				return nil, err
+			}
+		}
+		recordSources(v, sources, v.ConfigFileUsed())
 	}
 
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
+	cfg.settings = effectiveSettings(v, sources)
+
+	// Read secrets from files when configured
+	if cfg.PocketBase.AdminPasswordFile != "" {
+		password, err := secrets.ReadFile(cfg.PocketBase.AdminPasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.PocketBase.AdminPassword = password
+	}
+
+	if cfg.PocketBase.FieldKeyFile != "" {
+		key, err := secrets.ReadFile(cfg.PocketBase.FieldKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.PocketBase.FieldKey = key
+	}
+
+	if cfg.NATS.MonitoringUser.PasswordFile != "" {
+		password, err := secrets.ReadFile(cfg.NATS.MonitoringUser.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.NATS.MonitoringUser.Password = password
+	}
+
+	if cfg.NATS.PostReloadConnectCheck.PasswordFile != "" {
+		password, err := secrets.ReadFile(cfg.NATS.PostReloadConnectCheck.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.NATS.PostReloadConnectCheck.Password = password
+	}
+
+	if cfg.NATS.Consul.TokenFile != "" {
+		token, err := secrets.ReadFile(cfg.NATS.Consul.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.NATS.Consul.Token = token
+	}
+
+	if cfg.NATS.TokenAuth.TokenFile != "" {
+		token, err := secrets.ReadFile(cfg.NATS.TokenAuth.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.NATS.TokenAuth.Token = token
+	}
+
+	// Validate record caps
+	if cfg.PocketBase.AuthRetryTimeout < 0 {
+		return nil, fmt.Errorf("pocketbase.auth_retry_timeout must not be negative")
+	}
+	if cfg.PocketBase.HTTPTimeout <= 0 {
+		return nil, fmt.Errorf("pocketbase.http_timeout must be positive")
+	}
+	if cfg.PocketBase.PageSize < 1 {
+		return nil, fmt.Errorf("pocketbase.page_size must be at least 1")
+	}
+	if cfg.PocketBase.MaxUsers < 0 || cfg.PocketBase.MaxRoles < 0 {
+		return nil, fmt.Errorf("pocketbase.max_users and pocketbase.max_roles must not be negative")
+	}
+	if h := cfg.PocketBase.HTTP; h.MaxIdleConns < 0 || h.MaxIdleConnsPerHost < 0 || h.MaxConnsPerHost < 0 || h.IdleConnTimeout < 0 {
+		return nil, fmt.Errorf("pocketbase.http settings must not be negative")
+	}
+	if cfg.PocketBase.LimitAction != "fail" && cfg.PocketBase.LimitAction != "truncate" {
+		return nil, fmt.Errorf("invalid pocketbase.limit_action %q: must be fail or truncate", cfg.PocketBase.LimitAction)
+	}
+	switch cfg.PocketBase.AccessCheck {
+	case "fail", "warn", "off":
+	default:
+		return nil, fmt.Errorf("invalid pocketbase.access_check %q: must be fail, warn or off", cfg.PocketBase.AccessCheck)
+	}
+
+	// Validate secrets file
+	if cfg.NATS.SplitSecrets {
+		if len(cfg.NATS.Destinations) > 0 {
+			return nil, fmt.Errorf("nats.split_secrets cannot be combined with nats.destinations")
+		}
+		if cfg.NATS.SecretsFile == "" || filepath.Base(cfg.NATS.SecretsFile) != cfg.NATS.SecretsFile {
+			return nil, fmt.Errorf("nats.secrets_file must be a file name without a directory")
+		}
+	}
+
+	// Validate credentials output
+	if cfg.NATS.WriteCreds && cfg.NATS.CredsDir == "" {
+		return nil, fmt.Errorf("nats.creds_dir is required when nats.write_creds is enabled")
+	}
+
+	// Validate empty password handling
+	switch cfg.App.OnEmptyPassword {
+	case "allow", "skip", "fail":
+	default:
+		return nil, fmt.Errorf("invalid app.on_empty_password %q: must be allow, skip or fail", cfg.App.OnEmptyPassword)
+	}
+
+	if cfg.NATS.Leafnodes.Enabled && (cfg.NATS.Leafnodes.Port < 1 || cfg.NATS.Leafnodes.Port > 65535) {
+		return nil, fmt.Errorf("invalid nats.leafnodes.port %d", cfg.NATS.Leafnodes.Port)
+	}
+	if cc := cfg.NATS.PostReloadConnectCheck; cc.Enabled {
+		if cc.URL == "" || cc.Username == "" || cc.Password == "" {
+			return nil, fmt.Errorf("nats.post_reload_connect_check requires url, username and password or password_file")
+		}
+		if cc.Timeout <= 0 {
+			return nil, fmt.Errorf("nats.post_reload_connect_check.timeout must be positive")
+		}
+		if cfg.NATS.OutputTarget != "file" {
+			return nil, fmt.Errorf("nats.post_reload_connect_check requires nats.output_target file")
+		}
+	}
+	if cfg.NATS.MaxReloadsPerHour < 0 {
+		return nil, fmt.Errorf("nats.max_reloads_per_hour must not be negative")
+	}
+	if cfg.App.ExpiryWarning < 0 {
+		return nil, fmt.Errorf("app.expiry_warning must not be negative")
+	}
+
+	// Validate initial delay
+	if cfg.App.InitialDelay < 0 {
+		return nil, fmt.Errorf("app.initial_delay must not be negative")
+	}
+	if cfg.App.HistorySize < 0 {
+		return nil, fmt.Errorf("app.history_size must not be negative")
+	}
+	if cfg.App.MaxStaleDuration < 0 {
+		return nil, fmt.Errorf("app.max_stale_duration must not be negative")
+	}
+
+	// Validate monitoring user
+	if mu := cfg.NATS.MonitoringUser; mu.Username != "" && (mu.Password == "" || mu.Account == "") {
+		return nil, fmt.Errorf("nats.monitoring_user requires a password and account")
+	}
+
+	// Validate version record
+	if vr := cfg.PocketBase.VersionRecord; vr.Collection != "" && (vr.ID == "" || vr.Field == "") {
+		return nil, fmt.Errorf("pocketbase.version_record requires collection, id and field")
+	}
+
+	// Validate output target
+	if len(cfg.NATS.Resolver.SigningKeys) > 0 && cfg.NATS.OutputTarget != "resolver" {
+		return nil, fmt.Errorf("nats.resolver.signing_keys requires nats.output_target resolver")
+	}
+	switch cfg.NATS.OutputTarget {
+	case "file":
+	case "resolver":
+		r := cfg.NATS.Resolver
+		if r.URL == "" || r.OperatorSigningKeyFile == "" || r.AccountSeedFile == "" || r.AccountName == "" {
+			return nil, fmt.Errorf("nats.resolver url, operator_signing_key_file, account_seed_file and account_name are required when nats.output_target is resolver")
+		}
+	case "consul":
+		if cfg.NATS.Consul.Key == "" {
+			return nil, fmt.Errorf("nats.consul.key is required when nats.output_target is consul")
+		}
+		if cfg.NATS.SplitByAccount || cfg.NATS.SplitSecrets || len(cfg.NATS.Destinations) > 0 {
+			return nil, fmt.Errorf("nats.output_target consul cannot be combined with split_by_account, split_secrets or destinations")
+		}
+	default:
+		return nil, fmt.Errorf("invalid nats.output_target %q: must be file, resolver or consul", cfg.NATS.OutputTarget)
+	}
+
+	// Validate output mode
+	if cfg.NATS.OutputMode != "authorization" && cfg.NATS.OutputMode != "accounts" {
+		return nil, fmt.Errorf("invalid nats.output_mode %q: must be authorization or accounts", cfg.NATS.OutputMode)
+	}
+	if len(cfg.NATS.Mappings) > 0 && cfg.NATS.OutputMode != "accounts" {
+		return nil, fmt.Errorf("nats.mappings requires nats.output_mode accounts")
+	}
+	if cfg.NATS.SystemAccount != "" && cfg.NATS.OutputMode != "accounts" {
+		return nil, fmt.Errorf("nats.system_account requires nats.output_mode accounts")
+	}
+	if !natsVersionPattern.MatchString(cfg.NATS.TargetVersion) {
+		return nil, fmt.Errorf("invalid nats.target_version %q: must be MAJOR.MINOR or MAJOR.MINOR.PATCH", cfg.NATS.TargetVersion)
+	}
+	if cfg.NATS.AccountOrder != "name" && cfg.NATS.AccountOrder != "priority" {
+		return nil, fmt.Errorf("invalid nats.account_order %q: must be name or priority", cfg.NATS.AccountOrder)
+	}
+	if (cfg.NATS.AccountOrder == "priority" || cfg.NATS.GroupAccounts) && cfg.NATS.OutputMode != "accounts" {
+		return nil, fmt.Errorf("nats.account_order priority and nats.group_accounts require nats.output_mode accounts")
+	}
+	if cfg.NATS.SubjectPrefixMode != "enforce" && cfg.NATS.SubjectPrefixMode != "auto" {
+		return nil, fmt.Errorf("invalid nats.subject_prefix_mode %q: must be enforce or auto", cfg.NATS.SubjectPrefixMode)
+	}
+	if cfg.NATS.DuplicateUsernamePolicy != "skip" && cfg.NATS.DuplicateUsernamePolicy != "error" {
+		return nil, fmt.Errorf("invalid nats.duplicate_username_policy %q: must be skip or error", cfg.NATS.DuplicateUsernamePolicy)
+	}
+	if cfg.NATS.InvalidSubjectPolicy != "skip" && cfg.NATS.InvalidSubjectPolicy != "error" {
+		return nil, fmt.Errorf("invalid nats.invalid_subject_policy %q: must be skip or error", cfg.NATS.InvalidSubjectPolicy)
+	}
+	if cfg.NATS.HashPasswords && (cfg.NATS.PasswordHashCost < bcrypt.MinCost || cfg.NATS.PasswordHashCost > bcrypt.MaxCost) {
+		return nil, fmt.Errorf("nats.password_hash_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if prefix := cfg.NATS.SubjectPrefix; prefix != "" && !subjectPrefixPattern.MatchString(prefix) {
+		return nil, fmt.Errorf("invalid nats.subject_prefix %q: must be one or more literal tokens ending in '.', e.g. prod.", prefix)
+	}
+	if wrap := cfg.NATS.WrapInAccount; wrap != "" {
+		if cfg.NATS.OutputMode != "authorization" {
+			return nil, fmt.Errorf("nats.wrap_in_account requires nats.output_mode authorization")
+		}
+		if !accountNamePattern.MatchString(wrap) {
+			return nil, fmt.Errorf("invalid nats.wrap_in_account %q: use letters, digits, '_' and '-' only", wrap)
+		}
+		if wrap == cfg.NATS.MonitoringUser.Account {
+			return nil, fmt.Errorf("nats.wrap_in_account must differ from nats.monitoring_user.account")
+		}
+	}
+	if token := cfg.NATS.TokenAuth.Token; token != "" {
+		if strings.ContainsAny(token, " \t\r\n\"\\") {
+			return nil, fmt.Errorf("nats.token_auth.token must not contain whitespace, quotes or backslashes")
+		}
+		// NATS rejects a token next to a users array or accounts
+		for _, conflict := range []struct {
+			set  bool
+			name string
+		}{
+			{cfg.NATS.OutputMode != "authorization", "nats.output_mode accounts"},
+			{cfg.NATS.WrapInAccount != "", "nats.wrap_in_account"},
+			{cfg.NATS.MonitoringUser.Username != "", "nats.monitoring_user"},
+			{cfg.NATS.OutputTarget == "resolver", "nats.output_target resolver"},
+			{len(cfg.App.ForceIncludeUsers) > 0, "app.force_include_users"},
+			{cfg.NATS.WriteCreds, "nats.write_creds"},
+			{cfg.NATS.Leafnodes.Enabled, "nats.leafnodes"},
+			{cfg.NATS.PostReloadConnectCheck.Enabled, "nats.post_reload_connect_check"},
+		} {
+			if conflict.set {
+				return nil, fmt.Errorf("nats.token_auth cannot be combined with %s", conflict.name)
+			}
+		}
+	}
+	if cfg.NATS.PostGenerateCommand != "" {
+		if cfg.NATS.PostGenerateTimeout <= 0 {
+			return nil, fmt.Errorf("nats.post_generate_timeout must be positive")
+		}
+		if cfg.NATS.OutputTarget == "resolver" {
+			return nil, fmt.Errorf("nats.post_generate_command cannot be combined with nats.output_target resolver")
+		}
+	}
+	if cfg.NATS.SchemaMarker {
+		if cfg.NATS.SchemaVersion < 1 {
+			return nil, fmt.Errorf("nats.schema_version must be at least 1")
+		}
+		if cfg.NATS.OutputTarget == "resolver" {
+			return nil, fmt.Errorf("nats.schema_marker cannot be combined with nats.output_target resolver")
+		}
+
+	}
+	for _, mapping := range cfg.NATS.Mappings {
+		if mapping.Account == "" || mapping.From == "" || mapping.To == "" {
+			return nil, fmt.Errorf("nats.mappings entries require account, from and to")
+		}
+	}
+	if cfg.NATS.SplitByAccount {
+		if cfg.NATS.OutputMode != "accounts" {
+			return nil, fmt.Errorf("nats.split_by_account requires nats.output_mode accounts")
+		}
+		if len(cfg.NATS.Destinations) > 0 {
+			return nil, fmt.Errorf("nats.split_by_account cannot be combined with nats.destinations")
+		}
+	}
+
+	// Validate destinations
+	for i, dest := range cfg.NATS.Destinations {
+		if dest.ConfigFile == "" {
+			return nil, fmt.Errorf("nats.destinations[%d].config_file is required", i)
+		}
+		if dest.ConfigBackupDir == "" {
+			cfg.NATS.Destinations[i].ConfigBackupDir = filepath.Join(cfg.NATS.ConfigBackupDir, fmt.Sprintf("destination-%d", i+1))
+		}
+		if dest.Name == "" {
+			cfg.NATS.Destinations[i].Name = fmt.Sprintf("destination-%d", i+1)
+		}
+	}
+
+	// Expand templated config file paths
+	if err := cfg.resolvePaths(time.Now()); err != nil {
+		return nil, err
+	}
+	for _, tmpl := range cfg.datedPaths {
+		if tmpl != nil && (cfg.NATS.SplitByAccount || cfg.NATS.SplitSecrets) {
+			return nil, fmt.Errorf("a dated nats.config_file cannot be combined with nats.split_by_account or nats.split_secrets")
+		}
+	}
+
+	if cfg.NATS.WriteFailurePolicy != "fail_fast" && cfg.NATS.WriteFailurePolicy != "best_effort" {
+		return nil, fmt.Errorf("invalid nats.write_failure_policy %q: must be fail_fast or best_effort", cfg.NATS.WriteFailurePolicy)
+	}
+
+	// Validate the config validation command; strict apply needs one, so it falls back to nats-server
+	if cfg.App.StrictApply && cfg.NATS.ValidateCommand == "" {
+		cfg.NATS.ValidateCommand = DefaultValidateCommand
+	}
+	if cfg.NATS.ValidateCommand != "" && !strings.Contains(cfg.NATS.ValidateCommand, "{config}") {
+		return nil, fmt.Errorf("nats.validate_command must contain {config}")
+	}
+
+	// Validate strict apply
+	if cfg.App.StrictApply {
+		if cfg.NATS.OutputTarget != "file" {
+			return nil, fmt.Errorf("app.strict_apply requires nats.output_target file")
+		}
+		if cfg.NATS.SplitByAccount || cfg.NATS.SplitSecrets {
+			return nil, fmt.Errorf("app.strict_apply cannot be combined with nats.split_by_account or nats.split_secrets")
+		}
+	}
+
+	// Validate reload windows
+	for i, window := range cfg.App.ReloadWindows {
+		if _, _, _, err := window.Parse(); err != nil {
+			return nil, fmt.Errorf("app.reload_windows[%d]: %w", i, err)
+		}
+	}
+	if cfg.App.ReloadTimezone != "" {
+		if _, err := time.LoadLocation(cfg.App.ReloadTimezone); err != nil {
+			return nil, fmt.Errorf("invalid app.reload_timezone %q: %w", cfg.App.ReloadTimezone, err)
+		}
+	}
+
+	// Validate startup reconciliation
+	if cfg.App.StartupReconcile && cfg.NATS.OutputTarget != "file" {
+		return nil, fmt.Errorf("app.startup_reconcile requires nats.output_target file")
+	}
+
+	// Validate backup verification
+	if cfg.NATS.VerifyBackupsInterval < 0 {
+		return nil, fmt.Errorf("nats.verify_backups_interval must not be negative")
+	}
+	if cfg.NATS.VerifyBackupsInterval > 0 && cfg.NATS.VerifyBackupsCount < 1 {
+		return nil, fmt.Errorf("nats.verify_backups_count must be at least 1")
+	}
+
+	// Validate backup retention
+	if cfg.NATS.BackupMaxAge < 0 {
+		return nil, fmt.Errorf("nats.backup_max_age must not be negative")
+	}
+	if cfg.NATS.BackupRetentionCount < 0 {
+		return nil, fmt.Errorf("nats.backup_retention_count must not be negative")
+	}
+
+	// Validate line ending
+	if cfg.NATS.LineEnding != "lf" && cfg.NATS.LineEnding != "crlf" {
+		return nil, fmt.Errorf("invalid nats.line_ending %q: must be lf or crlf", cfg.NATS.LineEnding)
+	}
+
+	// Validate forbidden permission action
+	if cfg.NATS.ForbiddenAction != "fail" && cfg.NATS.ForbiddenAction != "warn" {
+		return nil, fmt.Errorf("invalid nats.forbidden_action %q: must be fail or warn", cfg.NATS.ForbiddenAction)
+	}
+
+	// Validate reload skip mode
+	if cfg.NATS.ReloadSkipMode != "drop" && cfg.NATS.ReloadSkipMode != "defer" {
+		return nil, fmt.Errorf("invalid nats.reload_skip_mode %q: must be drop or defer", cfg.NATS.ReloadSkipMode)
+	}
+
+	// Validate reload mode
+	switch cfg.NATS.ReloadMode {
+	case "local":
+	case "ssh":
+		if cfg.NATS.SSH.Host == "" || cfg.NATS.SSH.User == "" || cfg.NATS.SSH.KeyPath == "" {
+			return nil, fmt.Errorf("nats.ssh.host, nats.ssh.user and nats.ssh.key_path are required when nats.reload_mode is ssh")
+		}
+	default:
+		return nil, fmt.Errorf("invalid nats.reload_mode %q: must be local or ssh", cfg.NATS.ReloadMode)
+	}
 
 	// Ensure backup directory exists
 	if _, err := os.Stat(cfg.NATS.ConfigBackupDir); os.IsNotExist(err) {
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Sources reported for values that do not come from a config file
+const (
+	sourceDefault = "default"
+	sourceEnvPfx  = "env "
+)
+
+// Setting is one effective configuration value and where it came from
+type Setting struct {
+	Key    string
+	Value  interface{}
+	Source string // Config file, stdin, URL, "env APP_..." or "default"
+}
+
+// configFiles returns the files to merge when configPath lists files rather than a
+// directory: either several comma-separated paths or a single regular file
+func configFiles(configPath string) []string {
+	if strings.Contains(configPath, ",") {
+		var files []string
+		for _, file := range strings.Split(configPath, ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				files = append(files, file)
+			}
+		}
+		return files
+	}
+	if info, err := os.Stat(configPath); err == nil && info.Mode().IsRegular() {
+		return []string{configPath}
+	}
+	return nil
+}
+
+// readConfigFiles merges the files into v left to right, so later files override
+// earlier ones, and records which file each key came from
+func readConfigFiles(v *viper.Viper, files []string, sources map[string]string) error {
+	for _, file := range files {
+		if isStdinConfig(file) || isRemoteConfig(file) {
+			return fmt.Errorf("config %s: only files can be layered", file)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("config file %s: %w", file, err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("config %s: only files can be layered, not directories", file)
+		}
+
+		layer := viper.New()
+		layer.SetConfigFile(file)
+		if err := layer.ReadInConfig(); err != nil {
+			return fmt.Errorf("failed to read config file %s: %w", file, err)
+		}
+		if err := v.MergeConfigMap(layer.AllSettings()); err != nil {
+			return fmt.Errorf("failed to merge config file %s: %w", file, err)
+		}
+		for _, key := range layer.AllKeys() {
+			sources[key] = file
+		}
+	}
+	return nil
+}
+
+// recordSources attributes every key set by the config that was read to source
+func recordSources(v *viper.Viper, sources map[string]string, source string) {
+	for _, key := range v.AllKeys() {
+		if v.InConfig(key) {
+			sources[key] = source
+		}
+	}
+}
+
+// effectiveSettings lists every known key with its final value and source
+func effectiveSettings(v *viper.Viper, sources map[string]string) []Setting {
+	keys := v.AllKeys()
+	sort.Strings(keys)
+
+	settings := make([]Setting, 0, len(keys))
+	for _, key := range keys {
+		source, ok := sources[key]
+		if !ok {
+			source = sourceDefault
+		}
+		if env := envVarName(key); os.Getenv(env) != "" {
+			source = sourceEnvPfx + env
+		}
+		settings = append(settings, Setting{Key: key, Value: v.Get(key), Source: source})
+	}
+	return settings
+}
+
+// envVarName is the environment variable that overrides a key
+func envVarName(key string) string {
+	return "APP_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Settings returns the effective configuration values and their sources
+func (c *Config) Settings() []Setting {
+	return c.settings
+}
+
+// WriteSettings prints each effective value with the file, environment variable or
+// default it came from. Secrets are redacted.
+func (c *Config) WriteSettings(w io.Writer) error {
+	var b strings.Builder
+	for _, setting := range c.settings {
+		value := fmt.Sprint(redact(setting.Key, setting.Value))
+		fmt.Fprintf(&b, "%s = %s  # %s\n", setting.Key, value, setting.Source)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// redact replaces credentials in a value, including inside list entries such as
+// force_include_users
+func redact(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			redacted[k] = redact(k, item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redact(key, item)
+		}
+		return redacted
+	}
+	if isSecretKey(key) && fmt.Sprint(value) != "" {
+		return "<redacted>"
+	}
+	return value
+}
+
+// isSecretKey reports whether a key holds a credential that must not be printed
+func isSecretKey(key string) bool {
+	name := key[strings.LastIndex(key, ".")+1:]
+	return strings.Contains(name, "password") && !strings.HasSuffix(name, "_file") ||
+		name == "token" || name == "field_key"
+}
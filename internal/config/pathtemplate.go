@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PathDateFormat is the layout of {{.Date}} in templated config file paths
+const PathDateFormat = "2006-01-02"
+
+// PathTemplate is a config file path with {{.Env.NAME}} and {{.Date}} substitutions.
+// Environment variables are read once, when the template is parsed.
+type PathTemplate struct {
+	raw   string
+	tmpl  *template.Template
+	env   map[string]string
+	dated bool
+}
+
+// pathData is the data available to a path template
+type pathData struct {
+	Env  map[string]string
+	Date string // Current UTC date, see PathDateFormat
+}
+
+// ParsePathTemplate parses a config file path. A missing environment variable is an error.
+func ParsePathTemplate(raw string) (*PathTemplate, error) {
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template %q: %w", raw, err)
+	}
+
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			env[name] = value
+		}
+	}
+	p := &PathTemplate{raw: raw, tmpl: tmpl, env: env}
+
+	// A path is dated when two different days resolve to different paths
+	first, err := p.Resolve(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return nil, err
+	}
+	second, err := p.Resolve(time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return nil, err
+	}
+	p.dated = first != second
+	return p, nil
+}
+
+// Resolve renders the path for the given time
+func (p *PathTemplate) Resolve(now time.Time) (string, error) {
+	var sb strings.Builder
+	data := pathData{Env: p.env, Date: now.UTC().Format(PathDateFormat)}
+	if err := p.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to resolve path template %q: %w", p.raw, err)
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("path template %q resolved to an empty path", p.raw)
+	}
+	return sb.String(), nil
+}
+
+// Dated reports whether the path contains the date and must be resolved every cycle
+func (p *PathTemplate) Dated() bool {
+	return p.dated
+}
+
+// DatedPaths returns the templates of config files whose path contains {{.Date}}: the
+// primary config file first, then one entry per destination. Entries are nil for
+// paths that do not change over time.
+func (c *Config) DatedPaths() []*PathTemplate {
+	return c.datedPaths
+}
+
+// ConfigFiles returns the primary config file followed by each destination's config file,
+// in the same order as DatedPaths
+func (c *Config) ConfigFiles() []string {
+	files := []string{c.NATS.ConfigFile}
+	for _, dest := range c.NATS.Destinations {
+		files = append(files, dest.ConfigFile)
+	}
+	return files
+}
+
+// resolvePaths expands the config file and destination path templates at startup
+// and records the ones that must be resolved again every cycle
+func (c *Config) resolvePaths(now time.Time) error {
+	paths := []*string{&c.NATS.ConfigFile}
+	for i := range c.NATS.Destinations {
+		paths = append(paths, &c.NATS.Destinations[i].ConfigFile)
+	}
+
+	c.datedPaths = make([]*PathTemplate, len(paths))
+	for i, path := range paths {
+		if !strings.Contains(*path, "{{") {
+			continue
+		}
+		tmpl, err := ParsePathTemplate(*path)
+		if err != nil {
+			return err
+		}
+		if *path, err = tmpl.Resolve(now); err != nil {
+			return err
+		}
+		if tmpl.Dated() {
+			c.datedPaths[i] = tmpl
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// WriteSample writes a config.yaml listing every option with its default value,
+// documented from the desc struct tags, so the sample stays in sync with Config
+func WriteSample(w io.Writer) error {
+	v := viper.New()
+	setDefaults(v)
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return fmt.Errorf("failed to apply defaults: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("# nats-pocketbase-sync configuration\n")
+	b.WriteString("# Every option is listed with its default value.\n")
+	writeSampleStruct(&b, reflect.ValueOf(cfg), 0)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeSampleStruct writes the options of a config section at the given depth
+func writeSampleStruct(b *strings.Builder, value reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+
+		if depth == 0 {
+			b.WriteString("\n")
+		}
+		if desc := field.Tag.Get("desc"); desc != "" {
+			fmt.Fprintf(b, "%s# %s\n", indent, desc)
+		}
+
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			fmt.Fprintf(b, "%s%s:\n", indent, key)
+			writeSampleStruct(b, value.Field(i), depth+1)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			fmt.Fprintf(b, "%s# Entries have: %s\n", indent, sampleElementFields(field.Type.Elem()))
+			fmt.Fprintf(b, "%s%s: []\n", indent, key)
+		default:
+			fmt.Fprintf(b, "%s%s: %s\n", indent, key, formatSampleValue(value.Field(i)))
+		}
+	}
+}
+
+// sampleElementFields describes the fields of a list entry
+func sampleElementFields(t reflect.Type) string {
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if desc := field.Tag.Get("desc"); desc != "" {
+			name += " (" + desc + ")"
+		}
+		fields = append(fields, name)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// formatSampleValue formats a default value as YAML
+func formatSampleValue(value reflect.Value) string {
+	if value.Type() == durationType {
+		return strconv.Quote(time.Duration(value.Int()).String())
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return strconv.Quote(value.String())
+	case reflect.Slice:
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = formatSampleValue(value.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Interface:
+		if value.IsNil() {
+			return "null"
+		}
+		return formatSampleValue(value.Elem())
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
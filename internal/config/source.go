@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// configAuthorizationEnv holds an optional Authorization header value for remote config
+const configAuthorizationEnv = "APP_CONFIG_AUTHORIZATION"
+
+// maxRemoteConfigSize limits how much is read from a remote config URL
+const maxRemoteConfigSize = 1 << 20
+
+// isStdinConfig reports whether the config should be read from stdin
+func isStdinConfig(configPath string) bool {
+	return configPath == "-"
+}
+
+// isRemoteConfig reports whether the config path is an HTTP(S) URL
+func isRemoteConfig(configPath string) bool {
+	return strings.HasPrefix(configPath, "http://") || strings.HasPrefix(configPath, "https://")
+}
+
+// fetchRemoteConfig downloads the YAML config from a URL
+func fetchRemoteConfig(url, authorization string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config request: %w", err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch config: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config response: %w", err)
+	}
+	if len(data) > maxRemoteConfigSize {
+		return nil, fmt.Errorf("remote config is larger than %d bytes", maxRemoteConfigSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReloadWindow is a recurring period during which NATS may be reloaded
+type ReloadWindow struct {
+	Days  []string `mapstructure:"days" desc:"Weekdays the window opens on, e.g. [mon, tue], every day when empty"`
+	Start string   `mapstructure:"start" desc:"Opening time, HH:MM"`
+	End   string   `mapstructure:"end" desc:"Closing time, HH:MM, before start for windows past midnight"`
+}
+
+// weekdays maps accepted day names to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// Parse returns the window's weekdays and its start and end as offsets from midnight
+func (w ReloadWindow) Parse() ([]time.Weekday, time.Duration, time.Duration, error) {
+	var days []time.Weekday
+	for _, name := range w.Days {
+		day, ok := weekdays[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, 0, 0, fmt.Errorf("unknown day %q", name)
+		}
+		days = append(days, day)
+	}
+
+	start, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid start: %w", err)
+	}
+	end, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid end: %w", err)
+	}
+	if start == end {
+		return nil, 0, 0, fmt.Errorf("start and end must differ")
+	}
+	return days, start, end, nil
+}
+
+// parseTimeOfDay parses HH:MM into an offset from midnight. 24:00 is accepted as an end.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", value)
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("%q is not a time of day", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
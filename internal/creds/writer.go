@@ -0,0 +1,177 @@
+package creds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// FileSuffix is the extension of generated credential files
+const FileSuffix = ".json"
+
+// unsafeFileChars matches characters not allowed in a credential file name
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._@-]`)
+
+// Context is a per-user credential file in the NATS CLI context format
+type Context struct {
+	Description string `json:"description"`
+	URL         string `json:"url,omitempty"`
+	User        string `json:"user"`
+	Password    string `json:"password"`
+}
+
+// Writer writes one credential file per generated user for distribution to clients
+type Writer struct {
+	dir    string
+	url    string
+	users  []models.NatsUser
+	logger *zap.Logger
+}
+
+// NewWriter creates a new credential Writer. The server URL is included in every file when set.
+func NewWriter(dir, serverURL string, logger *zap.Logger) *Writer {
+	return &Writer{
+		dir:    dir,
+		url:    serverURL,
+		logger: logger,
+	}
+}
+
+// Capture records the users of a generated config. It is registered as a
+// generator transform and leaves the config data unchanged.
+func (w *Writer) Capture(data *models.NatsConfigData) error {
+	w.users = append([]models.NatsUser(nil), data.Users...)
+	return nil
+}
+
+// FileName returns the credential file name for a username
+func FileName(username string) string {
+	return unsafeFileChars.ReplaceAllString(username, "_") + FileSuffix
+}
+
+// Write writes a credential file for every captured user and removes files for users
+// that no longer exist. Unchanged files are left untouched.
+func (w *Writer) Write() error {
+	if err := os.MkdirAll(w.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create credentials directory: %w", err)
+	}
+
+	current := make(map[string]bool, len(w.users))
+	written := 0
+	for _, user := range w.users {
+		// Nkey users sign in with their seed, which is never known here
+		if user.NKey != "" {
+			w.logger.Debug("User authenticates with an nkey, skipping credentials file", zap.String("username", user.Name))
+			continue
+		}
+
+		// A bcrypt hash is only usable by the server, clients need the plaintext
+		password := user.Password
+		if user.ClientPassword != "" {
+			password = user.ClientPassword
+		}
+		if strings.HasPrefix(password, "$2") {
+			w.logger.Debug("Password is a bcrypt hash, skipping credentials file", zap.String("username", user.Name))
+			continue
+		}
+
+		name := FileName(user.Name)
+		if current[name] {
+			w.logger.Warn("Credential file name collision, skipping user", zap.String("username", user.Name))
+			continue
+		}
+		current[name] = true
+
+		content, err := json.MarshalIndent(Context{
+			Description: "NATS credentials for " + user.Name,
+			URL:         w.url,
+			User:        user.Name,
+			Password:    password,
+		}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode credentials for %s: %w", user.Name, err)
+		}
+		content = append(content, '\n')
+
+		changed, err := w.writeFile(filepath.Join(w.dir, name), content)
+		if err != nil {
+			return fmt.Errorf("failed to write credentials for %s: %w", user.Name, err)
+		}
+		if changed {
+			written++
+		}
+	}
+
+	removed, err := w.removeStale(current)
+	if err != nil {
+		return err
+	}
+
+	if written > 0 || removed > 0 {
+		w.logger.Info("Updated credential files",
+			zap.String("dir", w.dir),
+			zap.Int("written", written),
+			zap.Int("removed", removed))
+	}
+	return nil
+}
+
+// writeFile atomically replaces path with content unless it already matches
+func (w *Writer) writeFile(path string, content []byte) (bool, error) {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, content) {
+		return false, nil
+	}
+
+	tempFile, err := os.CreateTemp(w.dir, "creds-*.tmp")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempFilePath := tempFile.Name()
+	defer os.Remove(tempFilePath)
+
+	// CreateTemp already uses 0600, but be explicit about the restriction
+	if err := tempFile.Chmod(0600); err != nil {
+		tempFile.Close()
+		return false, fmt.Errorf("failed to set temp file permissions: %w", err)
+	}
+	if _, err := tempFile.Write(content); err != nil {
+		tempFile.Close()
+		return false, fmt.Errorf("failed to write to temp file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return false, fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tempFilePath, path); err != nil {
+		return false, fmt.Errorf("failed to replace credentials file: %w", err)
+	}
+	return true, nil
+}
+
+// removeStale removes credential files for users that are no longer generated
+func (w *Writer) removeStale(current map[string]bool) (int, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read credentials directory: %w", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), FileSuffix) || current[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(w.dir, entry.Name())); err != nil {
+			return removed, fmt.Errorf("failed to remove stale credentials file: %w", err)
+		}
+		w.logger.Debug("Removed credentials for deleted user", zap.String("file", entry.Name()))
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,236 @@
+package drift
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"nats-pocketbase-sync/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// Report lists how the config on disk differs from the one PocketBase would produce.
+// Roles in authorization mode and accounts in accounts mode are both reported as roles.
+type Report struct {
+	RolesOnlyOnDisk       []string
+	RolesOnlyInPocketBase []string
+	UsersOnlyOnDisk       []string
+	UsersOnlyInPocketBase []string
+	PasswordChanged       []string // Users whose password differs, values are never reported
+	AccountChanged        []string // Users that moved between accounts, as "user: FROM -> TO"
+}
+
+// Empty reports whether no drift was found
+func (r *Report) Empty() bool {
+	return len(r.RolesOnlyOnDisk) == 0 && len(r.RolesOnlyInPocketBase) == 0 &&
+		len(r.UsersOnlyOnDisk) == 0 && len(r.UsersOnlyInPocketBase) == 0 &&
+		len(r.PasswordChanged) == 0 && len(r.AccountChanged) == 0
+}
+
+// Log writes the report as a single warning, or an info line when there is no drift
+func (r *Report) Log(logger *zap.Logger) {
+	if r.Empty() {
+		logger.Info("No drift between the config on disk and PocketBase")
+		return
+	}
+	logger.Warn("Config on disk has drifted from PocketBase, the first sync will change it",
+		zap.Strings("roles_only_on_disk", r.RolesOnlyOnDisk),
+		zap.Strings("roles_only_in_pocketbase", r.RolesOnlyInPocketBase),
+		zap.Strings("users_only_on_disk", r.UsersOnlyOnDisk),
+		zap.Strings("users_only_in_pocketbase", r.UsersOnlyInPocketBase),
+		zap.Strings("password_changed", r.PasswordChanged),
+		zap.Strings("account_changed", r.AccountChanged))
+}
+
+// user is a user as seen in one of the two configs. Account is empty in authorization mode.
+type user struct {
+	account  string
+	password string
+}
+
+// snapshot holds the role (or account) names and users of one config
+type snapshot struct {
+	roles map[string]bool
+	users map[string]user
+}
+
+// Compare parses the config at path, following its includes, and compares it with the
+// config data generated from PocketBase. A missing file counts as an empty config.
+func Compare(path string, data *models.NatsConfigData) (*Report, error) {
+	disk := snapshot{roles: map[string]bool{}, users: map[string]user{}}
+	if _, err := os.Stat(path); err == nil {
+		parsed, err := parseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config on disk: %w", err)
+		}
+		disk = parseSnapshot(parsed)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to stat config on disk: %w", err)
+	}
+
+	generated := generatedSnapshot(data)
+	report := &Report{
+		RolesOnlyOnDisk:       missing(disk.roles, generated.roles),
+		RolesOnlyInPocketBase: missing(generated.roles, disk.roles),
+	}
+	for _, name := range sortedUsers(disk.users) {
+		if _, ok := generated.users[name]; !ok {
+			report.UsersOnlyOnDisk = append(report.UsersOnlyOnDisk, name)
+		}
+	}
+	for _, name := range sortedUsers(generated.users) {
+		want := generated.users[name]
+		have, ok := disk.users[name]
+		switch {
+		case !ok:
+			report.UsersOnlyInPocketBase = append(report.UsersOnlyInPocketBase, name)
+		default:
+			if have.password != want.password {
+				report.PasswordChanged = append(report.PasswordChanged, name)
+			}
+			if have.account != want.account {
+				report.AccountChanged = append(report.AccountChanged, fmt.Sprintf("%s: %s -> %s", name, have.account, want.account))
+			}
+		}
+	}
+	return report, nil
+}
+
+// Passwords returns the password of every user in the config at path by username,
+// following its includes. A missing file has no users.
+func Passwords(path string) (map[string]string, error) {
+	passwords := make(map[string]string)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return passwords, nil
+		}
+		return nil, fmt.Errorf("failed to stat config on disk: %w", err)
+	}
+
+	parsed, err := parseFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config on disk: %w", err)
+	}
+	for name, u := range parseSnapshot(parsed).users {
+		passwords[name] = u.password
+	}
+	return passwords, nil
+}
+
+// parseSnapshot collects roles, accounts and users from a parsed NATS config
+func parseSnapshot(parsed map[string]interface{}) snapshot {
+	s := snapshot{roles: map[string]bool{}, users: map[string]user{}}
+
+	if authorization, ok := parsed["authorization"].(map[string]interface{}); ok {
+		for key, value := range authorization {
+			switch key {
+			case "users":
+				addUsers(s.users, value, "")
+			case "default_permissions":
+			default:
+				// Role definitions are the remaining permission maps
+				if _, ok := value.(map[string]interface{}); ok {
+					s.roles[key] = true
+				}
+			}
+		}
+	}
+
+	if accounts, ok := parsed["accounts"].(map[string]interface{}); ok {
+		for name, value := range accounts {
+			s.roles[name] = true
+			if account, ok := value.(map[string]interface{}); ok {
+				addUsers(s.users, account["users"], name)
+			}
+		}
+	}
+	return s
+}
+
+// addUsers adds the entries of a parsed users list
+func addUsers(users map[string]user, value interface{}, account string) {
+	list, _ := value.([]interface{})
+	for _, entry := range list {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := fields["user"].(string)
+		if nkey, ok := fields["nkey"].(string); ok && name == "" {
+			name = nkey
+		}
+		password, _ := fields["password"].(string)
+		users[name] = user{account: account, password: password}
+	}
+}
+
+// generatedSnapshot collects roles, accounts and users from generated config data
+func generatedSnapshot(data *models.NatsConfigData) snapshot {
+	s := snapshot{roles: map[string]bool{}, users: map[string]user{}}
+	// Roles are only emitted as such in the authorization block
+	if !data.AccountsMode && data.WrapAccount == "" {
+		for _, role := range data.Roles {
+			s.roles[role.Name] = true
+		}
+	}
+	if data.WrapAccount != "" {
+		s.roles[data.WrapAccount] = true
+	}
+	accountOf := make(map[string]string)
+	for _, account := range data.Accounts {
+		s.roles[account.Name] = true
+		for _, u := range account.Users {
+			accountOf[identity(u)] = account.Name
+		}
+	}
+	for _, u := range data.Users {
+		account := data.WrapAccount
+		if data.AccountsMode {
+			account = accountOf[identity(u)]
+		}
+		s.users[identity(u)] = user{account: account, password: u.Password}
+	}
+	if mu := data.MonitoringUser; mu != nil {
+		s.roles[mu.Account] = true
+		s.users[unquote(mu.Username)] = user{account: mu.Account, password: mu.Password}
+	}
+	return s
+}
+
+// identity names a generated user as it appears on disk, where nkey users have no username
+func identity(u models.NatsUser) string {
+	if u.NKey != "" {
+		return u.NKey
+	}
+	return u.Name
+}
+
+// unquote strips the quotes the generator adds to usernames for the template
+func unquote(username string) string {
+	if len(username) >= 2 && username[0] == '"' && username[len(username)-1] == '"' {
+		return username[1 : len(username)-1]
+	}
+	return username
+}
+
+// missing lists the names in from that are not in to, sorted
+func missing(from, to map[string]bool) []string {
+	var names []string
+	for name := range from {
+		if !to[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedUsers(users map[string]user) []string {
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,275 @@
+package drift
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth bounds nested includes, so an include cycle fails instead of recursing forever
+const maxIncludeDepth = 10
+
+// parser reads the parts of the NATS config format that generated and hand-edited
+// configs use: maps, arrays, quoted and bare values, comments, $variables and
+// includes. It stands in for the nats-server config package, which would pull the
+// whole server into this module for a read-only comparison. Values with a unit, such
+// as 1MB, stay strings, since only users and passwords are compared.
+type parser struct {
+	src    string
+	pos    int
+	line   int
+	path   string
+	scopes []map[string]interface{} // Enclosing maps, innermost last, searched for variables
+	depth  int
+}
+
+// parseFile parses the NATS config at path, following includes relative to the including file
+func parseFile(path string) (map[string]interface{}, error) {
+	top := make(map[string]interface{})
+	if err := parseInto(path, top, []map[string]interface{}{top}, 0); err != nil {
+		return nil, err
+	}
+	return top, nil
+}
+
+// parseInto parses the file at path and adds its entries to into
+func parseInto(path string, into map[string]interface{}, scopes []map[string]interface{}, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: includes nested deeper than %d", path, maxIncludeDepth)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p := &parser{src: string(content), line: 1, path: path, scopes: scopes, depth: depth}
+	return p.parseEntries(into, 0)
+}
+
+// errorf returns an error at the current position
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.path, p.line, fmt.Sprintf(format, args...))
+}
+
+// parseEntries reads key/value entries into m until closing, or the end of input when closing is 0
+func (p *parser) parseEntries(m map[string]interface{}, closing byte) error {
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.src) {
+			if closing != 0 {
+				return p.errorf("missing %q", closing)
+			}
+			return nil
+		}
+		if closing != 0 && p.src[p.pos] == closing {
+			p.pos++
+			return nil
+		}
+
+		key, err := p.parseKey()
+		if err != nil {
+			return err
+		}
+		p.skipSpace(false)
+		if key == "include" {
+			if err := p.parseInclude(m); err != nil {
+				return err
+			}
+			continue
+		}
+		if p.pos < len(p.src) && (p.src[p.pos] == '=' || p.src[p.pos] == ':') {
+			p.pos++
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return err
+		}
+		m[key] = value
+	}
+}
+
+// parseInclude reads an include path and adds the included file's entries to m
+func (p *parser) parseInclude(m map[string]interface{}) error {
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	include, ok := value.(string)
+	if !ok || include == "" {
+		return p.errorf("include needs a file path")
+	}
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(filepath.Dir(p.path), include)
+	}
+	return parseInto(include, m, p.scopes, p.depth+1)
+}
+
+// parseKey reads a quoted or bare key
+func (p *parser) parseKey() (string, error) {
+	if c := p.src[p.pos]; c == '"' || c == '\'' {
+		return p.parseQuoted()
+	}
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n=:{[,;}", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a key, found %q", p.src[p.pos])
+	}
+	return p.src[start:p.pos], nil
+}
+
+// parseValue reads a map, array, quoted string, variable or bare value
+func (p *parser) parseValue() (interface{}, error) {
+	p.skipSpace(false)
+	for p.pos < len(p.src) && p.src[p.pos] == '\n' {
+		p.line++
+		p.pos++
+		p.skipSpace(false)
+	}
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("missing value")
+	}
+
+	switch p.src[p.pos] {
+	case '{':
+		p.pos++
+		child := make(map[string]interface{})
+		p.scopes = append(p.scopes, child)
+		err := p.parseEntries(child, '}')
+		p.scopes = p.scopes[:len(p.scopes)-1]
+		if err != nil {
+			return nil, err
+		}
+		return child, nil
+	case '[':
+		p.pos++
+		return p.parseArray()
+	case '"', '\'':
+		return p.parseQuoted()
+	case '$':
+		p.pos++
+		return p.lookup(p.bareToken())
+	}
+
+	token := p.bareToken()
+	if token == "" {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	switch strings.ToLower(token) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(token, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f, nil
+	}
+	return token, nil
+}
+
+// parseArray reads values up to the closing bracket
+func (p *parser) parseArray() ([]interface{}, error) {
+	list := []interface{}{}
+	for {
+		p.skipSpace(true)
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("missing ']'")
+		}
+		if p.src[p.pos] == ']' {
+			p.pos++
+			return list, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+}
+
+// parseQuoted reads a double-quoted string with escapes, or a single-quoted raw string
+func (p *parser) parseQuoted() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\n':
+			return "", p.errorf("unterminated string")
+		case c == '\\' && quote == '"' && p.pos < len(p.src):
+			escaped := p.src[p.pos]
+			p.pos++
+			switch escaped {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(escaped)
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(escaped)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// bareToken reads an unquoted value up to whitespace or a separator. Like NATS, it
+// keeps "#" and "//" inside the value, e.g. in a URL.
+func (p *parser) bareToken() string {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n,;}]", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// lookup resolves a variable from the enclosing maps, innermost first, then the environment
+func (p *parser) lookup(name string) (interface{}, error) {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if value, ok := p.scopes[i][name]; ok {
+			return value, nil
+		}
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		return value, nil
+	}
+	return nil, p.errorf("variable reference for %q can not be found", name)
+}
+
+// skipSpace skips spaces, tabs and comments, and with entries also newlines and the
+// commas and semicolons separating entries
+func (p *parser) skipSpace(entries bool) {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case entries && (c == '\n' || c == ',' || c == ';'):
+			if c == '\n' {
+				p.line++
+			}
+			p.pos++
+		case c == '#' || strings.HasPrefix(p.src[p.pos:], "//"):
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package drift
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles writes the files under dir, creating directories as needed
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPasswordsFollowsIncludesAndVariables(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"nats.conf": `# Generated
+include "secrets.conf"
+listen: 0.0.0.0:4222 // trailing comment
+authorization {
+  default_permissions = { publish = "PUBLIC.>", subscribe = ["PUBLIC.>", "_INBOX.>"] }
+  SENSORS = {
+    publish = {allow: ["sensors.>"], deny: "sensors.admin"}
+    subscribe = "sensors.>"
+  }
+  users = [
+    {user: "alice", password: $PASSWORD_ALICE, permissions: $SENSORS},
+    {user: 'bob', password: "p\"w\\d", permissions: {publish: "x", subscribe: "y"}}
+    {nkey: "UABC", permissions: $SENSORS}
+  ]
+}
+accounts {
+  include "accounts/OPS.conf"
+}
+`,
+		"secrets.conf":      `PASSWORD_ALICE: "$2a$11$hash"`,
+		"accounts/OPS.conf": "OPS = {\n  users = [\n    {user: carol, password: c4r0l}\n  ]\n}\n",
+	})
+
+	passwords, err := Passwords(filepath.Join(dir, "nats.conf"))
+	if err != nil {
+		t.Fatalf("Passwords: %v", err)
+	}
+	want := map[string]string{"alice": "$2a$11$hash", "bob": `p"w\d`, "UABC": "", "carol": "c4r0l"}
+	if len(passwords) != len(want) {
+		t.Errorf("Passwords = %v, want %v", passwords, want)
+	}
+	for name, password := range want {
+		if got, ok := passwords[name]; !ok || got != password {
+			t.Errorf("password of %s = %q, want %q", name, got, password)
+		}
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown variable":    "authorization { users = [ {user: a, password: $MISSING_VARIABLE_X} ] }",
+		"unterminated string": `authorization { token: "abc` + "\n}",
+		"missing brace":       "authorization {\n  token: abc\n",
+		"include cycle":       `include "nats.conf"`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"nats.conf": content})
+			if _, err := parseFile(filepath.Join(dir, "nats.conf")); err == nil {
+				t.Error("parseFile succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestParseFileReadsGoldenConfigs(t *testing.T) {
+	files, err := filepath.Glob("../generator/testdata/fixtures/*/*.conf")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no golden configs found: %v", err)
+	}
+	for _, file := range files {
+		parsed, err := parseFile(file)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		_, authorization := parsed["authorization"]
+		_, accounts := parsed["accounts"]
+		if !authorization && !accounts {
+			t.Errorf("%s: no authorization or accounts block", file)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package envdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"nats-pocketbase-sync/internal/models"
+)
+
+// Snapshot is the user and role data fetched from one PocketBase environment
+type Snapshot struct {
+	Roles []models.MqttRole
+	Users []models.MqttUser
+}
+
+// Change is a single field that differs between the two environments
+type Change struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Entry is a role or user that differs between the two environments
+type Entry struct {
+	Name    string   `json:"name"`
+	Changes []Change `json:"changes,omitempty"` // Only set for changed entries
+}
+
+// Section holds the differences for one record type
+type Section struct {
+	Added   []Entry `json:"added"`
+	Removed []Entry `json:"removed"`
+	Changed []Entry `json:"changed"`
+}
+
+// Result is the structured difference between two environments.
+// Added entries only exist in the second environment, removed ones only in the first.
+type Result struct {
+	Roles Section `json:"roles"`
+	Users Section `json:"users"`
+}
+
+// Empty reports whether the environments have no differences
+func (r *Result) Empty() bool {
+	return r.Roles.empty() && r.Users.empty()
+}
+
+func (s *Section) empty() bool {
+	return len(s.Added) == 0 && len(s.Removed) == 0 && len(s.Changed) == 0
+}
+
+// Compare diffs two environments. Record IDs differ between environments, so roles are
+// matched by normalized name and users by username. Passwords are not compared because
+// bcrypt hashes of the same password differ.
+func Compare(from, to Snapshot) *Result {
+	return &Result{
+		Roles: diffRecords(roleFields(from.Roles), roleFields(to.Roles)),
+		Users: diffRecords(userFields(from), userFields(to)),
+	}
+}
+
+// roleFields flattens each role into comparable fields keyed by role name
+func roleFields(roles []models.MqttRole) map[string]map[string]string {
+	result := make(map[string]map[string]string, len(roles))
+	for _, role := range roles {
+		result[role.NormalizeRoleName()] = map[string]string{
+			"publish_permissions":           formatList(models.ParsePermissions(role.PublishPermissions)),
+			"subscribe_permissions":         formatList(models.ParsePermissions(role.SubscribePermissions)),
+			"default_publish_permissions":   formatList(models.ParsePermissions(role.DefaultPublishPermissions)),
+			"default_subscribe_permissions": formatList(models.ParsePermissions(role.DefaultSubscribePermissions)),
+			"publish_deny":                  formatList(models.ParsePermissions(role.PublishDenyPermissions)),
+			"subscribe_deny":                formatList(models.ParsePermissions(role.SubscribeDenyPermissions)),
+			"allow_responses":               role.FormatAllowResponses(),
+			"parent_role":                   parentRoleName(role.ParentRoleID, roles),
+			"mappings":                      formatJSON(role.Mappings),
+			"enabled":                       fmt.Sprint(role.IsEnabled()),
+			"max_connections":               fmt.Sprint(role.MaxConnections),
+			"max_subscriptions":             fmt.Sprint(role.MaxSubscriptions),
+			"max_payload":                   fmt.Sprint(role.MaxPayload),
+			"max_leafnodes":                 fmt.Sprint(role.MaxLeafnodes),
+		}
+	}
+	return result
+}
+
+// parentRoleName resolves a parent role ID to its NATS name, since IDs differ between environments
+func parentRoleName(id string, roles []models.MqttRole) string {
+	if id == "" {
+		return ""
+	}
+	for _, role := range roles {
+		if role.ID == id {
+			return role.NormalizeRoleName()
+		}
+	}
+	return "<unknown " + id + ">"
+}
+
+// userFields flattens each user into comparable fields keyed by username
+func userFields(snapshot Snapshot) map[string]map[string]string {
+	roleNames := make(map[string]string, len(snapshot.Roles))
+	for _, role := range snapshot.Roles {
+		roleNames[role.ID] = role.NormalizeRoleName()
+	}
+
+	result := make(map[string]map[string]string, len(snapshot.Users))
+	for _, user := range snapshot.Users {
+		role, ok := roleNames[user.RoleID]
+		if !ok {
+			role = "<unknown " + user.RoleID + ">"
+		}
+		result[user.Username] = map[string]string{
+			"role":                     role,
+			"active":                   fmt.Sprint(user.Active),
+			"expires_at":               formatTime(user.ExpiresAt),
+			"publish_permissions":      formatList(models.ParsePermissions(user.PublishPermissions)),
+			"subscribe_permissions":    formatList(models.ParsePermissions(user.SubscribePermissions)),
+			"allowed_connection_types": formatList(user.AllowedConnectionTypes),
+			"nkey":                     user.NKey,
+		}
+	}
+	return result
+}
+
+// diffRecords compares two sets of flattened records
+func diffRecords(from, to map[string]map[string]string) Section {
+	section := Section{Added: []Entry{}, Removed: []Entry{}, Changed: []Entry{}}
+	for _, name := range sortedKeys(to) {
+		if _, ok := from[name]; !ok {
+			section.Added = append(section.Added, Entry{Name: name})
+		}
+	}
+	for _, name := range sortedKeys(from) {
+		toFields, ok := to[name]
+		if !ok {
+			section.Removed = append(section.Removed, Entry{Name: name})
+			continue
+		}
+		if changes := diffFields(from[name], toFields); len(changes) > 0 {
+			section.Changed = append(section.Changed, Entry{Name: name, Changes: changes})
+		}
+	}
+	return section
+}
+
+// diffFields lists the fields whose values differ, in field name order
+func diffFields(from, to map[string]string) []Change {
+	var changes []Change
+	for _, field := range sortedKeys(from) {
+		if from[field] != to[field] {
+			changes = append(changes, Change{Field: field, From: from[field], To: to[field]})
+		}
+	}
+	return changes
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatList formats a subject list, ignoring order
+func formatList(subjects []string) string {
+	sorted := append([]string(nil), subjects...)
+	sort.Strings(sorted)
+	return "[" + strings.Join(sorted, ", ") + "]"
+}
+
+// formatTime formats an optional timestamp, empty when unset
+func formatTime(t models.FlexibleTime) string {
+	if t.Time().IsZero() {
+		return ""
+	}
+	return t.Time().UTC().Format(time.RFC3339)
+}
+
+// formatJSON formats a JSON field so equivalent documents compare equal
+func formatJSON(field json.RawMessage) string {
+	var value interface{}
+	if len(field) == 0 || json.Unmarshal(field, &value) != nil || value == nil {
+		return ""
+	}
+	if list, ok := value.([]interface{}); ok && len(list) == 0 {
+		return ""
+	}
+	normalized, _ := json.Marshal(value)
+	return string(normalized)
+}
+
+// Write prints the result as text: + added, - removed, ~ changed
+func (r *Result) Write(w io.Writer) error {
+	if r.Empty() {
+		_, err := fmt.Fprintln(w, "No differences")
+		return err
+	}
+
+	var b strings.Builder
+	writeSection(&b, "Roles", r.Roles)
+	writeSection(&b, "Users", r.Users)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeSection(b *strings.Builder, title string, section Section) {
+	if section.empty() {
+		return
+	}
+	fmt.Fprintf(b, "%s: %d added, %d removed, %d changed\n", title, len(section.Added), len(section.Removed), len(section.Changed))
+	for _, entry := range section.Added {
+		fmt.Fprintf(b, "  + %s\n", entry.Name)
+	}
+	for _, entry := range section.Removed {
+		fmt.Fprintf(b, "  - %s\n", entry.Name)
+	}
+	for _, entry := range section.Changed {
+		fmt.Fprintf(b, "  ~ %s\n", entry.Name)
+		for _, change := range entry.Changes {
+			fmt.Fprintf(b, "      %s: %s -> %s\n", change.Field, change.From, change.To)
+		}
+	}
+}
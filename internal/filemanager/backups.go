@@ -0,0 +1,319 @@
+package filemanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Backup files are named nats-config-<timestamp>-<fingerprint>.conf, with a .gz suffix
+// when compressed
+const (
+	backupPrefix     = "nats-config-"
+	backupTimeFormat = "20060102-150405"
+)
+
+// Retries of a required backup, for backup directories on briefly unavailable mounts
+const (
+	requiredBackupAttempts = 3
+	backupRetryDelay       = time.Second
+)
+
+// Backup describes a backup of the config file
+type Backup struct {
+	Path        string
+	Created     time.Time
+	Fingerprint string // Fingerprint of the backed-up content
+	Size        int64  // Size of the backup file, compressed if it is
+}
+
+// ListBackups returns the backups in the backup directory, newest first.
+// Backups named without a fingerprint get one computed from their content.
+func (fm *FileManager) ListBackups() ([]Backup, error) {
+	files, err := os.ReadDir(fm.backupDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var backups []Backup
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !isBackupName(name) {
+			continue
+		}
+
+		backup, err := fm.parseBackup(filepath.Join(fm.backupDir, name))
+		if err != nil {
+			fm.logger.Warn("Failed to read backup", zap.String("file", name), zap.Error(err))
+			continue
+		}
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Created.After(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// parseBackup reads the timestamp and fingerprint of a backup from its name,
+// falling back to the modification time and content for older backups
+func (fm *FileManager) parseBackup(path string) (Backup, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Backup{Path: path}, err
+	}
+	backup := Backup{Path: path, Size: info.Size()}
+	stem := strings.TrimSuffix(filepath.Base(path), compressedSuffix)
+	stem = strings.TrimSuffix(strings.TrimPrefix(stem, backupPrefix), ".conf")
+
+	if len(stem) > len(backupTimeFormat) {
+		backup.Created, _ = time.ParseInLocation(backupTimeFormat, stem[:len(backupTimeFormat)], time.Local)
+		if fingerprint := stem[len(backupTimeFormat)+1:]; len(fingerprint) == FingerprintLength {
+			backup.Fingerprint = fingerprint
+		}
+	} else {
+		backup.Created, _ = time.ParseInLocation(backupTimeFormat, stem, time.Local)
+	}
+
+	if backup.Created.IsZero() {
+		backup.Created = info.ModTime()
+	}
+	if backup.Fingerprint == "" {
+		content, err := readBackup(path)
+		if err != nil {
+			return backup, err
+		}
+		backup.Fingerprint = fm.Fingerprint(string(content))
+	}
+	return backup, nil
+}
+
+// RestoreBackup writes the newest backup whose fingerprint starts with fingerprint
+// back to the config file. The replaced config is backed up as usual.
+func (fm *FileManager) RestoreBackup(fingerprint string) (Backup, error) {
+	if fingerprint == "" {
+		return Backup{}, fmt.Errorf("fingerprint is required")
+	}
+
+	backups, err := fm.ListBackups()
+	if err != nil {
+		return Backup{}, err
+	}
+
+	for _, backup := range backups {
+		if strings.HasPrefix(backup.Fingerprint, fingerprint) {
+			return backup, fm.restore(backup)
+		}
+	}
+	return Backup{}, fmt.Errorf("no backup with fingerprint %q in %s", fingerprint, fm.backupDir)
+}
+
+// RestoreBackupFile writes the backup with the given file name back to the config file.
+// A path is accepted as long as it points into the backup directory, so the paths
+// ListBackups returns can be used as well. The replaced config is backed up as usual.
+func (fm *FileManager) RestoreBackupFile(name string) (Backup, error) {
+	if dir := filepath.Dir(name); dir != "." && filepath.Clean(dir) != filepath.Clean(fm.backupDir) {
+		return Backup{}, fmt.Errorf("%s is not in the backup directory %s", name, fm.backupDir)
+	}
+	name = filepath.Base(name)
+	if !isBackupName(name) {
+		return Backup{}, fmt.Errorf("%q is not a backup file name", name)
+	}
+
+	backup, err := fm.parseBackup(filepath.Join(fm.backupDir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return backup, fmt.Errorf("no backup %q in %s", name, fm.backupDir)
+		}
+		return backup, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return backup, fm.restore(backup)
+}
+
+// RestoreLastBackup writes the backup taken by the most recent write back to the config
+// file, undoing that write. The replaced config is backed up as usual, so a second call
+// restores the config that was just undone.
+func (fm *FileManager) RestoreLastBackup() (Backup, error) {
+	if fm.lastBackup == "" {
+		return Backup{}, fmt.Errorf("no backup was taken by the last write")
+	}
+
+	backup, err := fm.parseBackup(fm.lastBackup)
+	if err != nil {
+		return backup, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return backup, fm.restore(backup)
+}
+
+// restore writes the content of a backup to the config file. The hash of the content
+// last checked for changes is forgotten, so the next check compares against the
+// restored file and the undone config is written again if it is generated again.
+func (fm *FileManager) restore(backup Backup) error {
+	content, err := readBackup(backup.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	if err := fm.WriteConfigFile(string(content)); err != nil {
+		return err
+	}
+	fm.ForgetContentHash()
+
+	fm.logger.Info("Restored config backup",
+		zap.String("backup", backup.Path),
+		zap.String("fingerprint", backup.Fingerprint))
+	return nil
+}
+
+// SetBackupRequired controls whether a failed backup aborts the write. When required,
+// the backup is retried a few times first, so a change is never applied without a
+// backup to roll back to.
+func (fm *FileManager) SetBackupRequired(required bool) {
+	fm.backupRequired = required
+}
+
+// backupWithRetry backs up the current config file, retrying when a backup is required
+func (fm *FileManager) backupWithRetry() error {
+	attempts := 1
+	if fm.backupRequired {
+		attempts = requiredBackupAttempts
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fm.backupCurrentConfig(); err == nil {
+			return nil
+		}
+		if attempt < attempts {
+			fm.logger.Warn("Backup failed, retrying",
+				zap.Int("attempt", attempt),
+				zap.Duration("delay", backupRetryDelay),
+				zap.Error(err))
+			time.Sleep(backupRetryDelay)
+		}
+	}
+	return err
+}
+
+// CleanupBackupsKeepingLast removes all but the newest keep backups, ordered by
+// modification time. A keep of 0 or less leaves the backups alone.
+func (fm *FileManager) CleanupBackupsKeepingLast(keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	files, err := os.ReadDir(fm.backupDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	type backupFile struct {
+		path    string
+		modTime time.Time
+	}
+	var backups []backupFile
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !isBackupName(name) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			fm.logger.Warn("Failed to get file info", zap.String("file", name), zap.Error(err))
+			continue
+		}
+		backups = append(backups, backupFile{filepath.Join(fm.backupDir, name), info.ModTime()})
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	// Newest first, falling back to the name, which starts with the creation time
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].modTime.Equal(backups[j].modTime) {
+			return backups[i].modTime.After(backups[j].modTime)
+		}
+		return backups[i].path > backups[j].path
+	})
+
+	for _, backup := range backups[keep:] {
+		if err := os.Remove(backup.path); err != nil {
+			fm.logger.Warn("Failed to remove backup", zap.String("file", backup.path), zap.Error(err))
+			continue
+		}
+		fm.logger.Debug("Removed backup beyond retention count", zap.String("file", backup.path))
+	}
+	return nil
+}
+
+// DedupeBackups removes backups whose content matches an earlier backup, keeping the
+// earliest backup of each distinct config. Backups are compared by the normalized hash
+// change detection uses, so a config that was reverted and re-applied is kept once.
+func (fm *FileManager) DedupeBackups() error {
+	backups, err := fm.ListBackups()
+	if err != nil {
+		return err
+	}
+
+	// Earliest backup per fingerprint. Its hash is only read once a backup with the
+	// same fingerprint shows up, so distinct backups are never read.
+	type keptBackup struct {
+		path string
+		hash string
+	}
+	kept := make(map[string]*keptBackup)
+
+	// Walk oldest first so the earliest occurrence is kept
+	for i := len(backups) - 1; i >= 0; i-- {
+		backup := backups[i]
+		first, seen := kept[backup.Fingerprint]
+		if !seen {
+			kept[backup.Fingerprint] = &keptBackup{path: backup.Path}
+			continue
+		}
+
+		if first.hash == "" {
+			if first.hash, err = fm.backupHash(first.path); err != nil {
+				return err
+			}
+		}
+		hash, err := fm.backupHash(backup.Path)
+		if err != nil {
+			return err
+		}
+		if hash != first.hash {
+			// Same fingerprint but different content, keep both
+			continue
+		}
+
+		if err := os.Remove(backup.Path); err != nil {
+			fm.logger.Warn("Failed to remove duplicate backup", zap.String("file", backup.Path), zap.Error(err))
+			continue
+		}
+		fm.logger.Debug("Removed duplicate backup",
+			zap.String("file", backup.Path),
+			zap.String("kept", first.path),
+			zap.String("fingerprint", backup.Fingerprint))
+	}
+	return nil
+}
+
+// backupHash returns the content hash of a backup
+func (fm *FileManager) backupHash(path string) (string, error) {
+	content, err := readBackup(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+	return fm.ContentHash(string(content)), nil
+}
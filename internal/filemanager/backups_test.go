@@ -0,0 +1,104 @@
+package filemanager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCompressedBackupRoundTrip(t *testing.T) {
+	const original = "authorization {\n  users: [{user: \"alice\", password: \"secret\"}]\n}\n"
+	fm := newTestFileManager(t, original)
+	fm.SetCompressBackups(true)
+
+	if err := fm.WriteConfigFile("authorization {\n  users: []\n}\n"); err != nil {
+		t.Fatalf("WriteConfigFile: %v", err)
+	}
+
+	// The replaced config was backed up as gzip
+	backups, err := fm.ListBackups()
+	if err != nil {
+		t.Fatalf("ListBackups: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want 1", len(backups))
+	}
+	backup := backups[0]
+	if !strings.HasSuffix(backup.Path, ".conf.gz") {
+		t.Errorf("backup %s, want a .conf.gz file", backup.Path)
+	}
+	raw, err := os.ReadFile(backup.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("backup is not gzip-compressed: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress backup: %v", err)
+	}
+	if string(decompressed) != original {
+		t.Errorf("decompressed backup = %q, want %q", decompressed, original)
+	}
+
+	// The fingerprint is that of the plain content, so it matches the config it came from
+	if want := fm.Fingerprint(original); backup.Fingerprint != want {
+		t.Errorf("backup fingerprint = %s, want %s", backup.Fingerprint, want)
+	}
+
+	// Restoring decompresses transparently
+	restored, err := fm.RestoreLastBackup()
+	if err != nil {
+		t.Fatalf("RestoreLastBackup: %v", err)
+	}
+	if restored.Path != backup.Path {
+		t.Errorf("restored %s, want %s", restored.Path, backup.Path)
+	}
+	if got := readFile(t, fm.ConfigFile()); got != original {
+		t.Errorf("config file after restore = %q, want %q", got, original)
+	}
+}
+
+func TestCleanupMatchesPlainAndCompressedBackups(t *testing.T) {
+	fm := newTestFileManager(t, "port: 4222\n")
+
+	// One plain and one compressed backup, then a third write to leave two backups behind
+	for i, next := range []string{"port: 4223\n", "port: 4224\n", "port: 4225\n"} {
+		fm.SetCompressBackups(i%2 == 1)
+		if err := fm.WriteConfigFile(next); err != nil {
+			t.Fatalf("WriteConfigFile: %v", err)
+		}
+	}
+
+	backups, err := fm.ListBackups()
+	if err != nil {
+		t.Fatalf("ListBackups: %v", err)
+	}
+	var plain, compressed int
+	for _, backup := range backups {
+		if strings.HasSuffix(backup.Path, ".conf.gz") {
+			compressed++
+		} else {
+			plain++
+		}
+	}
+	if plain != 2 || compressed != 1 {
+		t.Fatalf("got %d plain and %d compressed backups, want 2 and 1", plain, compressed)
+	}
+
+	if err := fm.CleanupOldBackups(0); err != nil {
+		t.Fatalf("CleanupOldBackups: %v", err)
+	}
+	backups, err = fm.ListBackups()
+	if err != nil {
+		t.Fatalf("ListBackups: %v", err)
+	}
+	if len(backups) != 0 {
+		t.Errorf("%d backups left after cleanup, want none", len(backups))
+	}
+}
@@ -0,0 +1,57 @@
+package filemanager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// compressedSuffix is appended to the name of gzip-compressed backups
+const compressedSuffix = ".gz"
+
+// SetCompressBackups controls whether new backups are gzip-compressed. Existing backups
+// are read either way, so the setting can be changed without losing old backups.
+func (fm *FileManager) SetCompressBackups(enabled bool) {
+	fm.compressBackups = enabled
+}
+
+// isBackupName reports whether a file name is a plain or compressed backup
+func isBackupName(name string) bool {
+	return strings.HasPrefix(name, backupPrefix) &&
+		(strings.HasSuffix(name, ".conf") || strings.HasSuffix(name, ".conf"+compressedSuffix))
+}
+
+// readBackup returns the content of a backup, decompressing it if needed
+func readBackup(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil || !strings.HasSuffix(path, compressedSuffix) {
+		return content, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	defer reader.Close()
+	content, err = io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// compress returns the content gzip-compressed
+func compress(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
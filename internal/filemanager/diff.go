@@ -0,0 +1,13 @@
+package filemanager
+
+import "nats-pocketbase-sync/internal/textdiff"
+
+// Diff returns the unified diff from the current config file to the content as
+// WriteConfigFile would write it. Nothing is written.
+func (fm *FileManager) Diff(content string) (textdiff.Result, error) {
+	current, err := fm.ReadConfigFile()
+	if err != nil {
+		return textdiff.Result{}, err
+	}
+	return textdiff.Unified(fm.configFile, fm.configFile+" (generated)", current, fm.formatContent(content)), nil
+}
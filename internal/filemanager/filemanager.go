@@ -4,7 +4,6 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,24 +18,169 @@ type FileManager struct {
 	backupDir      string
 	logger         *zap.Logger
 	lastContentHash string
+	lineEnding     string
+	followSymlink  bool
+	writeFingerprint bool
+	lastFingerprint  string
+	fileMode       os.FileMode // Permissions of the written file and its backups
+	collapseWhitespace bool    // Ignore whitespace-only differences, see SetCollapseWhitespace
+	backupRequired bool        // Abort the write when the backup fails, see SetBackupRequired
+	lastBackup     string      // Backup taken by the most recent write, see RestoreLastBackup
+	compressBackups bool       // Gzip new backups, see SetCompressBackups
+	validate       func(path string) error // Checks the written temp file before the rename, see SetValidator
 }
 
+// FingerprintLength is the number of hex characters in a config fingerprint
+const FingerprintLength = 12
+
+// Supported line endings for the written config file
+const (
+	LineEndingLF   = "lf"
+	LineEndingCRLF = "crlf"
+)
+
 // NewFileManager creates a new FileManager
 func NewFileManager(configFile, backupDir string, logger *zap.Logger) *FileManager {
 	return &FileManager{
 		configFile: configFile,
 		backupDir:  backupDir,
 		logger:     logger,
+		lineEnding: LineEndingLF,
+		fileMode:   0644,
+	}
+}
+
+// ConfigFile returns the path of the managed config file
+func (fm *FileManager) ConfigFile() string {
+	return fm.configFile
+}
+
+// SetConfigFile switches the managed config file, for paths that change over time.
+// Change detection starts over, so the first write to a new path is never skipped.
+func (fm *FileManager) SetConfigFile(configFile string) {
+	if configFile == fm.configFile {
+		return
+	}
+	fm.logger.Info("Config file path changed",
+		zap.String("from", fm.configFile),
+		zap.String("to", configFile))
+	fm.configFile = configFile
+	fm.lastContentHash = ""
+}
+
+// SetFileMode sets the permissions of the written file and its backups
+func (fm *FileManager) SetFileMode(mode os.FileMode) {
+	fm.fileMode = mode
+}
+
+// SetValidator sets a check, such as nats-server -t, that the new config must pass before
+// it replaces the config file. It is run on the temp file next to the config file, so
+// relative includes resolve as they will for the real file.
+func (fm *FileManager) SetValidator(validate func(path string) error) {
+	fm.validate = validate
+}
+
+// ValidateConfigPath checks that the config path, if it exists, is a regular file
+// and that its parent directory exists
+func (fm *FileManager) ValidateConfigPath() error {
+	// os.Stat follows symlinks, so a symlink to a directory is rejected as well
+	fileInfo, err := os.Stat(fm.configFile)
+	if os.IsNotExist(err) {
+		dir := filepath.Dir(fm.configFile)
+		dirInfo, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("config file directory %s is not accessible: %w", dir, err)
+		}
+		if !dirInfo.IsDir() {
+			return fmt.Errorf("config file directory %s is not a directory", dir)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat config file %s: %w", fm.configFile, err)
+	}
+
+	if fileInfo.IsDir() {
+		return fmt.Errorf("config file path %s is a directory; nats.config_file must point to a file", fm.configFile)
+	}
+
+	// Warn when a symlink would be replaced by the atomic rename
+	if linkInfo, err := os.Lstat(fm.configFile); err == nil && linkInfo.Mode()&os.ModeSymlink != 0 && !fm.followSymlink {
+		fm.logger.Warn("Config file is a symlink and will be replaced by a regular file on write; enable nats.follow_symlink to preserve it",
+			zap.String("path", fm.configFile))
 	}
+	if !fileInfo.Mode().IsRegular() {
+		return fmt.Errorf("config file path %s is not a regular file (mode %s)", fm.configFile, fileInfo.Mode())
+	}
+
+	return nil
+}
+
+// SetFollowSymlink controls whether writes go to the target of a symlinked config file
+func (fm *FileManager) SetFollowSymlink(follow bool) {
+	fm.followSymlink = follow
+}
+
+// writePath returns the path the config is written to, resolving symlinks if enabled
+func (fm *FileManager) writePath() (string, error) {
+	if !fm.followSymlink {
+		return fm.configFile, nil
+	}
+
+	resolved, err := filepath.EvalSymlinks(fm.configFile)
+	if os.IsNotExist(err) {
+		return fm.configFile, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve config file symlink: %w", err)
+	}
+	return resolved, nil
+}
+
+// SetWriteFingerprint controls whether a .fingerprint file is written next to the config file
+func (fm *FileManager) SetWriteFingerprint(enabled bool) {
+	fm.writeFingerprint = enabled
+}
+
+// Fingerprint returns a short stable identifier for the given config content.
+// It is derived from the same normalized hash used for change detection.
+func (fm *FileManager) Fingerprint(content string) string {
+	hash := CalculateHash(fm.NormalizeFileContent(fm.formatContent(content)))
+	return hash[:FingerprintLength]
+}
+
+// LastFingerprint returns the fingerprint of the most recently written config
+func (fm *FileManager) LastFingerprint() string {
+	return fm.lastFingerprint
+}
+
+// SetLineEnding sets the line ending used for the written config file ("lf" or "crlf")
+func (fm *FileManager) SetLineEnding(lineEnding string) {
+	fm.lineEnding = lineEnding
+}
+
+// FormatLineEndings converts content to the configured line ending and
+// guarantees exactly one trailing newline
+func (fm *FileManager) FormatLineEndings(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimRight(content, "\r\n") + "\n"
+
+	if fm.lineEnding == LineEndingCRLF {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	return content
 }
 
 // HasConfigChanged checks if the provided content is different from the current config file
 func (fm *FileManager) HasConfigChanged(content string) (bool, error) {
+	// Apply the output formatting before hashing so it matches what is written
+	content = fm.formatContent(content)
+
 	// Normalize the new content (removing comments, whitespace, etc.)
 	normalizedNewContent := fm.NormalizeFileContent(content)
 	
 	// Calculate hash of the normalized new content
-	contentHash := calculateHash(normalizedNewContent)
+	contentHash := CalculateHash(normalizedNewContent)
 	
 	// If we already checked this content and it's unchanged, skip
 	if contentHash == fm.lastContentHash {
@@ -72,7 +216,7 @@ func (fm *FileManager) HasConfigChanged(content string) (bool, error) {
 	normalizedCurrentContent := fm.NormalizeFileContent(string(currentContent))
 	
 	// Calculate hash of the normalized current content
-	currentHash := calculateHash(normalizedCurrentContent)
+	currentHash := CalculateHash(normalizedCurrentContent)
 	
 	// Check if the content has changed
 	hasChanged := currentHash != contentHash
@@ -93,8 +237,16 @@ func (fm *FileManager) HasConfigChanged(content string) (bool, error) {
 
 // WriteConfigFile writes the content to the config file atomically
 func (fm *FileManager) WriteConfigFile(content string) error {
+	content = fm.formatContent(content)
+
+	// Resolve the real target so a symlinked config file is preserved
+	targetPath, err := fm.writePath()
+	if err != nil {
+		return err
+	}
+
 	// Create temporary file in the same directory as the target file
-	dir := filepath.Dir(fm.configFile)
+	dir := filepath.Dir(targetPath)
 	tempFile, err := os.CreateTemp(dir, "nats-config-*.tmp")
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
@@ -119,29 +271,57 @@ func (fm *FileManager) WriteConfigFile(content string) error {
 		return fmt.Errorf("failed to close temp file: %w", err)
 	}
 
+	// Keep the current config when the new one fails validation
+	if fm.validate != nil {
+		if err := fm.validate(tempFilePath); err != nil {
+			// Forget the checked content so the next cycle validates again
+			fm.lastContentHash = ""
+			return fmt.Errorf("new config not written: %w", err)
+		}
+	}
+
 	// Create a backup of the current config file if it exists
-	if err := fm.backupCurrentConfig(); err != nil {
+	if err := fm.backupWithRetry(); err != nil {
+		if fm.backupRequired {
+			// Forget the checked content so the next cycle tries again
+			fm.lastContentHash = ""
+			return fmt.Errorf("backup required but failed, config not written: %w", err)
+		}
 		fm.logger.Warn("Failed to create backup", zap.Error(err))
 		// Continue even if backup fails
 	}
 
 	// Atomically rename the temporary file to the target file
-	if err := os.Rename(tempFilePath, fm.configFile); err != nil {
+	if err := os.Rename(tempFilePath, targetPath); err != nil {
 		return fmt.Errorf("failed to replace config file: %w", err)
 	}
 
 	// Ensure proper file permissions
-	if err := os.Chmod(fm.configFile, 0644); err != nil {
+	if err := os.Chmod(targetPath, fm.fileMode); err != nil {
 		fm.logger.Warn("Failed to set config file permissions", zap.Error(err))
 		// Continue even if permission setting fails
 	}
 
-	fm.logger.Info("Successfully wrote config file", zap.String("path", fm.configFile))
+	fm.lastFingerprint = fm.Fingerprint(content)
+	if fm.writeFingerprint {
+		fingerprintPath := fm.configFile + ".fingerprint"
+		if err := os.WriteFile(fingerprintPath, []byte(fm.lastFingerprint+"\n"), 0644); err != nil {
+			fm.logger.Warn("Failed to write fingerprint file", zap.String("path", fingerprintPath), zap.Error(err))
+		}
+	}
+
+	fm.logger.Info("Successfully wrote config file",
+		zap.String("path", fm.configFile),
+		zap.String("target", targetPath),
+		zap.String("fingerprint", fm.lastFingerprint))
 	return nil
 }
 
 // backupCurrentConfig creates a backup of the current config file
 func (fm *FileManager) backupCurrentConfig() error {
+	// Forget the previous backup so a write without one has nothing to restore
+	fm.lastBackup = ""
+
 	// Check if the config file exists
 	if _, err := os.Stat(fm.configFile); os.IsNotExist(err) {
 		// No file to backup
@@ -153,30 +333,34 @@ func (fm *FileManager) backupCurrentConfig() error {
 		return fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
-	// Generate backup filename with timestamp
-	timestamp := time.Now().Format("20060102-150405")
-	backupFilename := filepath.Join(fm.backupDir, fmt.Sprintf("nats-config-%s.conf", timestamp))
-
-	// Open source file
-	source, err := os.Open(fm.configFile)
+	// Read the current content so the backup can be named after its fingerprint
+	content, err := os.ReadFile(fm.configFile)
 	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
+		return fmt.Errorf("failed to read source file: %w", err)
 	}
-	defer source.Close()
 
-	// Create destination file
-	destination, err := os.Create(backupFilename)
-	if err != nil {
-		return fmt.Errorf("failed to create backup file: %w", err)
+	// Generate backup filename with timestamp and fingerprint
+	timestamp := time.Now().Format(backupTimeFormat)
+	fingerprint := fm.Fingerprint(string(content))
+	backupFilename := filepath.Join(fm.backupDir, fmt.Sprintf("%s%s-%s.conf", backupPrefix, timestamp, fingerprint))
+
+	// Compress the backup if enabled; the fingerprint stays that of the plain content
+	if fm.compressBackups {
+		if content, err = compress(content); err != nil {
+			return fmt.Errorf("failed to compress backup: %w", err)
+		}
+		backupFilename += compressedSuffix
 	}
-	defer destination.Close()
 
-	// Copy file contents
-	if _, err := io.Copy(destination, source); err != nil {
-		return fmt.Errorf("failed to copy file contents: %w", err)
+	// Create destination file
+	if err := os.WriteFile(backupFilename, content, fm.fileMode); err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
 	}
+	fm.lastBackup = backupFilename
 
-	fm.logger.Info("Created config backup", zap.String("backup", backupFilename))
+	fm.logger.Info("Created config backup",
+		zap.String("backup", backupFilename),
+		zap.String("fingerprint", fingerprint))
 	return nil
 }
 
@@ -206,6 +390,9 @@ func (fm *FileManager) NormalizeFileContent(content string) string {
 	var normalizedLines []string
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
+		if fm.collapseWhitespace {
+			trimmed = collapseLine(trimmed)
+		}
 		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
 			normalizedLines = append(normalizedLines, trimmed)
 		}
@@ -258,8 +445,9 @@ func (fm *FileManager) CleanupOldBackups(maxAge time.Duration) error {
 	return nil
 }
 
-// calculateHash calculates the SHA-256 hash of a string
-func calculateHash(content string) string {
+// CalculateHash calculates the SHA-256 hash of a string. Change detection applies it
+// to normalized content, see ContentHash.
+func CalculateHash(content string) string {
 	hasher := sha256.New()
 	hasher.Write([]byte(content))
 	return hex.EncodeToString(hasher.Sum(nil))
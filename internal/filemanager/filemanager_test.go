@@ -0,0 +1,108 @@
+package filemanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// newTestFileManager returns a file manager for nats.conf in a temporary directory,
+// with the given initial content unless it is empty
+func newTestFileManager(t *testing.T, initial string) *FileManager {
+	t.Helper()
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "nats.conf")
+	if initial != "" {
+		if err := os.WriteFile(configFile, []byte(initial), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewFileManager(configFile, filepath.Join(dir, "backups"), zap.NewNop())
+}
+
+// readFile returns the content of path, failing the test if it cannot be read
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestWriteConfigFileFailingValidatorKeepsConfig(t *testing.T) {
+	const current = "authorization {\n  users: []\n}\n"
+	fm := newTestFileManager(t, current)
+
+	var validated, validatedContent string
+	fm.SetValidator(func(path string) error {
+		validated = path
+		validatedContent = readFile(t, path)
+		return errors.New("nats-server rejected the config")
+	})
+
+	changed, err := fm.HasConfigChanged("broken {\n")
+	if err != nil || !changed {
+		t.Fatalf("HasConfigChanged = %v, %v, want a change", changed, err)
+	}
+	if err := fm.WriteConfigFile("broken {\n"); err == nil {
+		t.Fatal("WriteConfigFile succeeded, want the validation error")
+	}
+
+	if validated == "" {
+		t.Fatal("validator was not called")
+	}
+	if filepath.Dir(validated) != filepath.Dir(fm.ConfigFile()) {
+		t.Errorf("validated %s, want a temp file next to the config file", validated)
+	}
+	if validatedContent != "broken {\n" {
+		t.Errorf("validated content %q, want the new config", validatedContent)
+	}
+
+	// The temp file was not renamed over the config file, and was removed
+	if got := readFile(t, fm.ConfigFile()); got != current {
+		t.Errorf("config file = %q, want it unchanged", got)
+	}
+	if _, err := os.Stat(validated); !os.IsNotExist(err) {
+		t.Errorf("temp file %s still exists", validated)
+	}
+	entries, err := os.ReadDir(filepath.Dir(fm.ConfigFile()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("config directory holds %d entries, want only the config file", len(entries))
+	}
+
+	// The rejected config is checked again on the next cycle instead of counting as unchanged
+	changed, err = fm.HasConfigChanged("broken {\n")
+	if err != nil || !changed {
+		t.Errorf("HasConfigChanged after rejection = %v, %v, want a change", changed, err)
+	}
+}
+
+func TestWriteConfigFilePassingValidatorWritesConfig(t *testing.T) {
+	fm := newTestFileManager(t, "authorization {\n  users: []\n}\n")
+
+	calls := 0
+	fm.SetValidator(func(path string) error {
+		calls++
+		return nil
+	})
+
+	const next = "authorization {\n  users: [{user: \"alice\", password: \"secret\"}]\n}\n"
+	if err := fm.WriteConfigFile(next); err != nil {
+		t.Fatalf("WriteConfigFile: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("validator called %d times, want 1", calls)
+	}
+	if got := readFile(t, fm.ConfigFile()); got != next {
+		t.Errorf("config file = %q, want %q", got, next)
+	}
+}
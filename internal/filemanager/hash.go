@@ -0,0 +1,60 @@
+package filemanager
+
+import (
+	"fmt"
+	"os"
+)
+
+// ContentHash returns the full hash change detection uses for generated content.
+// Fingerprint is its first FingerprintLength characters.
+func (fm *FileManager) ContentHash(content string) string {
+	return CalculateHash(fm.NormalizeFileContent(fm.formatContent(content)))
+}
+
+// CurrentHash returns the hash of the config file on disk, normalized the same way
+// as generated content. It returns an empty string when the file does not exist.
+func (fm *FileManager) CurrentHash() (string, error) {
+	content, err := os.ReadFile(fm.configFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read config file: %w", err)
+	}
+	return fm.ContentHash(string(content)), nil
+}
+
+// LastContentHash returns the hash of the content last checked for changes,
+// or an empty string before the first check
+func (fm *FileManager) LastContentHash() string {
+	return fm.lastContentHash
+}
+
+// ForgetContentHash clears the hash of the content last checked for changes, so the
+// next check compares against the file on disk again. Callers use it when the checked
+// content did not end up in place, e.g. after a failed write.
+func (fm *FileManager) ForgetContentHash() {
+	fm.lastContentHash = ""
+}
+
+// CheckHashStable calls generate runs times and returns the common content hash.
+// It fails on the first run whose hash differs, which means generation is not
+// deterministic for equivalent input and would cause spurious reloads.
+func (fm *FileManager) CheckHashStable(runs int, generate func() (string, error)) (string, error) {
+	var first string
+	for run := 1; run <= runs; run++ {
+		content, err := generate()
+		if err != nil {
+			return "", fmt.Errorf("run %d: %w", run, err)
+		}
+		hash := fm.ContentHash(content)
+		if run == 1 {
+			first = hash
+			continue
+		}
+		if hash != first {
+			return "", fmt.Errorf("run %d produced hash %s, run 1 produced %s", run, hash[:FingerprintLength], first[:FingerprintLength])
+		}
+	}
+	return first, nil
+}
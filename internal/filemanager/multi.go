@@ -0,0 +1,110 @@
+package filemanager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Write failure policies for MultiWriter
+const (
+	WritePolicyFailFast   = "fail_fast"
+	WritePolicyBestEffort = "best_effort"
+)
+
+// MultiWriter writes the same config to several destinations using a bounded worker pool
+type MultiWriter struct {
+	managers    []*FileManager
+	concurrency int
+	policy      string
+	logger      *zap.Logger
+}
+
+// NewMultiWriter creates a new MultiWriter
+func NewMultiWriter(managers []*FileManager, concurrency int, policy string, logger *zap.Logger) *MultiWriter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &MultiWriter{
+		managers:    managers,
+		concurrency: concurrency,
+		policy:      policy,
+		logger:      logger,
+	}
+}
+
+// WriteIfChanged writes the content to every destination whose config has changed.
+// It reports whether at least one destination was written. With the fail_fast policy,
+// destinations not yet started are skipped after the first failure; with best_effort
+// every destination is attempted and all errors are returned together.
+func (mw *MultiWriter) WriteIfChanged(content string) (bool, error) {
+	var (
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+		errs    []error
+		written int
+		failed  bool
+	)
+
+	jobs := make(chan *FileManager)
+	for i := 0; i < mw.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fm := range jobs {
+				changed, err := mw.writeOne(fm, content)
+
+				mutex.Lock()
+				if err != nil {
+					errs = append(errs, err)
+					failed = true
+				} else if changed {
+					written++
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, fm := range mw.managers {
+		mutex.Lock()
+		stop := failed && mw.policy == WritePolicyFailFast
+		mutex.Unlock()
+		if stop {
+			mw.logger.Warn("Skipping remaining destinations after write failure", zap.String("path", fm.configFile))
+			continue
+		}
+		jobs <- fm
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		mw.logger.Error("Failed to write config to some destinations",
+			zap.Int("failed", len(errs)),
+			zap.Int("written", written),
+			zap.Int("total", len(mw.managers)))
+	}
+
+	return written > 0, errors.Join(errs...)
+}
+
+// writeOne checks a single destination and writes it if its config changed
+func (mw *MultiWriter) writeOne(fm *FileManager, content string) (bool, error) {
+	changed, err := fm.HasConfigChanged(content)
+	if err != nil {
+		return false, fmt.Errorf("%s: failed to check if config changed: %w", fm.configFile, err)
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if err := fm.WriteConfigFile(content); err != nil {
+		// The check above saved the new hash, forget it so the next cycle writes again
+		fm.ForgetContentHash()
+		return false, fmt.Errorf("%s: failed to write config file: %w", fm.configFile, err)
+	}
+	return true, nil
+}
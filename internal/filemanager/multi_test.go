@@ -0,0 +1,35 @@
+package filemanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMultiWriterRetriesFailedWrite(t *testing.T) {
+	// The destination's directory is missing, so the first write fails after the change check
+	dir := filepath.Join(t.TempDir(), "missing")
+	configFile := filepath.Join(dir, "nats.conf")
+	fm := NewFileManager(configFile, filepath.Join(t.TempDir(), "backups"), zap.NewNop())
+	mw := NewMultiWriter([]*FileManager{fm}, 1, WritePolicyBestEffort, zap.NewNop())
+
+	if _, err := mw.WriteIfChanged("port: 4222\n"); err == nil {
+		t.Fatal("WriteIfChanged succeeded without the destination directory")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := mw.WriteIfChanged("port: 4222\n")
+	if err != nil {
+		t.Fatalf("WriteIfChanged: %v", err)
+	}
+	if !changed {
+		t.Fatal("content of the failed write was treated as unchanged")
+	}
+	if got := readFile(t, configFile); got != "port: 4222\n" {
+		t.Errorf("config = %q, want the retried content", got)
+	}
+}
@@ -0,0 +1,122 @@
+package filemanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// SplitWriter manages a directory of per-account include files. Each file is
+// change-detected and written independently, and files for accounts that no
+// longer exist are removed.
+type SplitWriter struct {
+	dir       string
+	backupDir string
+	configure func(*FileManager)
+	managers  map[string]*FileManager
+	logger    *zap.Logger
+}
+
+// NewSplitWriter creates a new SplitWriter. The configure function applies shared
+// output settings to the file manager created for each account file.
+func NewSplitWriter(dir, backupDir string, configure func(*FileManager), logger *zap.Logger) *SplitWriter {
+	return &SplitWriter{
+		dir:       dir,
+		backupDir: backupDir,
+		configure: configure,
+		managers:  make(map[string]*FileManager),
+		logger:    logger,
+	}
+}
+
+// WriteFiles writes every changed account file and removes stale ones.
+// It reports whether any file was written or removed.
+func (sw *SplitWriter) WriteFiles(files map[string]string) (bool, error) {
+	if err := os.MkdirAll(sw.dir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create account directory: %w", err)
+	}
+
+	// Write accounts in a stable order
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	changed := false
+	for _, name := range names {
+		fm := sw.manager(name)
+		fileChanged, err := fm.HasConfigChanged(files[name])
+		if err != nil {
+			return changed, fmt.Errorf("account %s: failed to check if config changed: %w", name, err)
+		}
+		if !fileChanged {
+			continue
+		}
+
+		if err := fm.WriteConfigFile(files[name]); err != nil {
+			return changed, fmt.Errorf("account %s: failed to write config file: %w", name, err)
+		}
+		sw.logger.Info("Account config changed", zap.String("account", name))
+		changed = true
+	}
+
+	removed, err := sw.removeStale(files)
+	if err != nil {
+		return changed, err
+	}
+
+	return changed || removed, nil
+}
+
+// manager returns the file manager for an account, creating it on first use
+func (sw *SplitWriter) manager(name string) *FileManager {
+	if fm, ok := sw.managers[name]; ok {
+		return fm
+	}
+
+	fm := NewFileManager(
+		filepath.Join(sw.dir, name+".conf"),
+		filepath.Join(sw.backupDir, name),
+		sw.logger.With(zap.String("account", name)),
+	)
+	if sw.configure != nil {
+		sw.configure(fm)
+	}
+	sw.managers[name] = fm
+	return fm
+}
+
+// removeStale removes account files that are no longer generated
+func (sw *SplitWriter) removeStale(files map[string]string) (bool, error) {
+	entries, err := os.ReadDir(sw.dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to read account directory: %w", err)
+	}
+
+	removed := false
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), ".conf")
+		if _, ok := files[name]; ok {
+			continue
+		}
+
+		filePath := filepath.Join(sw.dir, entry.Name())
+		if err := os.Remove(filePath); err != nil {
+			return removed, fmt.Errorf("failed to remove stale account file: %w", err)
+		}
+		delete(sw.managers, name)
+		sw.logger.Info("Removed config for deleted account", zap.String("account", name), zap.String("file", filePath))
+		removed = true
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,96 @@
+package filemanager
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// BackupCheck is the result of verifying one backup
+type BackupCheck struct {
+	Backup
+	Err error // Nil when the backup is intact
+}
+
+// VerifyBackups checks the newest count backups and returns one result per backup.
+// A backup is intact when it is non-empty, its content still matches the fingerprint
+// in its name, and its braces and brackets are balanced.
+func (fm *FileManager) VerifyBackups(count int) ([]BackupCheck, error) {
+	backups, err := fm.ListBackups()
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 && len(backups) > count {
+		backups = backups[:count]
+	}
+
+	checks := make([]BackupCheck, 0, len(backups))
+	for _, backup := range backups {
+		check := BackupCheck{Backup: backup, Err: fm.verifyBackup(backup)}
+		if check.Err != nil {
+			fm.logger.Error("Backup failed verification",
+				zap.String("backup", backup.Path),
+				zap.String("fingerprint", backup.Fingerprint),
+				zap.Error(check.Err))
+		} else {
+			fm.logger.Debug("Backup verified",
+				zap.String("backup", backup.Path),
+				zap.String("fingerprint", backup.Fingerprint))
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// verifyBackup checks a single backup
+func (fm *FileManager) verifyBackup(backup Backup) error {
+	content, err := readBackup(backup.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return fmt.Errorf("backup is empty")
+	}
+
+	// Backups named with a fingerprint must still hash to it
+	if fingerprint := fm.Fingerprint(string(content)); fingerprint != backup.Fingerprint {
+		return fmt.Errorf("content fingerprint %s does not match %s, backup is truncated or modified", fingerprint, backup.Fingerprint)
+	}
+
+	return checkBalanced(string(content))
+}
+
+// checkBalanced reports unbalanced braces or brackets outside strings and comments,
+// the usual sign of a truncated NATS config
+func checkBalanced(content string) error {
+	var stack []rune
+	closing := map[rune]rune{'}': '{', ']': '['}
+	for lineNumber, line := range strings.Split(content, "\n") {
+		var quote rune
+	chars:
+		for _, char := range line {
+			switch {
+			case quote != 0:
+				if char == quote {
+					quote = 0
+				}
+			case char == '"' || char == '\'':
+				quote = char
+			case char == '#':
+				break chars
+			case char == '{' || char == '[':
+				stack = append(stack, char)
+			case closing[char] != 0:
+				if len(stack) == 0 || stack[len(stack)-1] != closing[char] {
+					return fmt.Errorf("unexpected %q on line %d", char, lineNumber+1)
+				}
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("%d unclosed %q at end of file", len(stack), stack[len(stack)-1])
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package filemanager
+
+import "strings"
+
+// SetCollapseWhitespace enables whitespace-insensitive change detection. Runs of spaces and
+// tabs outside quoted strings are collapsed and trailing whitespace is trimmed, both in the
+// written file and before hashing, so whitespace-only differences never trigger a reload.
+func (fm *FileManager) SetCollapseWhitespace(enabled bool) {
+	fm.collapseWhitespace = enabled
+}
+
+// formatContent applies the configured whitespace and line ending formatting
+func (fm *FileManager) formatContent(content string) string {
+	if fm.collapseWhitespace {
+		content = collapseWhitespace(content)
+	}
+	return fm.FormatLineEndings(content)
+}
+
+// collapseWhitespace collapses insignificant whitespace on every line, keeping indentation
+func collapseWhitespace(content string) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = collapseLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// collapseLine collapses runs of spaces and tabs after the indentation into a single space
+// and trims trailing whitespace. Whitespace inside quoted strings is significant and kept.
+func collapseLine(line string) string {
+	body := strings.TrimLeft(line, " \t")
+	indent := line[:len(line)-len(body)]
+	body = strings.TrimRight(body, " \t")
+
+	var b strings.Builder
+	b.WriteString(indent)
+	var quote rune
+	space := false
+	for _, char := range body {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '"' || char == '\'':
+			quote = char
+		case char == ' ' || char == '\t':
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(char)
+	}
+	return b.String()
+}
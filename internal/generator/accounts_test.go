@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+)
+
+// accountsFixture returns two roles with one user each
+func accountsFixture() ([]models.MqttRole, []models.MqttUser) {
+	roles := []models.MqttRole{
+		{ID: "r1", Name: "sensors", PublishPermissions: subjects("sensors.>")},
+		{ID: "r2", Name: "admins", PublishPermissions: subjects(">")},
+	}
+	return roles, []models.MqttUser{testUser("u1", "alice", "r1"), testUser("u2", "bob", "r2")}
+}
+
+func TestSystemAccount(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		want    string // Expected directive, empty when generation must fail
+	}{
+		{name: "generated account", account: "ADMINS", want: `system_account: "ADMINS"`},
+		{name: "monitoring account", account: "SYS", want: `system_account: "SYS"`},
+		{name: "unknown account", account: "NOPE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGenerator()
+			g.SetOutputMode(OutputModeAccounts)
+			g.SetMonitoringUser(MonitoringUser{Account: "SYS", Username: "monitor", Password: "secret", Subscribe: []string{"$SYS.>"}})
+			g.SetSystemAccount(tt.account)
+
+			roles, users := accountsFixture()
+			config, err := g.GenerateConfig(roles, users)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("GenerateConfig succeeded with system account %q", tt.account)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateConfig: %v", err)
+			}
+			if !strings.Contains(config, tt.want) {
+				t.Errorf("config lacks %q:\n%s", tt.want, config)
+			}
+		})
+	}
+}
+
+func TestAccountOrdering(t *testing.T) {
+	roles := []models.MqttRole{
+		{ID: "r1", Name: "alpha", SortOrder: 2},
+		{ID: "r2", Name: "bravo", SortOrder: 1, Group: "edge"},
+		{ID: "r3", Name: "charlie", SortOrder: 1},
+		{ID: "r4", Name: "delta", Group: "core"},
+	}
+	users := []models.MqttUser{testUser("u1", "a", "r1"), testUser("u2", "b", "r2"), testUser("u3", "c", "r3"), testUser("u4", "d", "r4")}
+
+	tests := []struct {
+		name    string
+		order   string
+		group   bool
+		want    []string
+		headers []string // Accounts emitted with a group separator
+	}{
+		{name: "name", order: AccountOrderName, want: []string{"ALPHA", "BRAVO", "CHARLIE", "DELTA"}},
+		{name: "priority", order: AccountOrderPriority, want: []string{"DELTA", "BRAVO", "CHARLIE", "ALPHA"}},
+		{name: "grouped by name", order: AccountOrderName, group: true,
+			want: []string{"DELTA", "BRAVO", "ALPHA", "CHARLIE"}, headers: []string{"DELTA", "BRAVO", "ALPHA"}},
+		{name: "grouped by priority", order: AccountOrderPriority, group: true,
+			want: []string{"DELTA", "BRAVO", "CHARLIE", "ALPHA"}, headers: []string{"DELTA", "BRAVO", "CHARLIE"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGenerator()
+			g.SetOutputMode(OutputModeAccounts)
+			g.SetAccountOrdering(tt.order, tt.group)
+
+			data, err := g.GenerateConfigData(roles, users)
+			if err != nil {
+				t.Fatalf("GenerateConfigData: %v", err)
+			}
+			var got, headers []string
+			for i, account := range data.Accounts {
+				got = append(got, account.Name)
+				if account.GroupHeader {
+					headers = append(headers, account.Name)
+				}
+				if account.IsLast != (i == len(data.Accounts)-1) {
+					t.Errorf("account %s has IsLast %v", account.Name, account.IsLast)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("accounts = %v, want %v", got, tt.want)
+			}
+			if strings.Join(headers, ",") != strings.Join(tt.headers, ",") {
+				t.Errorf("group headers on %v, want %v", headers, tt.headers)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// DefaultTargetVersion is the NATS server version the config is generated for unless
+// configured otherwise
+const DefaultTargetVersion = "2.10.0"
+
+// Config features that older NATS servers reject
+const (
+	featureConnectionTypes = "allowed_connection_types"
+	featureMappings        = "mappings"
+)
+
+// defaultTargetVersion is DefaultTargetVersion parsed
+var defaultTargetVersion, _ = ParseNatsVersion(DefaultTargetVersion)
+
+// featureVersions is the first NATS server version accepting each feature
+var featureVersions = map[string]NatsVersion{
+	featureConnectionTypes: {2, 2, 0},
+	featureMappings:        {2, 2, 0},
+}
+
+// NatsVersion is a NATS server version
+type NatsVersion struct {
+	Major, Minor, Patch int
+}
+
+// ParseNatsVersion parses a version such as "2.10", "2.10.22" or "v2.10.22"
+func ParseNatsVersion(value string) (NatsVersion, error) {
+	var v NatsVersion
+	trimmed := strings.TrimPrefix(strings.TrimSpace(value), "v")
+	parts := strings.Split(trimmed, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, fmt.Errorf("invalid NATS version %q: expected MAJOR.MINOR or MAJOR.MINOR.PATCH", value)
+	}
+
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		var n int
+		if _, err := fmt.Sscanf(part, "%d", &n); err != nil || n < 0 || fmt.Sprint(n) != part {
+			return v, fmt.Errorf("invalid NATS version %q", value)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+// String formats the version as MAJOR.MINOR.PATCH
+func (v NatsVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// atLeast reports whether v is the same as or newer than other
+func (v NatsVersion) atLeast(other NatsVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+// SetTargetVersion sets the NATS server version the config is generated for.
+// Features the version does not accept are left out with a warning.
+func (g *Generator) SetTargetVersion(version string) error {
+	v, err := ParseNatsVersion(version)
+	if err != nil {
+		return err
+	}
+	g.targetVersion = v
+	return nil
+}
+
+// supports reports whether the target NATS version accepts feature
+func (g *Generator) supports(feature string) bool {
+	return g.targetVersion.atLeast(featureVersions[feature])
+}
+
+// versionFields describes the target and required version of feature for log messages
+func (g *Generator) versionFields(feature string) []zap.Field {
+	return []zap.Field{
+		zap.String("target_version", g.targetVersion.String()),
+		zap.String("required_version", featureVersions[feature].String()),
+	}
+}
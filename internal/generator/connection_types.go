@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"strings"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// knownConnectionTypes are the connection types accepted by nats-server.
+// An unknown type makes the whole config invalid.
+var knownConnectionTypes = map[string]bool{
+	"STANDARD":    true,
+	"WEBSOCKET":   true,
+	"LEAFNODE":    true,
+	"LEAFNODE_WS": true,
+	"MQTT":        true,
+	"MQTT_WS":     true,
+}
+
+// connectionTypes formats a user's allowed connection types, dropping unknown ones with a
+// warning. It returns an empty string when the user is unrestricted, and false when every
+// listed type is unknown or the target NATS version cannot restrict connection types, so
+// the user is skipped rather than left unrestricted.
+func (g *Generator) connectionTypes(user models.MqttUser) (string, bool) {
+	if len(user.AllowedConnectionTypes) == 0 {
+		return "", true
+	}
+	if !g.supports(featureConnectionTypes) {
+		g.logger.Warn("Target NATS version cannot restrict connection types, skipping user",
+			append(g.versionFields(featureConnectionTypes), zap.String("username", user.Username))...)
+		return "", false
+	}
+
+	seen := make(map[string]bool, len(user.AllowedConnectionTypes))
+	var types []string
+	for _, value := range user.AllowedConnectionTypes {
+		connectionType := strings.ToUpper(strings.TrimSpace(value))
+		if !knownConnectionTypes[connectionType] {
+			g.logger.Warn("Ignoring unknown connection type",
+				zap.String("username", user.Username),
+				zap.String("connection_type", value))
+			continue
+		}
+		if !seen[connectionType] {
+			seen[connectionType] = true
+			types = append(types, `"`+connectionType+`"`)
+		}
+	}
+
+	if len(types) == 0 {
+		g.logger.Warn("User lists only unknown connection types, skipping",
+			zap.String("username", user.Username))
+		return "", false
+	}
+	return "[" + strings.Join(types, ", ") + "]", true
+}
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// Policies for users that share a username
+const (
+	DuplicateUsernameSkip  = "skip"  // Keep the earliest created user and drop the others
+	DuplicateUsernameError = "error" // Abort config generation
+)
+
+// SetDuplicateUsernamePolicy sets how users sharing a username are handled.
+// NATS rejects a config that lists the same username twice.
+func (g *Generator) SetDuplicateUsernamePolicy(policy string) {
+	g.duplicateUsernamePolicy = policy
+}
+
+// dedupeUsers finds users with the same emitted username or nkey. With the skip policy
+// only the earliest created record of each is kept, ties broken by record ID, so the
+// choice does not depend on the order PocketBase returns records in. sources holds the
+// PocketBase record of each user and is filtered alongside.
+func (g *Generator) dedupeUsers(users []models.NatsUser, sources []models.MqttUser) ([]models.NatsUser, []models.MqttUser, error) {
+	users, sources, err := g.dedupeBy("username", users, sources, func(user models.NatsUser) string { return user.Name })
+	if err != nil {
+		return nil, nil, err
+	}
+	// NATS rejects an nkey listed twice as well
+	return g.dedupeBy("nkey", users, sources, func(user models.NatsUser) string { return user.NKey })
+}
+
+// dedupeBy drops users sharing a non-empty key according to the duplicate username policy
+func (g *Generator) dedupeBy(kind string, users []models.NatsUser, sources []models.MqttUser, key func(models.NatsUser) string) ([]models.NatsUser, []models.MqttUser, error) {
+	byName := make(map[string][]int, len(users))
+	var names []string
+	for i, user := range users {
+		name := key(user)
+		if name == "" {
+			continue
+		}
+		if len(byName[name]) == 1 {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], i)
+	}
+	if len(names) == 0 {
+		return users, sources, nil
+	}
+	sort.Strings(names)
+
+	skipped := make(map[int]bool)
+	for _, name := range names {
+		indices := byName[name]
+		sort.Slice(indices, func(a, b int) bool {
+			ca, cb := time.Time(sources[indices[a]].Created), time.Time(sources[indices[b]].Created)
+			if ca.IsZero() != cb.IsZero() {
+				return cb.IsZero() // Records without a created time go last
+			}
+			if !ca.Equal(cb) {
+				return ca.Before(cb)
+			}
+			return sources[indices[a]].ID < sources[indices[b]].ID
+		})
+
+		ids := make([]string, len(indices))
+		for j, i := range indices {
+			ids[j] = sources[i].ID
+		}
+		if g.duplicateUsernamePolicy == DuplicateUsernameError {
+			return nil, nil, fmt.Errorf("duplicate %s %q in records %s", kind, name, strings.Join(ids, ", "))
+		}
+
+		g.logger.Warn("Duplicate "+kind+", keeping the earliest created record",
+			zap.String(kind, name),
+			zap.String("kept_id", ids[0]),
+			zap.Strings("skipped_ids", ids[1:]))
+		for _, i := range indices[1:] {
+			skipped[i] = true
+		}
+	}
+
+	keptUsers := make([]models.NatsUser, 0, len(users)-len(skipped))
+	keptSources := make([]models.MqttUser, 0, len(users)-len(skipped))
+	for i := range users {
+		if !skipped[i] {
+			keptUsers = append(keptUsers, users[i])
+			keptSources = append(keptSources, sources[i])
+		}
+	}
+	return keptUsers, keptSources, nil
+}
@@ -0,0 +1,124 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"nats-pocketbase-sync/internal/models"
+)
+
+func TestDuplicateUsernamePolicy(t *testing.T) {
+	created := func(day int) models.FlexibleTime {
+		return models.FlexibleTime(time.Date(2025, 3, day, 12, 0, 0, 0, time.UTC))
+	}
+	user := func(id, username string, createdAt models.FlexibleTime) models.MqttUser {
+		u := testUser(id, username, "r1")
+		u.Created = createdAt
+		return u
+	}
+
+	tests := []struct {
+		name      string
+		policy    string
+		users     []models.MqttUser
+		wantIDs   []string // Record IDs of the emitted users, in output order
+		wantError []string // Substrings of the expected error, if the generation should fail
+	}{
+		{
+			name:   "skip keeps the earliest created",
+			policy: DuplicateUsernameSkip,
+			users: []models.MqttUser{
+				user("u2", "alice", created(2)),
+				user("u1", "alice", created(1)),
+				user("u3", "bob", created(3)),
+			},
+			wantIDs: []string{"u1", "u3"},
+		},
+		{
+			name:   "skip breaks created ties by record ID",
+			policy: DuplicateUsernameSkip,
+			users: []models.MqttUser{
+				user("u9", "alice", created(1)),
+				user("u4", "alice", created(1)),
+			},
+			wantIDs: []string{"u4"},
+		},
+		{
+			name:   "skip puts records without a created time last",
+			policy: DuplicateUsernameSkip,
+			users: []models.MqttUser{
+				user("u1", "alice", models.FlexibleTime{}),
+				user("u2", "alice", created(5)),
+			},
+			wantIDs: []string{"u2"},
+		},
+		{
+			name:   "empty policy skips",
+			policy: "",
+			users: []models.MqttUser{
+				user("u2", "alice", created(2)),
+				user("u1", "alice", created(1)),
+			},
+			wantIDs: []string{"u1"},
+		},
+		{
+			name:   "skip leaves usernames differing in case alone",
+			policy: DuplicateUsernameSkip,
+			users: []models.MqttUser{
+				user("u1", "alice", created(1)),
+				user("u2", "Alice", created(2)),
+			},
+			wantIDs: []string{"u2", "u1"}, // Sorted by exact username after the case-insensitive tie
+		},
+		{
+			name:   "error names the conflicting records",
+			policy: DuplicateUsernameError,
+			users: []models.MqttUser{
+				user("u2", "alice", created(2)),
+				user("u3", "bob", created(3)),
+				user("u1", "alice", created(1)),
+			},
+			wantError: []string{`duplicate username "alice"`, "u1, u2"},
+		},
+		{
+			name:   "error passes unique usernames",
+			policy: DuplicateUsernameError,
+			users: []models.MqttUser{
+				user("u1", "alice", created(1)),
+				user("u2", "bob", created(2)),
+			},
+			wantIDs: []string{"u1", "u2"},
+		},
+	}
+
+	roles := []models.MqttRole{{ID: "r1", Name: "reader", PublishPermissions: subjects("sensors.>")}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGenerator()
+			g.SetDuplicateUsernamePolicy(tt.policy)
+
+			if len(tt.wantError) > 0 {
+				_, err := g.GenerateConfigData(roles, tt.users)
+				if err == nil {
+					t.Fatal("GenerateConfigData succeeded, want a duplicate username error")
+				}
+				for _, want := range tt.wantError {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q does not contain %q", err, want)
+					}
+				}
+				return
+			}
+
+			data := mustGenerate(t, g, roles, tt.users)
+			var gotIDs []string
+			for _, u := range data.Users {
+				gotIDs = append(gotIDs, u.RecordID)
+			}
+			if strings.Join(gotIDs, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("emitted users %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"nats-pocketbase-sync/internal/models"
+)
+
+// Fixture file names expected inside each fixture directory
+const (
+	FixtureRolesFile  = "roles.json"
+	FixtureUsersFile  = "users.json"
+	FixtureGoldenFile = "expected.conf"
+
+	// Optional golden file for the same records in accounts mode
+	FixtureAccountsGoldenFile = "expected_accounts.conf"
+)
+
+// LoadRoles decodes roles from JSON, accepting either a bare array or a PocketBase list response
+func LoadRoles(r io.Reader) ([]models.MqttRole, error) {
+	return decodeRecords[models.MqttRole](r)
+}
+
+// LoadUsers decodes users from JSON, accepting either a bare array or a PocketBase list response
+func LoadUsers(r io.Reader) ([]models.MqttUser, error) {
+	return decodeRecords[models.MqttUser](r)
+}
+
+// LoadRolesFile loads roles from a JSON file
+func LoadRolesFile(path string) ([]models.MqttRole, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open roles file: %w", err)
+	}
+	defer file.Close()
+
+	return LoadRoles(file)
+}
+
+// LoadUsersFile loads users from a JSON file
+func LoadUsersFile(path string) ([]models.MqttUser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open users file: %w", err)
+	}
+	defer file.Close()
+
+	return LoadUsers(file)
+}
+
+// LoadRawRecordsFile loads records from a JSON file without decoding their fields,
+// accepting either a bare array or a PocketBase list response
+func LoadRawRecordsFile(path string) ([]map[string]interface{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open records file: %w", err)
+	}
+	defer file.Close()
+
+	return decodeRecords[map[string]interface{}](file)
+}
+
+// decodeRecords decodes a list of records from either a JSON array or a PocketBase list response
+func decodeRecords[T any](r io.Reader) ([]T, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read records: %w", err)
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var items []T
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, fmt.Errorf("failed to decode records: %w", err)
+		}
+		return items, nil
+	}
+
+	var listResp models.PocketBaseListResponse[T]
+	if err := json.Unmarshal(data, &listResp); err != nil {
+		return nil, fmt.Errorf("failed to decode list response: %w", err)
+	}
+	return listResp.Items, nil
+}
+
+// CompareGolden compares actual output with the golden file at path.
+// When update is true the golden file is rewritten with the actual output instead.
+func CompareGolden(path, actual string, update bool) error {
+	if update {
+		if err := os.WriteFile(path, []byte(actual), 0644); err != nil {
+			return fmt.Errorf("failed to update golden file: %w", err)
+		}
+		return nil
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read golden file: %w", err)
+	}
+
+	if string(expected) == actual {
+		return nil
+	}
+
+	// Report the first differing line to keep failures readable
+	expectedLines := strings.Split(string(expected), "\n")
+	actualLines := strings.Split(actual, "\n")
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var want, got string
+		if i < len(expectedLines) {
+			want = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			got = actualLines[i]
+		}
+		if want != got {
+			return fmt.Errorf("output differs from %s at line %d:\n  want: %q\n  got:  %q", path, i+1, want, got)
+		}
+	}
+
+	return fmt.Errorf("output differs from %s", path)
+}
@@ -0,0 +1,124 @@
+package generator
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// update rewrites the golden files with the generated output after an intentional change
+var update = flag.Bool("update", false, "rewrite golden files with the generated output")
+
+// Default permissions the golden files were generated with. Users whose role chain and
+// role defaults leave a direction empty get these, so changing them changes the goldens.
+var (
+	fixtureDefaultPublish   interface{} = "PUBLIC.>"
+	fixtureDefaultSubscribe interface{} = []interface{}{"PUBLIC.>", "_INBOX.>"}
+)
+
+// fixture is a set of PocketBase records paired with the NATS config they should produce
+type fixture struct {
+	name       string
+	roles      []models.MqttRole
+	users      []models.MqttUser
+	goldenPath string
+
+	accountsGoldenPath string // Empty when the fixture has no accounts mode golden file
+}
+
+// loadFixtures loads every fixture directory below dir, sorted by name
+func loadFixtures(dir string) ([]fixture, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture directory: %w", err)
+	}
+
+	var fixtures []fixture
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		fixturePath := filepath.Join(dir, entry.Name())
+		roles, err := LoadRolesFile(filepath.Join(fixturePath, FixtureRolesFile))
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", entry.Name(), err)
+		}
+		users, err := LoadUsersFile(filepath.Join(fixturePath, FixtureUsersFile))
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", entry.Name(), err)
+		}
+
+		f := fixture{
+			name:       entry.Name(),
+			roles:      roles,
+			users:      users,
+			goldenPath: filepath.Join(fixturePath, FixtureGoldenFile),
+		}
+		accountsGolden := filepath.Join(fixturePath, FixtureAccountsGoldenFile)
+		if _, err := os.Stat(accountsGolden); err == nil {
+			f.accountsGoldenPath = accountsGolden
+		}
+		fixtures = append(fixtures, f)
+	}
+
+	sort.Slice(fixtures, func(i, j int) bool {
+		return fixtures[i].name < fixtures[j].name
+	})
+
+	return fixtures, nil
+}
+
+// generateFixture generates the fixture's config in the given output mode with the
+// fixture defaults
+func generateFixture(f fixture, outputMode string) (string, error) {
+	g := NewGenerator(fixtureDefaultPublish, fixtureDefaultSubscribe, zap.NewNop())
+	g.SetOutputMode(outputMode)
+	config, err := g.GenerateConfig(f.roles, f.users)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate %s mode config: %w", outputMode, err)
+	}
+	return config, nil
+}
+
+func TestFixtures(t *testing.T) {
+	fixtures, err := loadFixtures("testdata/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures found in testdata/fixtures")
+	}
+
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			goldens := []struct {
+				outputMode string
+				path       string
+			}{
+				{OutputModeAuthorization, f.goldenPath},
+				{OutputModeAccounts, f.accountsGoldenPath},
+			}
+			for _, golden := range goldens {
+				if golden.path == "" {
+					continue
+				}
+				t.Run(golden.outputMode, func(t *testing.T) {
+					config, err := generateFixture(f, golden.outputMode)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := CompareGolden(golden.path, config, *update); err != nil {
+						t.Error(err)
+					}
+				})
+			}
+		})
+	}
+}
@@ -1,10 +1,16 @@
 package generator
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"path"
 	"sort"
 	"strings"
+	"time"
 
+	"nats-pocketbase-sync/internal/fieldcrypt"
 	"nats-pocketbase-sync/internal/models"
 	"go.uber.org/zap"
 )
@@ -14,19 +20,365 @@ type Generator struct {
 	logger            *zap.Logger
 	defaultPublish    interface{}
 	defaultSubscribe  interface{}
+	forceInclude      []models.MqttUser
+	excludeUsers      map[string]bool
+	passwordCipher    *fieldcrypt.Cipher
+	logSummary        bool
+	permissionPolicy  PermissionPolicy
+	monitoringUser    *MonitoringUser
+	outputMode        string
+	mappings          map[string][]models.SubjectMapping
+	transforms        []ConfigTransform
+	annotateRoles     bool
+	secretsInclude    string // Include path of the secrets file, empty to inline passwords
+	secretsFile       string // Secrets file rendered by the last generation
+	onEmptyCredential string // What to do with users that have an empty username or password
+	systemAccount     string // Account emitted as system_account in accounts mode
+	skipExpired       bool          // Leave out users whose expires_at has passed
+	expiryWarning     time.Duration // Warn about users expiring within this window, 0 to disable
+	usernamePrefix    string // Prepended to every emitted PocketBase username
+	usernameSuffix    string // Appended to every emitted PocketBase username
+	leafnodePort      int    // Port of the generated leafnodes block, 0 to disable
+	accountOrder      string // How accounts are ordered in accounts mode
+	groupAccounts     bool   // Cluster accounts by role group with separator comments
+	targetVersion     NatsVersion // NATS server version the config is generated for
+	schemaVersion     int         // Schema version marked in the config, 0 for no marker
+	wrapAccount       string      // Account wrapping all users in authorization mode, empty for a flat block
+	authToken         string      // Shared token replacing users in authorization mode, empty to disable
+	subjectPrefix     string      // Prefix every PocketBase subject must start with, empty to disable
+	subjectPrefixMode string      // Whether subjects outside the prefix fail generation or are prefixed
+	hashPasswords     bool              // Emit user passwords as bcrypt hashes
+	passwordHashCost  int               // bcrypt cost of new hashes
+	passwordHashes    map[string]string // Hash per user and password, see passwordCacheKey
+	passwordSeeds     map[string]string // Hashes on disk by username, see SeedPasswordHashes
+	duplicateUsernamePolicy string // What to do with users that share a username
+	invalidSubjectPolicy    string // What to do with roles and users granting a malformed subject
+}
+
+// ConfigTransform adjusts the config data after it is built from PocketBase and before it is rendered.
+// Returning an error aborts config generation.
+type ConfigTransform func(data *models.NatsConfigData) error
+
+// Actions for users with an empty username or password
+const (
+	EmptyCredentialAllow = "allow" // Emit the user as is
+	EmptyCredentialSkip  = "skip"  // Drop the user with a warning
+	EmptyCredentialFail  = "fail"  // Abort config generation
+)
+
+// Output modes for the generated config
+const (
+	OutputModeAuthorization = "authorization"
+	OutputModeAccounts      = "accounts"
+)
+
+// Account orders for accounts mode
+const (
+	AccountOrderName     = "name"     // Alphabetical by account name
+	AccountOrderPriority = "priority" // By the role's sort_order, then name
+)
+
+// MonitoringUser is a static read-only user emitted into the system account,
+// independent of PocketBase state
+type MonitoringUser struct {
+	Account   string
+	Username  string
+	Password  string
+	Subscribe []string
 }
 
 // NewGenerator creates a new Generator
 func NewGenerator(defaultPublish, defaultSubscribe interface{}, logger *zap.Logger) *Generator {
 	return &Generator{
-		logger:           logger,
-		defaultPublish:   defaultPublish,
-		defaultSubscribe: defaultSubscribe,
+		logger:            logger,
+		defaultPublish:    defaultPublish,
+		defaultSubscribe:  defaultSubscribe,
+		outputMode:        OutputModeAuthorization,
+		accountOrder:      AccountOrderName,
+		onEmptyCredential: EmptyCredentialAllow,
+		duplicateUsernamePolicy: DuplicateUsernameSkip,
+		invalidSubjectPolicy:    InvalidSubjectSkip,
+		skipExpired:       true,
+		targetVersion:     defaultTargetVersion,
+	}
+}
+
+// SetUserOverrides configures usernames that are always included or always excluded
+// regardless of PocketBase state. Force-included users reference their role by ID or name.
+func (g *Generator) SetUserOverrides(forceInclude []models.MqttUser, excludeUsers []string) {
+	g.forceInclude = forceInclude
+	g.excludeUsers = make(map[string]bool, len(excludeUsers))
+	for _, username := range excludeUsers {
+		g.excludeUsers[username] = true
+	}
+}
+
+// SetPasswordCipher sets the cipher used to decrypt encrypted password fields
+func (g *Generator) SetPasswordCipher(c *fieldcrypt.Cipher) {
+	g.passwordCipher = c
+}
+
+// SetMonitoringUser sets the static monitoring user emitted into the system account
+func (g *Generator) SetMonitoringUser(user MonitoringUser) {
+	g.monitoringUser = &user
+}
+
+// SetOutputMode sets whether users are emitted in a flat authorization block or one account per role
+func (g *Generator) SetOutputMode(mode string) {
+	g.outputMode = mode
+}
+
+// SetWrapAccount emits the users of authorization mode inside a single account of the given
+// name instead of the flat authorization block. Empty keeps the authorization block.
+func (g *Generator) SetWrapAccount(account string) {
+	g.wrapAccount = account
+}
+
+// SetExpiry sets whether users past their expires_at are left out, and how far ahead
+// upcoming expiries are logged as warnings (0 disables the warning)
+func (g *Generator) SetExpiry(skipExpired bool, warnWithin time.Duration) {
+	g.skipExpired = skipExpired
+	g.expiryWarning = warnWithin
+}
+
+// SetUsernameAffixes sets a prefix and suffix added to every username emitted from PocketBase,
+// so one PocketBase can drive several environments with namespaced users, e.g. "prod.alice".
+// Exclusions and force-included users are matched on the bare username.
+func (g *Generator) SetUsernameAffixes(prefix, suffix string) {
+	g.usernamePrefix = prefix
+	g.usernameSuffix = suffix
+}
+
+// SetAccountOrdering sets how accounts are ordered in accounts mode and whether they are
+// grouped by the role's group field, each group introduced by a separator comment
+func (g *Generator) SetAccountOrdering(order string, group bool) {
+	g.accountOrder = order
+	g.groupAccounts = group
+}
+
+// SetLeafnodes enables a hub-side leafnodes block listening on port, authenticating
+// users flagged as leaf in PocketBase. Zero disables the block.
+func (g *Generator) SetLeafnodes(port int) {
+	g.leafnodePort = port
+}
+
+// SetSystemAccount sets the account emitted as the NATS system_account in accounts mode.
+// It must name a generated account or the monitoring user's account.
+func (g *Generator) SetSystemAccount(account string) {
+	g.systemAccount = account
+}
+
+// AddTransform appends a transform to the chain applied to the config data before rendering.
+// Transforms run in the order they were added.
+func (g *Generator) AddTransform(transform ConfigTransform) {
+	g.transforms = append(g.transforms, transform)
+}
+
+// SetAnnotateRoles enables emitting role descriptions and metadata as comments above each role
+func (g *Generator) SetAnnotateRoles(enabled bool) {
+	g.annotateRoles = enabled
+}
+
+// SetSecretsInclude moves passwords into variables defined in a separate secrets file,
+// which the main config includes from path. The rendered secrets file is available
+// from SecretsFile after each generation.
+func (g *Generator) SetSecretsInclude(path string) {
+	g.secretsInclude = path
+}
+
+// SecretsFile returns the secrets file rendered by the most recent generation
+func (g *Generator) SecretsFile() string {
+	return g.secretsFile
+}
+
+// SetEmptyCredentialAction sets how users with an empty username or password are handled
+func (g *Generator) SetEmptyCredentialAction(action string) {
+	g.onEmptyCredential = action
+}
+
+// SetLogSummary enables logging a per-role user count summary for each generated config
+func (g *Generator) SetLogSummary(enabled bool) {
+	g.logSummary = enabled
+}
+
+// logRoleSummary logs how many users reference each role
+func (g *Generator) logRoleSummary(configData *models.NatsConfigData) {
+	counts := make(map[string]int, len(configData.Roles))
+	for _, role := range configData.Roles {
+		counts[role.Name] = 0
+	}
+	for _, user := range configData.Users {
+		counts[user.RoleName]++
+	}
+
+	var emptyRoles []string
+	for _, role := range configData.Roles {
+		if counts[role.Name] == 0 {
+			emptyRoles = append(emptyRoles, role.Name)
+		}
+	}
+
+	g.logger.Info("Role summary",
+		zap.Any("users_per_role", counts),
+		zap.Strings("roles_without_users", emptyRoles),
+		zap.Int("total_roles", len(configData.Roles)),
+		zap.Int("total_users", len(configData.Users)))
+}
+
+// applyUserOverrides drops excluded users and merges in force-included users
+func (g *Generator) applyUserOverrides(users []models.MqttUser, roles []models.MqttRole) []models.MqttUser {
+	if len(g.forceInclude) == 0 && len(g.excludeUsers) == 0 {
+		return users
+	}
+
+	result := make([]models.MqttUser, 0, len(users)+len(g.forceInclude))
+	present := make(map[string]bool, len(users))
+	for _, user := range users {
+		if g.excludeUsers[user.Username] {
+			g.logger.Info("Excluding user by configuration", zap.String("username", user.Username))
+			continue
+		}
+		present[user.Username] = true
+		result = append(result, user)
+	}
+
+	for _, forced := range g.forceInclude {
+		if g.excludeUsers[forced.Username] {
+			g.logger.Warn("Force-included user is also excluded, skipping", zap.String("username", forced.Username))
+			continue
+		}
+		if present[forced.Username] {
+			g.logger.Debug("Force-included user already present in PocketBase", zap.String("username", forced.Username))
+			continue
+		}
+
+		// Allow the static definition to reference a role by name instead of ID
+		for _, role := range roles {
+			if forced.RoleID == role.Name || forced.RoleID == role.NormalizeRoleName() {
+				forced.RoleID = role.ID
+				break
+			}
+		}
+
+		g.logger.Info("Force-including user by configuration", zap.String("username", forced.Username))
+		present[forced.Username] = true
+		result = append(result, forced)
 	}
+
+	return result
 }
 
 // GenerateConfig generates NATS configuration from PocketBase data
 func (g *Generator) GenerateConfig(roles []models.MqttRole, users []models.MqttUser) (string, error) {
+	configData, err := g.buildConfigData(roles, users)
+	if err != nil {
+		return "", err
+	}
+
+	return g.RenderConfig(configData)
+}
+
+// GenerateConfigData builds the structured config from PocketBase data without rendering it,
+// so callers can inspect users, roles and accounts programmatically.
+// The result can be rendered with RenderConfig.
+func (g *Generator) GenerateConfigData(roles []models.MqttRole, users []models.MqttUser) (*models.NatsConfigData, error) {
+	return g.buildConfigData(roles, users)
+}
+
+// GenerateSplitConfig generates the main NATS configuration plus one include file per account.
+// The main config includes each account file from includeDir, relative to the main config file.
+// The returned map is keyed by account name.
+func (g *Generator) GenerateSplitConfig(roles []models.MqttRole, users []models.MqttUser, includeDir string) (string, map[string]string, error) {
+	if g.outputMode != OutputModeAccounts {
+		return "", nil, fmt.Errorf("splitting by account requires the accounts output mode")
+	}
+
+	configData, err := g.buildConfigData(roles, users)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Move each account into its own file and reference it from the main config
+	accountFiles := make(map[string]string, len(configData.Accounts))
+	for i := range configData.Accounts {
+		account := &configData.Accounts[i]
+		content, err := models.FormatAccountFile(account)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to format account %s: %w", account.Name, err)
+		}
+		accountFiles[account.Name] = content
+		configData.AccountIncludes = append(configData.AccountIncludes, path.Join(includeDir, account.Name+".conf"))
+	}
+	configData.Accounts = nil
+
+	config, err := g.RenderConfig(configData)
+	if err != nil {
+		return "", nil, err
+	}
+	return config, accountFiles, nil
+}
+
+// RenderConfig formats the config data and logs what was generated
+func (g *Generator) RenderConfig(configData *models.NatsConfigData) (string, error) {
+	// Generate the NATS config
+	config, err := models.FormatConfigFile(configData)
+	if err != nil {
+		return "", fmt.Errorf("failed to format NATS config: %w", err)
+	}
+
+	if configData.SecretsInclude != "" {
+		g.secretsFile, err = models.FormatSecretsFile(configData.Secrets)
+		if err != nil {
+			return "", fmt.Errorf("failed to format secrets file: %w", err)
+		}
+	}
+
+	g.logger.Info("Generated NATS configuration",
+		zap.Int("roleCount", len(configData.Roles)),
+		zap.Int("userCount", len(configData.Users)))
+
+	if g.logSummary {
+		g.logRoleSummary(configData)
+	}
+
+	return config, nil
+}
+
+// buildConfigData builds the template data from PocketBase roles and users
+func (g *Generator) buildConfigData(roles []models.MqttRole, users []models.MqttUser) (*models.NatsConfigData, error) {
+	// Keep PocketBase permissions inside the environment's subject prefix
+	roles, users, err := g.ApplySubjectPrefix(roles, users)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extend roles with the permissions of their parents
+	roles = g.InheritPermissions(roles)
+
+	// Drop roles that are staged but not enabled yet, and roles granting subjects NATS would reject
+	enabledRoles := make([]models.MqttRole, 0, len(roles))
+	disabledRoles := make(map[string]bool)
+	invalidRoles := make(map[string]bool)
+	for _, role := range roles {
+		if !role.IsEnabled() {
+			disabledRoles[role.ID] = true
+			continue
+		}
+		if invalid := checkRoleSubjects(role); len(invalid) > 0 {
+			if err := g.rejectInvalidSubjects("role", role.Name, invalid); err != nil {
+				return nil, err
+			}
+			g.logger.Warn("Role has invalid subjects, skipping it and its users", zap.String("role", role.Name))
+			invalidRoles[role.ID] = true
+			continue
+		}
+		enabledRoles = append(enabledRoles, role)
+	}
+	if len(disabledRoles) > 0 {
+		g.logger.Info("Skipped disabled roles", zap.Int("count", len(disabledRoles)))
+	}
+	roles = enabledRoles
+
 	// Create role map for easy lookup
 	roleMap := make(map[string]models.MqttRole)
 	for _, role := range roles {
@@ -47,28 +399,83 @@ func (g *Generator) GenerateConfig(roles []models.MqttRole, users []models.MqttU
 	// Log permissions parsing
 	g.logger.Debug("Parsing role permissions from JSON fields")
 
-	// Add roles
+	// Add roles, falling back to the role default and then the global default
+	// for each direction the role leaves empty
+	rolePermissions := make(map[string]models.NatsRole, len(roles))
 	for _, role := range roles {
+		// Surface broken permission data instead of silently treating it as empty
+		g.warnMalformedPermissions("role", role.Name, role.PublishPermissions, "publish_permissions")
+		g.warnMalformedPermissions("role", role.Name, role.SubscribePermissions, "subscribe_permissions")
+		g.warnMalformedPermissions("role", role.Name, role.DefaultPublishPermissions, "default_publish_permissions")
+		g.warnMalformedPermissions("role", role.Name, role.DefaultSubscribePermissions, "default_subscribe_permissions")
+		g.warnMalformedPermissions("role", role.Name, role.PublishDenyPermissions, "publish_deny")
+		g.warnMalformedPermissions("role", role.Name, role.SubscribeDenyPermissions, "subscribe_deny")
+		if _, err := role.GetAllowResponses(); err != nil {
+			g.logger.Warn("Malformed allow_responses field, ignoring it",
+				zap.String("role", role.Name),
+				zap.Error(err))
+		}
+		g.warnUserLimits(role)
+
 		// Format permissions with error handling
-		pubPerms := role.FormatPublishPermissions()
-		subPerms := role.FormatSubscribePermissions()
+		pubPerms := firstPermission(
+			role.FormatPublishPermissions(),
+			models.FormatPermissionList(models.ParsePermissions(role.DefaultPublishPermissions)),
+			defaultPublishStr)
+		subPerms := firstPermission(
+			role.FormatSubscribePermissions(),
+			models.FormatPermissionList(models.ParsePermissions(role.DefaultSubscribePermissions)),
+			defaultSubscribeStr)
+
+		// Deny lists narrow whichever allow list applies
+		pubDeny := role.FormatPublishDenyPermissions()
+		subDeny := role.FormatSubscribeDenyPermissions()
+		pubPerms = models.FormatPermissionBlock(pubPerms, pubDeny)
+		subPerms = models.FormatPermissionBlock(subPerms, subDeny)
 		
 		g.logger.Debug("Formatted role permissions",
 			zap.String("role", role.Name),
 			zap.String("publish", pubPerms),
 			zap.String("subscribe", subPerms))
 		
-		configData.Roles = append(configData.Roles, models.NatsRole{
+		natsRole := models.NatsRole{
 			Name:                role.NormalizeRoleName(),
 			PublishPermissions:  pubPerms,
 			SubscribePermissions: subPerms,
-		})
+			PublishDeny:         pubDeny,
+			SubscribeDeny:       subDeny,
+			AllowResponses:      role.FormatAllowResponses(),
+			SortOrder:           role.SortOrder,
+			Group:               strings.TrimSpace(role.Group),
+			Limits:              g.accountLimits(role),
+		}
+		if g.annotateRoles {
+			natsRole.Comments = roleComments(role)
+		}
+		configData.Roles = append(configData.Roles, natsRole)
+		rolePermissions[role.ID] = natsRole
 	}
 
+	// Apply configured include/exclude overrides
+	users = g.applyUserOverrides(users, roles)
+
 	// Add users
+	var records []models.MqttUser // PocketBase record of each user, for deduplication
 	for i, user := range users {
 		// Find the role for this user
 		role, ok := roleMap[user.RoleID]
+		if !ok && disabledRoles[user.RoleID] {
+			g.logger.Warn("User has disabled role, skipping",
+				zap.String("username", user.Username),
+				zap.String("role_id", user.RoleID))
+			continue
+		}
+		if !ok && invalidRoles[user.RoleID] {
+			g.logger.Warn("User has a role with invalid subjects, skipping",
+				zap.String("username", user.Username),
+				zap.String("role_id", user.RoleID))
+			continue
+		}
 		if !ok {
 			g.logger.Warn("User has unknown role ID, skipping", 
 				zap.String("username", user.Username), 
@@ -76,23 +483,151 @@ func (g *Generator) GenerateConfig(roles []models.MqttRole, users []models.MqttU
 			continue
 		}
 
+		// Enforce time-limited access
+		if expiresAt := user.ExpiresAt.Time(); !expiresAt.IsZero() {
+			remaining := time.Until(expiresAt)
+			switch {
+			case remaining <= 0 && g.skipExpired:
+				g.logger.Info("User has expired, skipping",
+					zap.String("username", user.Username),
+					zap.Time("expires_at", expiresAt))
+				continue
+			case remaining <= 0:
+				g.logger.Warn("User has expired but expired users are not skipped",
+					zap.String("username", user.Username),
+					zap.Time("expires_at", expiresAt))
+			case remaining <= g.expiryWarning:
+				g.logger.Warn("User expires soon",
+					zap.String("username", user.Username),
+					zap.Time("expires_at", expiresAt),
+					zap.Duration("remaining", remaining))
+			}
+		}
+
+		// NATS rejects a username listed twice, so only the current password can be valid
+		if user.PreviousPassword != "" {
+			g.logger.Debug("Ignoring previous password, NATS accepts one password per user",
+				zap.String("username", user.Username))
+		}
+
+		// Authenticate with the nkey instead of a password when the user has one
+		nkey, ok := g.userNKey(user)
+		if !ok {
+			continue
+		}
+
+		// Decrypt the password if it is stored encrypted
+		password := user.Password
+		if nkey != "" {
+			password = ""
+		} else if g.passwordCipher != nil {
+			decrypted, err := g.passwordCipher.Decrypt(password)
+			if err != nil {
+				g.logger.Error("Failed to decrypt user password, skipping",
+					zap.String("username", user.Username),
+					zap.Error(err))
+				continue
+			}
+			password = decrypted
+		} else if fieldcrypt.IsEncrypted(password) {
+			g.logger.Error("User password is encrypted but no field key is configured, skipping",
+				zap.String("username", user.Username))
+			continue
+		}
+
+		// Never emit a passwordless or nameless user by accident
+		if strings.TrimSpace(user.Username) == "" || (nkey == "" && strings.TrimSpace(password) == "") {
+			switch g.onEmptyCredential {
+			case EmptyCredentialFail:
+				return nil, fmt.Errorf("user %q (id %s) has an empty username or password", user.Username, user.ID)
+			case EmptyCredentialSkip:
+				g.logger.Warn("User has an empty username or password, skipping",
+					zap.String("username", user.Username),
+					zap.String("id", user.ID))
+				continue
+			}
+		}
+
+		// Restrict how the user may connect
+		connectionTypes, ok := g.connectionTypes(user)
+		if !ok {
+			continue
+		}
+
+		// Inline user permissions take precedence over the role's
+		g.warnMalformedPermissions("user", user.Username, user.PublishPermissions, "publish_permissions")
+		g.warnMalformedPermissions("user", user.Username, user.SubscribePermissions, "subscribe_permissions")
+		if invalid := checkUserSubjects(user); len(invalid) > 0 {
+			if err := g.rejectInvalidSubjects("user", user.Username, invalid); err != nil {
+				return nil, err
+			}
+			g.logger.Warn("User has invalid subjects, skipping", zap.String("username", user.Username))
+			continue
+		}
+		userPub := models.FormatPermissionList(models.ParsePermissions(user.PublishPermissions))
+		userSub := models.FormatPermissionList(models.ParsePermissions(user.SubscribePermissions))
+		resolved := rolePermissions[role.ID]
+
+		// Namespace the username for this environment
+		username := g.usernamePrefix + user.Username + g.usernameSuffix
+
 		// Add user to config
 		configData.Users = append(configData.Users, models.NatsUser{
-			Username: fmt.Sprintf("\"%s\"", user.Username),
-			Password: user.Password,
+			Username: fmt.Sprintf("\"%s\"", username),
+			Name:     username,
+			RecordID: user.ID,
+			Password: password,
+			NKey:     nkey,
 			RoleName: role.NormalizeRoleName(),
 			IsLast:   i == len(users)-1,
+			Leaf:     user.Leaf,
+			AllowedConnectionTypes: connectionTypes,
+
+			PublishPermissions:   userPermission(userPub, resolved.PublishPermissions, resolved.PublishDeny),
+			SubscribePermissions: userPermission(userSub, resolved.SubscribePermissions, resolved.SubscribeDeny),
+			InlinePermissions:    userPub != emptyPermission || userSub != emptyPermission,
+			AllowResponses:       resolved.AllowResponses,
 		})
+		records = append(records, user)
+	}
+
+	// NATS rejects a username listed twice
+	configData.Users, _, err = g.dedupeUsers(configData.Users, records)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash passwords before the users are copied into accounts, leafnodes and secrets
+	if err := g.hashUserPasswords(configData.Users); err != nil {
+		return nil, err
 	}
 	
+	// Add the static monitoring user
+	if g.monitoringUser != nil {
+		configData.MonitoringUser = &models.NatsMonitoringUser{
+			Account:              g.monitoringUser.Account,
+			Username:             fmt.Sprintf("\"%s\"", g.monitoringUser.Username),
+			Password:             g.monitoringUser.Password,
+			SubscribePermissions: models.FormatPermissionList(g.monitoringUser.Subscribe),
+		}
+	}
+
 	// Sort roles by name for deterministic output
 	sort.Slice(configData.Roles, func(i, j int) bool {
 		return configData.Roles[i].Name < configData.Roles[j].Name
 	})
 
-	// Sort users by username for deterministic output
+	// Sort users by username for deterministic output, breaking ties between
+	// usernames that differ only in case, or are duplicated, by record ID
 	sort.Slice(configData.Users, func(i, j int) bool {
-		return strings.ToLower(configData.Users[i].Username) < strings.ToLower(configData.Users[j].Username)
+		a, b := configData.Users[i], configData.Users[j]
+		if la, lb := strings.ToLower(a.Username), strings.ToLower(b.Username); la != lb {
+			return la < lb
+		}
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		return a.RecordID < b.RecordID
 	})
 
 	// Update IsLast flag based on new order
@@ -100,15 +635,244 @@ func (g *Generator) GenerateConfig(roles []models.MqttRole, users []models.MqttU
 		configData.Users[i].IsLast = (i == len(configData.Users)-1)
 	}
 
-	// Generate the NATS config
-	config, err := models.FormatConfigFile(configData)
-	if err != nil {
-		return "", fmt.Errorf("failed to format NATS config: %w", err)
+	configData.SchemaVersion = g.schemaVersion
+
+	// Reference passwords through variables defined in the secrets file
+	if g.secretsInclude != "" {
+		configData.SecretsInclude = g.secretsInclude
+		for i := range configData.Users {
+			user := &configData.Users[i]
+			if user.NKey != "" {
+				continue
+			}
+			user.PasswordVar = secretVarName(user.Name)
+			configData.Secrets = append(configData.Secrets, models.NatsSecret{Name: user.PasswordVar, Value: user.Password})
+		}
+		if mu := configData.MonitoringUser; mu != nil {
+			mu.PasswordVar = secretVarName(g.monitoringUser.Username)
+			configData.Secrets = append(configData.Secrets, models.NatsSecret{Name: mu.PasswordVar, Value: mu.Password})
+		}
 	}
 
-	g.logger.Info("Generated NATS configuration",
-		zap.Int("roleCount", len(configData.Roles)),
-		zap.Int("userCount", len(configData.Users)))
+	// Group users into one account per role, or wrap them all in one account
+	if g.outputMode == OutputModeAccounts {
+		configData.AccountsMode = true
+		configData.Accounts = buildAccounts(configData.Roles, configData.Users)
+		g.sortAccounts(configData.Accounts)
+		for _, role := range roles {
+			mappings := g.buildMappings(role)
+			for i := range configData.Accounts {
+				if configData.Accounts[i].Name == role.NormalizeRoleName() {
+					configData.Accounts[i].Mappings = mappings
+				}
+			}
+		}
+	} else {
+		// Keep the flat users, with their resolved permissions inlined
+		configData.WrapAccount = g.wrapAccount
+	}
 
-	return config, nil
+	// Let leaf-flagged users authenticate leafnode connections
+	if g.leafnodePort > 0 {
+		configData.Leafnodes = g.buildLeafnodes(configData)
+	}
+
+	// Apply custom transforms last so they see the complete data
+	for i, transform := range g.transforms {
+		if err := transform(configData); err != nil {
+			return nil, fmt.Errorf("config transform %d failed: %w", i+1, err)
+		}
+	}
+
+	// Swap users for the shared token once transforms can no longer add any
+	if err := g.applyAuthToken(configData); err != nil {
+		return nil, err
+	}
+
+	// Enforce the permission policy on the final data, so transforms can't grant around it
+	if err := g.checkPermissionPolicy(configData); err != nil {
+		return nil, err
+	}
+
+	// Designate the system account once all accounts are known
+	if g.outputMode == OutputModeAccounts && g.systemAccount != "" {
+		if !hasAccount(configData, g.systemAccount) {
+			return nil, fmt.Errorf("system account %q is not a generated account or the monitoring account", g.systemAccount)
+		}
+		configData.SystemAccount = g.systemAccount
+	}
+
+	return configData, nil
+}
+
+// warnMalformedPermissions logs a permission field that is set but is not a list of subjects.
+// Such fields are treated as empty, so the next level of the precedence chain applies.
+func (g *Generator) warnMalformedPermissions(kind, name string, field json.RawMessage, fieldName string) {
+	if err := models.CheckPermissions(field); err != nil {
+		g.logger.Warn("Malformed permission field, treating it as empty",
+			zap.String(kind, name),
+			zap.String("field", fieldName),
+			zap.Error(err))
+	}
+}
+
+// emptyPermission is the formatted value of an empty permission list
+const emptyPermission = `""`
+
+// firstPermission returns the first non-empty formatted permission in precedence order
+func firstPermission(candidates ...string) string {
+	for _, candidate := range candidates {
+		if candidate != "" && candidate != emptyPermission {
+			return candidate
+		}
+	}
+	return emptyPermission
+}
+
+// userPermission returns the user's inline subjects, still narrowed by the role's deny
+// list, or the role's permission when the user has none
+func userPermission(inline, rolePermission, roleDeny string) string {
+	if inline == "" || inline == emptyPermission {
+		return rolePermission
+	}
+	return models.FormatPermissionBlock(inline, roleDeny)
+}
+
+// secretVarName derives a stable password variable name from a username. The hash
+// suffix keeps names unique when sanitizing maps different usernames to the same text.
+func secretVarName(username string) string {
+	var name strings.Builder
+	for _, char := range strings.ToUpper(username) {
+		if (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') {
+			name.WriteRune(char)
+		} else {
+			name.WriteRune('_')
+		}
+	}
+	sum := sha256.Sum256([]byte(username))
+	return "PASSWORD_" + name.String() + "_" + hex.EncodeToString(sum[:4])
+}
+
+// roleComments formats a role's description and metadata as single-line comments.
+// Comments are ignored by change detection, so annotations never trigger a reload.
+func roleComments(role models.MqttRole) []string {
+	var comments []string
+	if description := commentText(role.Description); description != "" {
+		comments = append(comments, description)
+	}
+
+	keys := make([]string, 0, len(role.Metadata))
+	for key := range role.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := commentText(fmt.Sprint(role.Metadata[key]))
+		if value == "" {
+			continue
+		}
+		comments = append(comments, commentText(key)+": "+value)
+	}
+	return comments
+}
+
+// commentText collapses text onto one line so it cannot escape the comment
+func commentText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// buildLeafnodes collects the leaf-flagged users for the leafnodes block
+func (g *Generator) buildLeafnodes(configData *models.NatsConfigData) *models.NatsLeafnodes {
+	leafnodes := &models.NatsLeafnodes{
+		Port:         g.leafnodePort,
+		AccountsMode: configData.AccountsMode,
+		Account:      configData.WrapAccount,
+	}
+	for _, user := range configData.Users {
+		if !user.Leaf {
+			continue
+		}
+		if user.NKey != "" {
+			g.logger.Warn("Leaf user authenticates with an nkey, which leafnode authorization does not support, leaving it out of leafnodes",
+				zap.String("username", user.Name))
+			continue
+		}
+		// A leafnode user without a password would let any edge server connect
+		if strings.TrimSpace(user.Password) == "" {
+			g.logger.Warn("Leaf user has an empty password, leaving it out of leafnodes",
+				zap.String("username", user.Name))
+			continue
+		}
+		leafnodes.Users = append(leafnodes.Users, user)
+	}
+	for i := range leafnodes.Users {
+		leafnodes.Users[i].IsLast = i == len(leafnodes.Users)-1
+	}
+
+	g.logger.Debug("Built leafnode users", zap.Int("count", len(leafnodes.Users)))
+	return leafnodes
+}
+
+// hasAccount reports whether the config data emits an account with the given name
+func hasAccount(configData *models.NatsConfigData, name string) bool {
+	if configData.MonitoringUser != nil && configData.MonitoringUser.Account == name {
+		return true
+	}
+	for _, account := range configData.Accounts {
+		if account.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// buildAccounts groups the sorted users into one account per role
+func buildAccounts(roles []models.NatsRole, users []models.NatsUser) []models.NatsAccount {
+	accounts := make([]models.NatsAccount, 0, len(roles))
+	for _, role := range roles {
+		account := models.NatsAccount{
+			Name:                 role.Name,
+			PublishPermissions:   role.PublishPermissions,
+			SubscribePermissions: role.SubscribePermissions,
+			Comments:             role.Comments,
+			SortOrder:            role.SortOrder,
+			Group:                role.Group,
+			Limits:               role.Limits,
+		}
+		for _, user := range users {
+			if user.RoleName == role.Name {
+				account.Users = append(account.Users, user)
+			}
+		}
+
+		// IsLast is relative to the account's own user list
+		for i := range account.Users {
+			account.Users[i].IsLast = (i == len(account.Users)-1)
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// sortAccounts orders accounts by group (ungrouped last) when grouping, then by
+// priority when configured, then by name, and recomputes the position flags
+func (g *Generator) sortAccounts(accounts []models.NatsAccount) {
+	sort.SliceStable(accounts, func(i, j int) bool {
+		a, b := accounts[i], accounts[j]
+		if g.groupAccounts && a.Group != b.Group {
+			if a.Group == "" || b.Group == "" {
+				return b.Group == ""
+			}
+			return a.Group < b.Group
+		}
+		if g.accountOrder == AccountOrderPriority && a.SortOrder != b.SortOrder {
+			return a.SortOrder < b.SortOrder
+		}
+		return a.Name < b.Name
+	})
+
+	for i := range accounts {
+		accounts[i].IsLast = i == len(accounts)-1
+		accounts[i].GroupHeader = g.groupAccounts && (i == 0 || accounts[i].Group != accounts[i-1].Group)
+	}
 }
@@ -0,0 +1,158 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newTestGenerator returns a generator with the global defaults used throughout the tests
+func newTestGenerator() *Generator {
+	return NewGenerator("GLOBAL.pub", []interface{}{"GLOBAL.sub", "_INBOX.>"}, zap.NewNop())
+}
+
+// newObservedGenerator is newTestGenerator with the log entries at or above level recorded
+func newObservedGenerator(level zapcore.Level) (*Generator, *observer.ObservedLogs) {
+	core, logs := observer.New(level)
+	return NewGenerator("GLOBAL.pub", []interface{}{"GLOBAL.sub", "_INBOX.>"}, zap.New(core)), logs
+}
+
+// subjects encodes a permission list the way PocketBase returns a JSON field
+func subjects(list ...string) json.RawMessage {
+	if list == nil {
+		list = []string{}
+	}
+	data, _ := json.Marshal(list)
+	return data
+}
+
+// testUser returns an active user in the given role with a password derived from its ID
+func testUser(id, username, roleID string) models.MqttUser {
+	return models.MqttUser{ID: id, Username: username, Password: "secret-" + id, RoleID: roleID, Active: true}
+}
+
+// mustGenerate builds the config data for the records, failing the test on error
+func mustGenerate(t *testing.T, g *Generator, roles []models.MqttRole, users []models.MqttUser) *models.NatsConfigData {
+	t.Helper()
+	data, err := g.GenerateConfigData(roles, users)
+	if err != nil {
+		t.Fatalf("GenerateConfigData: %v", err)
+	}
+	return data
+}
+
+func TestPermissionPrecedence(t *testing.T) {
+	tests := []struct {
+		name          string
+		role          models.MqttRole
+		user          models.MqttUser
+		wantPublish   string
+		wantSubscribe string
+		wantInline    bool
+	}{
+		{
+			name:          "global default",
+			role:          models.MqttRole{},
+			wantPublish:   `"GLOBAL.pub"`,
+			wantSubscribe: `["GLOBAL.sub", "_INBOX.>"]`,
+		},
+		{
+			name: "role default over global default",
+			role: models.MqttRole{
+				DefaultPublishPermissions:   subjects("ROLEDEFAULT.pub"),
+				DefaultSubscribePermissions: subjects("ROLEDEFAULT.sub"),
+			},
+			wantPublish:   `"ROLEDEFAULT.pub"`,
+			wantSubscribe: `"ROLEDEFAULT.sub"`,
+		},
+		{
+			name: "role over role default",
+			role: models.MqttRole{
+				PublishPermissions:          subjects("ROLE.pub"),
+				SubscribePermissions:        subjects("ROLE.sub.>", "ROLE.events"),
+				DefaultPublishPermissions:   subjects("ROLEDEFAULT.pub"),
+				DefaultSubscribePermissions: subjects("ROLEDEFAULT.sub"),
+			},
+			wantPublish:   `"ROLE.pub"`,
+			wantSubscribe: `["ROLE.sub.>", "ROLE.events"]`,
+		},
+		{
+			name: "user inline over role",
+			role: models.MqttRole{
+				PublishPermissions:   subjects("ROLE.pub"),
+				SubscribePermissions: subjects("ROLE.sub"),
+			},
+			user: models.MqttUser{
+				PublishPermissions:   subjects("USER.pub"),
+				SubscribePermissions: subjects("USER.sub"),
+			},
+			wantPublish:   `"USER.pub"`,
+			wantSubscribe: `"USER.sub"`,
+			wantInline:    true,
+		},
+		{
+			name: "user inline in one direction keeps the role chain for the other",
+			role: models.MqttRole{
+				DefaultSubscribePermissions: subjects("ROLEDEFAULT.sub"),
+			},
+			user: models.MqttUser{
+				PublishPermissions: subjects("USER.pub"),
+			},
+			wantPublish:   `"USER.pub"`,
+			wantSubscribe: `"ROLEDEFAULT.sub"`,
+			wantInline:    true,
+		},
+		{
+			name: "empty lists fall through every level",
+			role: models.MqttRole{
+				PublishPermissions:          subjects(),
+				SubscribePermissions:        json.RawMessage("null"),
+				DefaultPublishPermissions:   subjects(),
+				DefaultSubscribePermissions: json.RawMessage("null"),
+			},
+			user: models.MqttUser{
+				PublishPermissions:   subjects(),
+				SubscribePermissions: json.RawMessage("null"),
+			},
+			wantPublish:   `"GLOBAL.pub"`,
+			wantSubscribe: `["GLOBAL.sub", "_INBOX.>"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := tt.role
+			role.ID, role.Name = "role1", "sensors"
+			user := testUser("user1", "alice", role.ID)
+			user.PublishPermissions, user.SubscribePermissions = tt.user.PublishPermissions, tt.user.SubscribePermissions
+
+			data := mustGenerate(t, newTestGenerator(), []models.MqttRole{role}, []models.MqttUser{user})
+			if len(data.Roles) != 1 || len(data.Users) != 1 {
+				t.Fatalf("got %d roles and %d users, want 1 and 1", len(data.Roles), len(data.Users))
+			}
+
+			got := data.Users[0]
+			if got.PublishPermissions != tt.wantPublish {
+				t.Errorf("publish = %s, want %s", got.PublishPermissions, tt.wantPublish)
+			}
+			if got.SubscribePermissions != tt.wantSubscribe {
+				t.Errorf("subscribe = %s, want %s", got.SubscribePermissions, tt.wantSubscribe)
+			}
+			if got.InlinePermissions != tt.wantInline {
+				t.Errorf("inline = %v, want %v", got.InlinePermissions, tt.wantInline)
+			}
+
+			// Users without inline permissions reference the role, which must carry the same result
+			if !tt.wantInline {
+				if data.Roles[0].PublishPermissions != tt.wantPublish || data.Roles[0].SubscribePermissions != tt.wantSubscribe {
+					t.Errorf("role permissions = %s / %s, want %s / %s",
+						data.Roles[0].PublishPermissions, data.Roles[0].SubscribePermissions, tt.wantPublish, tt.wantSubscribe)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"encoding/json"
+	"strings"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// InheritPermissions merges the publish, subscribe and deny lists of each role's parent
+// chain into the role's own, keeping the first occurrence of each subject. A missing
+// parent or a cycle ends the chain with a logged error. The inputs are not modified.
+func (g *Generator) InheritPermissions(roles []models.MqttRole) []models.MqttRole {
+	byID := make(map[string]models.MqttRole, len(roles))
+	for _, role := range roles {
+		byID[role.ID] = role
+	}
+
+	inherited := make([]models.MqttRole, len(roles))
+	for i, role := range roles {
+		chain := g.parentChain(role, byID)
+		if len(chain) == 0 {
+			inherited[i] = role
+			continue
+		}
+
+		for _, field := range []struct {
+			value  *json.RawMessage
+			parent func(models.MqttRole) json.RawMessage
+		}{
+			{&role.PublishPermissions, func(r models.MqttRole) json.RawMessage { return r.PublishPermissions }},
+			{&role.SubscribePermissions, func(r models.MqttRole) json.RawMessage { return r.SubscribePermissions }},
+			{&role.PublishDenyPermissions, func(r models.MqttRole) json.RawMessage { return r.PublishDenyPermissions }},
+			{&role.SubscribeDenyPermissions, func(r models.MqttRole) json.RawMessage { return r.SubscribeDenyPermissions }},
+		} {
+			// A malformed field is left alone so the generator still reports it
+			if models.CheckPermissions(*field.value) != nil {
+				continue
+			}
+			lists := [][]string{models.ParsePermissions(*field.value)}
+			for _, parent := range chain {
+				lists = append(lists, models.ParsePermissions(field.parent(parent)))
+			}
+			if merged, changed := mergeSubjects(lists); changed {
+				// Marshalling a string slice cannot fail
+				*field.value, _ = json.Marshal(merged)
+			}
+		}
+		g.logger.Debug("Inherited role permissions",
+			zap.String("role", role.Name),
+			zap.String("parents", roleNames(chain)))
+		inherited[i] = role
+	}
+	return inherited
+}
+
+// parentChain returns the ancestors of a role, nearest first, stopping at a missing
+// parent or at a role already in the chain
+func (g *Generator) parentChain(role models.MqttRole, byID map[string]models.MqttRole) []models.MqttRole {
+	var chain []models.MqttRole
+	seen := map[string]bool{role.ID: true}
+	for current := role; current.ParentRoleID != ""; {
+		parent, ok := byID[current.ParentRoleID]
+		if !ok {
+			g.logger.Error("Parent role not found, ignoring the rest of the inheritance chain",
+				zap.String("role", role.Name),
+				zap.String("parent_role", current.ParentRoleID))
+			break
+		}
+		if seen[parent.ID] {
+			g.logger.Error("Role inheritance cycle, ignoring the rest of the chain",
+				zap.String("role", role.Name),
+				zap.String("chain", roleNames(append([]models.MqttRole{role}, append(chain, parent)...))))
+			break
+		}
+		seen[parent.ID] = true
+		chain = append(chain, parent)
+		current = parent
+	}
+	return chain
+}
+
+// mergeSubjects concatenates subject lists without duplicates, reporting whether
+// anything was added to the first list
+func mergeSubjects(lists [][]string) ([]string, bool) {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, list := range lists {
+		for _, subject := range list {
+			if !seen[subject] {
+				seen[subject] = true
+				merged = append(merged, subject)
+			}
+		}
+	}
+	return merged, len(merged) != len(lists[0])
+}
+
+// roleNames joins role names for log messages, e.g. "child -> base"
+func roleNames(roles []models.MqttRole) string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.Name
+	}
+	return strings.Join(names, " -> ")
+}
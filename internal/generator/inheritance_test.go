@@ -0,0 +1,132 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestInheritPermissions(t *testing.T) {
+	type want struct {
+		publish   []string
+		subscribe []string
+	}
+	tests := []struct {
+		name      string
+		roles     []models.MqttRole
+		want      map[string]want // Inherited subjects by role ID
+		wantError string          // Message of the error logged for a broken chain
+	}{
+		{
+			name: "single level",
+			roles: []models.MqttRole{
+				{ID: "base", Name: "base", PublishPermissions: subjects("telemetry.>"), SubscribePermissions: subjects("config.>")},
+				{ID: "child", Name: "child", ParentRoleID: "base", PublishPermissions: subjects("commands.>", "telemetry.>")},
+			},
+			want: map[string]want{
+				"base":  {[]string{"telemetry.>"}, []string{"config.>"}},
+				"child": {[]string{"commands.>", "telemetry.>"}, []string{"config.>"}},
+			},
+		},
+		{
+			name: "multi level",
+			roles: []models.MqttRole{
+				{ID: "leaf", Name: "leaf", ParentRoleID: "middle", PublishPermissions: subjects("leaf.pub")},
+				{ID: "middle", Name: "middle", ParentRoleID: "base", PublishPermissions: subjects("middle.pub"), SubscribePermissions: subjects("middle.sub")},
+				{ID: "base", Name: "base", PublishPermissions: subjects("base.pub", "middle.pub"), SubscribePermissions: subjects("base.sub")},
+			},
+			want: map[string]want{
+				"leaf":   {[]string{"leaf.pub", "middle.pub", "base.pub"}, []string{"middle.sub", "base.sub"}},
+				"middle": {[]string{"middle.pub", "base.pub"}, []string{"middle.sub", "base.sub"}},
+				"base":   {[]string{"base.pub", "middle.pub"}, []string{"base.sub"}},
+			},
+		},
+		{
+			name: "cycle",
+			roles: []models.MqttRole{
+				{ID: "a", Name: "a", ParentRoleID: "b", PublishPermissions: subjects("a.pub")},
+				{ID: "b", Name: "b", ParentRoleID: "a", PublishPermissions: subjects("b.pub")},
+			},
+			want: map[string]want{
+				"a": {[]string{"a.pub", "b.pub"}, nil},
+				"b": {[]string{"b.pub", "a.pub"}, nil},
+			},
+			wantError: "Role inheritance cycle, ignoring the rest of the chain",
+		},
+		{
+			name: "own parent",
+			roles: []models.MqttRole{
+				{ID: "self", Name: "self", ParentRoleID: "self", PublishPermissions: subjects("self.pub")},
+			},
+			want: map[string]want{
+				"self": {[]string{"self.pub"}, nil},
+			},
+			wantError: "Role inheritance cycle, ignoring the rest of the chain",
+		},
+		{
+			name: "missing parent",
+			roles: []models.MqttRole{
+				{ID: "orphan", Name: "orphan", ParentRoleID: "gone", PublishPermissions: subjects("orphan.pub")},
+			},
+			want: map[string]want{
+				"orphan": {[]string{"orphan.pub"}, nil},
+			},
+			wantError: "Parent role not found, ignoring the rest of the inheritance chain",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, logs := newObservedGenerator(zap.ErrorLevel)
+
+			// A cycle must end the chain rather than recurse forever
+			done := make(chan []models.MqttRole, 1)
+			go func() { done <- g.InheritPermissions(tt.roles) }()
+			var inherited []models.MqttRole
+			select {
+			case inherited = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("InheritPermissions did not return")
+			}
+
+			if len(inherited) != len(tt.roles) {
+				t.Fatalf("got %d roles, want %d", len(inherited), len(tt.roles))
+			}
+			for _, role := range inherited {
+				want, ok := tt.want[role.ID]
+				if !ok {
+					t.Fatalf("unexpected role %s", role.ID)
+				}
+				if got := models.ParsePermissions(role.PublishPermissions); strings.Join(got, ",") != strings.Join(want.publish, ",") {
+					t.Errorf("%s publish = %v, want %v", role.ID, got, want.publish)
+				}
+				if got := models.ParsePermissions(role.SubscribePermissions); strings.Join(got, ",") != strings.Join(want.subscribe, ",") {
+					t.Errorf("%s subscribe = %v, want %v", role.ID, got, want.subscribe)
+				}
+			}
+
+			logged := logs.All()
+			if tt.wantError == "" && len(logged) > 0 {
+				t.Errorf("logged %q, want no errors", logged[0].Message)
+			}
+			if tt.wantError != "" && logs.FilterMessage(tt.wantError).Len() == 0 {
+				t.Errorf("no %q error logged", tt.wantError)
+			}
+		})
+	}
+}
+
+func TestInheritPermissionsLeavesInputAlone(t *testing.T) {
+	roles := []models.MqttRole{
+		{ID: "base", Name: "base", PublishPermissions: subjects("base.pub")},
+		{ID: "child", Name: "child", ParentRoleID: "base", PublishPermissions: subjects("child.pub")},
+	}
+	newTestGenerator().InheritPermissions(roles)
+
+	if got := models.ParsePermissions(roles[1].PublishPermissions); len(got) != 1 || got[0] != "child.pub" {
+		t.Errorf("input role modified to %v", got)
+	}
+}
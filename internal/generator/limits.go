@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"math"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// warnUserLimits warns when a role sets per-user limits in authorization mode. NATS only
+// enforces them through user JWTs and rejects them in a user entry of a config file, so
+// they are left out. In accounts mode they become account limits instead.
+func (g *Generator) warnUserLimits(role models.MqttRole) {
+	if g.outputMode == OutputModeAccounts || (role.MaxSubscriptions == 0 && role.MaxPayload == 0) {
+		return
+	}
+	g.logger.Warn("Role sets per-user limits, which a NATS config file cannot carry, leaving them out",
+		zap.String("role", role.Name),
+		zap.Float64("max_subscriptions", role.MaxSubscriptions),
+		zap.Float64("max_payload", role.MaxPayload))
+}
+
+// accountLimits collects a role's aggregate account limits in accounts mode. Invalid
+// values are dropped with a warning, and nil is returned when no limit is set.
+func (g *Generator) accountLimits(role models.MqttRole) *models.NatsAccountLimits {
+	if g.outputMode != OutputModeAccounts {
+		return nil
+	}
+	limits := &models.NatsAccountLimits{
+		MaxConnections:   g.accountLimit(role, "max_connections", role.MaxConnections),
+		MaxSubscriptions: g.accountLimit(role, "max_subscriptions", role.MaxSubscriptions),
+		MaxPayload:       g.accountLimit(role, "max_payload", role.MaxPayload),
+		MaxLeafnodes:     g.accountLimit(role, "max_leafnodes", role.MaxLeafnodes),
+	}
+	if *limits == (models.NatsAccountLimits{}) {
+		return nil
+	}
+	return limits
+}
+
+// accountLimit validates a single limit, which must be a positive whole number
+func (g *Generator) accountLimit(role models.MqttRole, field string, value float64) int {
+	if value == 0 {
+		return 0
+	}
+	if value < 0 || value != math.Trunc(value) || value > math.MaxInt32 {
+		g.logger.Warn("Invalid account limit, ignoring it",
+			zap.String("role", role.Name),
+			zap.String("field", field),
+			zap.Float64("value", value))
+		return 0
+	}
+	return int(value)
+}
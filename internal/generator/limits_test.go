@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestUserLimitsLeftOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     models.MqttRole
+		wantWarn bool
+	}{
+		{name: "limits set", role: models.MqttRole{MaxSubscriptions: 100, MaxPayload: 1048576}, wantWarn: true},
+		{name: "one limit set", role: models.MqttRole{MaxPayload: 4096}, wantWarn: true},
+		{name: "no limits", role: models.MqttRole{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := tt.role
+			role.ID, role.Name, role.PublishPermissions = "r1", "sensors", subjects("sensors.>")
+
+			g, logs := newObservedGenerator(zap.WarnLevel)
+			data := mustGenerate(t, g, []models.MqttRole{role}, []models.MqttUser{testUser("u1", "alice", "r1")})
+			config, err := g.RenderConfig(data)
+			if err != nil {
+				t.Fatalf("RenderConfig: %v", err)
+			}
+
+			// nats-server rejects limits in a user entry, so none may reach the config
+			for _, line := range strings.Split(config, "\n") {
+				if strings.Contains(line, "max_subscriptions") || strings.Contains(line, "max_payload") {
+					t.Errorf("config carries a per-user limit: %q", strings.TrimSpace(line))
+				}
+			}
+			warned := logs.FilterMessage("Role sets per-user limits, which a NATS config file cannot carry, leaving them out").Len() > 0
+			if warned != tt.wantWarn {
+				t.Errorf("limits warning logged = %v, want %v", warned, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestAccountLimitLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		role      models.MqttRole
+		wantLines []string
+	}{
+		{
+			name: "all limits set",
+			role: models.MqttRole{MaxConnections: 10, MaxSubscriptions: 100, MaxPayload: 1048576, MaxLeafnodes: 2},
+			wantLines: []string{
+				"max_connections: 10",
+				"max_subscriptions: 100",
+				"max_payload: 1048576",
+				"max_leafnodes: 2",
+			},
+		},
+		{name: "one limit set", role: models.MqttRole{MaxPayload: 4096}, wantLines: []string{"max_payload: 4096"}},
+		{name: "no limits", role: models.MqttRole{}},
+		{name: "invalid limits are dropped", role: models.MqttRole{MaxSubscriptions: 1.5, MaxConnections: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := tt.role
+			role.ID, role.Name, role.PublishPermissions = "r1", "sensors", subjects("sensors.>")
+
+			g, logs := newObservedGenerator(zap.WarnLevel)
+			g.SetOutputMode(OutputModeAccounts)
+			data := mustGenerate(t, g, []models.MqttRole{role}, []models.MqttUser{testUser("u1", "alice", "r1")})
+			config, err := g.RenderConfig(data)
+			if err != nil {
+				t.Fatalf("RenderConfig: %v", err)
+			}
+
+			var limitLines []string
+			for _, line := range strings.Split(config, "\n") {
+				if strings.HasPrefix(strings.TrimSpace(line), "max_") {
+					limitLines = append(limitLines, strings.TrimSpace(line))
+				}
+			}
+			if strings.Join(limitLines, "\n") != strings.Join(tt.wantLines, "\n") {
+				t.Errorf("config has limit lines %q, want %q", limitLines, tt.wantLines)
+			}
+			if hasBlock := strings.Contains(config, "limits {"); hasBlock != (len(tt.wantLines) > 0) {
+				t.Errorf("limits block emitted = %v with limit lines %q", hasBlock, tt.wantLines)
+			}
+			// Account limits are applied, so the per-user warning must stay quiet
+			if logs.FilterMessage("Role sets per-user limits, which a NATS config file cannot carry, leaving them out").Len() > 0 {
+				t.Error("per-user limits warning logged in accounts mode")
+			}
+		})
+	}
+}
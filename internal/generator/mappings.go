@@ -0,0 +1,117 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// mappingFunctionPattern matches mapping functions such as {{wildcard(1)}} in a destination
+var mappingFunctionPattern = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+
+// SetMappings sets subject mappings from configuration, keyed by account name.
+// They are merged with any mappings stored on the role in PocketBase.
+func (g *Generator) SetMappings(mappings map[string][]models.SubjectMapping) {
+	g.mappings = make(map[string][]models.SubjectMapping, len(mappings))
+	for account, accountMappings := range mappings {
+		name := strings.ToUpper(account)
+		g.mappings[name] = append(g.mappings[name], accountMappings...)
+	}
+}
+
+// buildMappings collects and validates the subject mappings for a role's account
+func (g *Generator) buildMappings(role models.MqttRole) []models.NatsMapping {
+	accountName := role.NormalizeRoleName()
+
+	roleMappings, err := role.GetMappings()
+	if err != nil {
+		g.logger.Error("Failed to parse role mappings, ignoring them",
+			zap.String("role", role.Name),
+			zap.Error(err))
+	}
+	mappings := append(roleMappings, g.mappings[accountName]...)
+	if len(mappings) == 0 {
+		return nil
+	}
+	if !g.supports(featureMappings) {
+		g.logger.Warn("Target NATS version does not support subject mappings, leaving them out",
+			append(g.versionFields(featureMappings), zap.String("account", accountName))...)
+		return nil
+	}
+
+	// Group destinations by source subject, preserving their order
+	var sources []string
+	bySource := make(map[string][]models.SubjectMapping)
+	for _, mapping := range mappings {
+		if err := validateMapping(mapping); err != nil {
+			g.logger.Error("Invalid subject mapping, skipping",
+				zap.String("account", accountName),
+				zap.String("from", mapping.From),
+				zap.String("to", mapping.To),
+				zap.Error(err))
+			continue
+		}
+		if _, ok := bySource[mapping.From]; !ok {
+			sources = append(sources, mapping.From)
+		}
+		bySource[mapping.From] = append(bySource[mapping.From], mapping)
+	}
+	sort.Strings(sources)
+
+	var result []models.NatsMapping
+	for _, from := range sources {
+		destinations, err := formatMappingDestinations(bySource[from])
+		if err != nil {
+			g.logger.Error("Invalid weighted subject mapping, skipping",
+				zap.String("account", accountName),
+				zap.String("from", from),
+				zap.Error(err))
+			continue
+		}
+		result = append(result, models.NatsMapping{From: from, Destinations: destinations})
+	}
+	return result
+}
+
+// formatMappingDestinations formats the destinations for one source subject
+func formatMappingDestinations(mappings []models.SubjectMapping) (string, error) {
+	if len(mappings) == 1 && mappings[0].Weight == 0 {
+		return `"` + mappings[0].To + `"`, nil
+	}
+
+	total := 0
+	weighted := make([]string, len(mappings))
+	for i, mapping := range mappings {
+		if mapping.Weight == 0 {
+			return "", fmt.Errorf("every destination of a weighted mapping needs a weight")
+		}
+		total += mapping.Weight
+		weighted[i] = fmt.Sprintf(`{destination: "%s", weight: %d%%}`, mapping.To, mapping.Weight)
+	}
+	if total > 100 {
+		return "", fmt.Errorf("weights add up to %d%%, more than 100%%", total)
+	}
+	return "[" + strings.Join(weighted, ", ") + "]", nil
+}
+
+// validateMapping checks that both sides of a mapping are valid subjects
+func validateMapping(mapping models.SubjectMapping) error {
+	if err := models.ValidateSubject(mapping.From); err != nil {
+		return fmt.Errorf("invalid source subject: %w", err)
+	}
+
+	// Mapping functions may contain characters that are not valid in a subject
+	to := mappingFunctionPattern.ReplaceAllString(mapping.To, "x")
+	if err := models.ValidateSubject(to); err != nil {
+		return fmt.Errorf("invalid destination subject: %w", err)
+	}
+
+	if mapping.Weight < 0 || mapping.Weight > 100 {
+		return fmt.Errorf("weight %d is not between 0 and 100", mapping.Weight)
+	}
+	return nil
+}
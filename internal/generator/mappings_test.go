@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+)
+
+func TestBuildMappings(t *testing.T) {
+	tests := []struct {
+		name string
+		role string // Raw mappings field of the role
+		want []models.NatsMapping
+	}{
+		{
+			name: "single destination",
+			role: `[{"from": "legacy.>", "to": "v2.>"}]`,
+			want: []models.NatsMapping{{From: "legacy.>", Destinations: `"v2.>"`}},
+		},
+		{
+			name: "weighted destinations",
+			role: `[{"from": "svc.req", "to": "svc.v1", "weight": 80}, {"from": "svc.req", "to": "svc.v2", "weight": 20}]`,
+			want: []models.NatsMapping{{From: "svc.req", Destinations: `[{destination: "svc.v1", weight: 80%}, {destination: "svc.v2", weight: 20%}]`}},
+		},
+		{
+			name: "mapping function",
+			role: `[{"from": "orders.*", "to": "orders.{{wildcard(1)}}.new"}]`,
+			want: []models.NatsMapping{{From: "orders.*", Destinations: `"orders.{{wildcard(1)}}.new"`}},
+		},
+		{
+			name: "weights over 100 are skipped",
+			role: `[{"from": "svc.req", "to": "svc.v1", "weight": 80}, {"from": "svc.req", "to": "svc.v2", "weight": 30}]`,
+		},
+		{
+			name: "invalid subject is skipped",
+			role: `[{"from": "legacy..>", "to": "v2.>"}, {"from": "ok", "to": "fine"}]`,
+			want: []models.NatsMapping{{From: "ok", Destinations: `"fine"`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := models.MqttRole{ID: "r1", Name: "orders", Mappings: json.RawMessage(tt.role)}
+			got := newTestGenerator().buildMappings(role)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got mappings %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("mapping %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package generator
+
+import (
+	"strings"
+
+	"nats-pocketbase-sync/internal/models"
+	"github.com/nats-io/nkeys"
+	"go.uber.org/zap"
+)
+
+// userNKeyLength is the length of an encoded public nkey
+const userNKeyLength = 56
+
+// userNKey returns the user's public nkey, empty for users that authenticate with a
+// password. A user with an invalid nkey is left out rather than falling back to its
+// password, since the nkey was meant to replace it.
+func (g *Generator) userNKey(user models.MqttUser) (string, bool) {
+	nkey := strings.TrimSpace(user.NKey)
+	if nkey == "" {
+		return "", true
+	}
+
+	if !nkeys.IsValidPublicUserKey(nkey) {
+		reason := "checksum mismatch"
+		switch {
+		case !strings.HasPrefix(nkey, "U"):
+			reason = "a user nkey starts with U"
+		case len(nkey) != userNKeyLength:
+			reason = "a user nkey is 56 characters long"
+		}
+		g.logger.Warn("User has an invalid nkey, skipping",
+			zap.String("username", user.Username),
+			zap.String("nkey", nkey),
+			zap.String("reason", reason))
+		return "", false
+	}
+
+	if user.Password != "" {
+		g.logger.Warn("User has both an nkey and a password, using the nkey",
+			zap.String("username", user.Username))
+	}
+	return nkey, true
+}
@@ -0,0 +1,139 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultPasswordHashCost is the bcrypt cost used by `nats server passwd`
+const DefaultPasswordHashCost = 11
+
+// SetHashPasswords controls whether user passwords are emitted as bcrypt hashes at the
+// given cost. Hashes are cached per user and password, so an unchanged password keeps
+// its hash and the config stays stable between cycles.
+func (g *Generator) SetHashPasswords(enabled bool, cost int) {
+	g.hashPasswords = enabled
+	g.passwordHashCost = cost
+	if g.passwordHashes == nil {
+		g.passwordHashes = make(map[string]string)
+	}
+}
+
+// SeedPasswordHashes provides the hashes currently on disk by username, e.g. parsed from
+// the running config. A seeded hash is reused when it matches the user's password, so a
+// restart does not rehash every user and rewrite the config.
+func (g *Generator) SeedPasswordHashes(hashes map[string]string) {
+	g.passwordSeeds = make(map[string]string, len(hashes))
+	for username, hash := range hashes {
+		if isBcryptHash(hash) {
+			g.passwordSeeds[username] = hash
+		}
+	}
+}
+
+// isBcryptHash reports whether a password is already a bcrypt hash, which NATS
+// recognizes by its $2 prefix
+func isBcryptHash(password string) bool {
+	return strings.HasPrefix(password, "$2")
+}
+
+// passwordCacheKey identifies a user's password without keeping it as the map key
+func passwordCacheKey(username, password string) string {
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashUserPasswords replaces each user's password with its bcrypt hash and keeps the
+// plaintext for client credentials. Cache misses are hashed in parallel, since bcrypt
+// is deliberately slow. Cached hashes of users that are gone are dropped.
+func (g *Generator) hashUserPasswords(users []models.NatsUser) error {
+	if !g.hashPasswords {
+		return nil
+	}
+
+	keys := make([]string, len(users))
+	var misses []int
+	for i, user := range users {
+		if user.Password == "" || isBcryptHash(user.Password) {
+			continue
+		}
+		keys[i] = passwordCacheKey(user.Name, user.Password)
+		if _, ok := g.passwordHashes[keys[i]]; !ok {
+			misses = append(misses, i)
+		}
+	}
+
+	if len(misses) > 0 {
+		hashes := make([]string, len(misses))
+		errs := make([]error, len(misses))
+		work := make(chan int)
+		var wg sync.WaitGroup
+		for range min(runtime.NumCPU(), len(misses)) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range work {
+					hashes[j], errs[j] = g.hashPassword(users[misses[j]])
+				}
+			}()
+		}
+		for j := range misses {
+			work <- j
+		}
+		close(work)
+		wg.Wait()
+
+		reused := 0
+		for j, i := range misses {
+			if errs[j] != nil {
+				return fmt.Errorf("failed to hash password of user %s: %w", users[i].Name, errs[j])
+			}
+			if hashes[j] == g.passwordSeeds[users[i].Name] {
+				reused++
+			}
+			g.passwordHashes[keys[i]] = hashes[j]
+			delete(g.passwordSeeds, users[i].Name)
+		}
+		g.logger.Info("Hashed user passwords",
+			zap.Int("hashed", len(misses)-reused),
+			zap.Int("reused_from_disk", reused))
+	}
+
+	current := make(map[string]bool, len(users))
+	for i := range users {
+		if keys[i] == "" {
+			continue
+		}
+		current[keys[i]] = true
+		users[i].ClientPassword = users[i].Password
+		users[i].Password = g.passwordHashes[keys[i]]
+	}
+	for key := range g.passwordHashes {
+		if !current[key] {
+			delete(g.passwordHashes, key)
+		}
+	}
+	return nil
+}
+
+// hashPassword reuses the user's seeded hash if it matches, or computes a new one
+func (g *Generator) hashPassword(user models.NatsUser) (string, error) {
+	if seed, ok := g.passwordSeeds[user.Name]; ok {
+		if bcrypt.CompareHashAndPassword([]byte(seed), []byte(user.Password)) == nil {
+			return seed, nil
+		}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), g.passwordHashCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
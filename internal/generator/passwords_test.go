@@ -0,0 +1,86 @@
+package generator
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestGenerateConfigStableAcrossShuffledInput(t *testing.T) {
+	roles := []models.MqttRole{
+		{ID: "r1", Name: "reader", PublishPermissions: subjects("sensors.>"), SubscribePermissions: subjects("sensors.>")},
+		{ID: "r2", Name: "writer", PublishPermissions: subjects("commands.>"), SubscribePermissions: subjects("commands.>")},
+	}
+	users := []models.MqttUser{
+		{ID: "u1", Username: "alice", Password: "alice-secret", RoleID: "r1", Active: true},
+		{ID: "u2", Username: "Alice", Password: "Alice-secret", RoleID: "r2", Active: true},
+		{ID: "u3", Username: "bob", Password: "bob-secret", RoleID: "r1", Active: true},
+		{ID: "u4", Username: "carol", Password: "carol-secret", RoleID: "r2", Active: true},
+		{ID: "u5", Username: "carol", Password: "carol-other", RoleID: "r1", Active: true}, // Duplicate, skipped
+		{ID: "u6", Username: "dave", Password: "dave-secret", RoleID: "r2", Active: true},
+	}
+
+	g := newTestGenerator()
+	g.SetHashPasswords(true, bcrypt.MinCost)
+
+	first, err := g.GenerateConfig(roles, users)
+	if err != nil {
+		t.Fatalf("GenerateConfig: %v", err)
+	}
+
+	// Passwords are emitted as hashes only
+	if !strings.Contains(first, `"$2a$`) {
+		t.Errorf("config has no bcrypt hashes:\n%s", first)
+	}
+	for _, user := range users {
+		if strings.Contains(first, user.Password) {
+			t.Errorf("config contains the plaintext password of %s (%s)", user.Username, user.ID)
+		}
+	}
+
+	// PocketBase may return records in any order
+	shuffle := rand.New(rand.NewSource(1))
+	for i := 0; i < 5; i++ {
+		shuffledRoles := append([]models.MqttRole(nil), roles...)
+		shuffledUsers := append([]models.MqttUser(nil), users...)
+		shuffle.Shuffle(len(shuffledRoles), func(a, b int) {
+			shuffledRoles[a], shuffledRoles[b] = shuffledRoles[b], shuffledRoles[a]
+		})
+		shuffle.Shuffle(len(shuffledUsers), func(a, b int) {
+			shuffledUsers[a], shuffledUsers[b] = shuffledUsers[b], shuffledUsers[a]
+		})
+
+		next, err := g.GenerateConfig(shuffledRoles, shuffledUsers)
+		if err != nil {
+			t.Fatalf("GenerateConfig: %v", err)
+		}
+		if next != first {
+			t.Fatalf("config differs after shuffling the input:\nfirst:\n%s\nnext:\n%s", first, next)
+		}
+	}
+}
+
+func TestSeededPasswordHashesAreReused(t *testing.T) {
+	roles := []models.MqttRole{{ID: "r1", Name: "reader", PublishPermissions: subjects("sensors.>")}}
+	users := []models.MqttUser{{ID: "u1", Username: "alice", Password: "alice-secret", RoleID: "r1", Active: true}}
+
+	// A restarted instance starts with an empty cache but the hashes on disk
+	hash, err := bcrypt.GenerateFromPassword([]byte("alice-secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newTestGenerator()
+	g.SetHashPasswords(true, bcrypt.MinCost)
+	g.SeedPasswordHashes(map[string]string{"alice": string(hash)})
+
+	config, err := g.GenerateConfig(roles, users)
+	if err != nil {
+		t.Fatalf("GenerateConfig: %v", err)
+	}
+	if !strings.Contains(config, string(hash)) {
+		t.Errorf("seeded hash was not reused:\n%s", config)
+	}
+}
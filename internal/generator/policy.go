@@ -0,0 +1,155 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// Policy actions for forbidden permission grants
+const (
+	PolicyActionFail = "fail"
+	PolicyActionWarn = "warn"
+)
+
+// PermissionPolicy forbids broad permission grants unless a role is explicitly allowlisted
+type PermissionPolicy struct {
+	ForbiddenPatterns []string // Subjects that may not be granted, e.g. ">"
+	AllowedRoles      []string // Role names exempt from the policy
+	Action            string   // "fail" aborts the cycle, "warn" only logs
+}
+
+// permissionViolation describes a forbidden grant found in the generated permissions
+type permissionViolation struct {
+	kind      string // "role", "user" or "default permissions"
+	name      string
+	direction string
+	subject   string
+	pattern   string
+	users     []string
+}
+
+// SetPermissionPolicy sets the policy checked against every generated config
+func (g *Generator) SetPermissionPolicy(policy PermissionPolicy) {
+	g.permissionPolicy = policy
+}
+
+// checkPermissionPolicy scans the generated default, role and inline user permissions for
+// grants that cover a forbidden pattern
+func (g *Generator) checkPermissionPolicy(configData *models.NatsConfigData) error {
+	if len(g.permissionPolicy.ForbiddenPatterns) == 0 {
+		return nil
+	}
+
+	allowed := make(map[string]bool, len(g.permissionPolicy.AllowedRoles))
+	for _, role := range g.permissionPolicy.AllowedRoles {
+		allowed[role] = true
+		allowed[(&models.MqttRole{Name: role}).NormalizeRoleName()] = true
+	}
+
+	// Index users by role so violations can name who is affected
+	usersByRole := make(map[string][]string)
+	for _, user := range configData.Users {
+		usersByRole[user.RoleName] = append(usersByRole[user.RoleName], user.Name)
+	}
+
+	// The defaults apply to any role without permissions and can't be allowlisted
+	violations := g.forbiddenGrants("default permissions", "", configData.DefaultPublish, configData.DefaultSubscribe, nil)
+	for _, role := range configData.Roles {
+		if allowed[role.Name] {
+			continue
+		}
+		violations = append(violations, g.forbiddenGrants("role", role.Name,
+			role.PublishPermissions, role.SubscribePermissions, usersByRole[role.Name])...)
+	}
+
+	// Inline user permissions are exempt only when the user's role is allowlisted
+	users := configData.Users
+	for _, account := range configData.Accounts {
+		users = append(users, account.Users...)
+	}
+	checked := make(map[string]bool, len(users))
+	for _, user := range users {
+		if !user.InlinePermissions || allowed[user.RoleName] || checked[user.Name] {
+			continue
+		}
+		checked[user.Name] = true
+		violations = append(violations, g.forbiddenGrants("user", user.Name,
+			user.PublishPermissions, user.SubscribePermissions, []string{user.Name})...)
+	}
+
+	for _, v := range violations {
+		g.logger.Warn("Forbidden permission granted",
+			zap.String(v.kind, v.name),
+			zap.String("direction", v.direction),
+			zap.String("subject", v.subject),
+			zap.String("forbidden_pattern", v.pattern),
+			zap.Strings("users", v.users))
+	}
+
+	if len(violations) > 0 && g.permissionPolicy.Action != PolicyActionWarn {
+		v := violations[0]
+		source := v.kind
+		if v.name != "" {
+			source += " " + v.name
+		}
+		return fmt.Errorf("permission policy violated: %s grants %s %q, covering forbidden %q (%d violation(s) in total)",
+			source, v.direction, v.subject, v.pattern, len(violations))
+	}
+
+	return nil
+}
+
+// forbiddenGrants returns the allowed subjects of formatted publish and subscribe
+// permissions that cover a forbidden pattern
+func (g *Generator) forbiddenGrants(kind, name, publish, subscribe string, users []string) []permissionViolation {
+	var violations []permissionViolation
+	for _, direction := range []struct {
+		name       string
+		permission string
+	}{
+		{"publish", publish},
+		{"subscribe", subscribe},
+	} {
+		for _, subject := range models.AllowedSubjects(direction.permission) {
+			for _, pattern := range g.permissionPolicy.ForbiddenPatterns {
+				pattern = strings.TrimSpace(pattern)
+				if !subjectCovers(subject, pattern) {
+					continue
+				}
+				violations = append(violations, permissionViolation{
+					kind:      kind,
+					name:      name,
+					direction: direction.name,
+					subject:   subject,
+					pattern:   pattern,
+					users:     users,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// subjectCovers reports whether grant matches every subject pattern matches, so ">" and
+// "admin.>" both cover "admin.>", while "admin.users" does not
+func subjectCovers(grant, pattern string) bool {
+	grantTokens, patternTokens := strings.Split(grant, "."), strings.Split(pattern, ".")
+	for i, token := range grantTokens {
+		if token == ">" {
+			return i < len(patternTokens)
+		}
+		if i >= len(patternTokens) {
+			return false
+		}
+		switch {
+		case token == "*" && patternTokens[i] != ">":
+		case token == patternTokens[i]:
+		default:
+			return false
+		}
+	}
+	return len(grantTokens) == len(patternTokens)
+}
@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestSubjectCovers(t *testing.T) {
+	tests := []struct {
+		grant, pattern string
+		want           bool
+	}{
+		{">", ">", true},
+		{">", "admin.>", true},
+		{"admin.>", "admin.>", true},
+		{"*.>", "admin.>", true},
+		{"admin.*", "admin.users", true},
+		{"admin.users", "admin.>", false},
+		{"admin.*", "admin.>", false},
+		{"admin", "admin.>", false},
+		{"*", ">", false},
+		{"sensors.>", ">", false},
+	}
+	for _, tt := range tests {
+		if got := subjectCovers(tt.grant, tt.pattern); got != tt.want {
+			t.Errorf("subjectCovers(%q, %q) = %v, want %v", tt.grant, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestPermissionPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		defaultPub interface{}
+		roles      []models.MqttRole
+		users      []models.MqttUser
+		patterns   []string
+		allowed    []string
+		wantError  string // Substring of the expected error, empty to pass
+	}{
+		{
+			name:      "full access covers a narrower pattern",
+			roles:     []models.MqttRole{{ID: "r1", Name: "ops", PublishPermissions: subjects(">")}},
+			patterns:  []string{"admin.>"},
+			wantError: `role OPS grants publish ">", covering forbidden "admin.>"`,
+		},
+		{
+			name:     "a subject inside the pattern passes",
+			roles:    []models.MqttRole{{ID: "r1", Name: "ops", PublishPermissions: subjects("admin.users")}},
+			patterns: []string{">"},
+		},
+		{
+			name:     "denied subjects are not grants",
+			roles:    []models.MqttRole{{ID: "r1", Name: "ops", PublishPermissions: subjects("sensors.>"), PublishDenyPermissions: subjects(">")}},
+			patterns: []string{">"},
+		},
+		{
+			name:       "global default permissions are checked",
+			defaultPub: ">",
+			roles:      []models.MqttRole{{ID: "r1", Name: "ops", PublishPermissions: subjects("sensors.>")}},
+			patterns:   []string{">"},
+			wantError:  `default permissions grants publish ">"`,
+		},
+		{
+			name:  "inline user permissions are named as the user",
+			roles: []models.MqttRole{{ID: "r1", Name: "ops", PublishPermissions: subjects("sensors.>")}},
+			users: []models.MqttUser{func() models.MqttUser {
+				u := testUser("u1", "alice", "r1")
+				u.SubscribePermissions = subjects(">")
+				return u
+			}()},
+			patterns:  []string{">"},
+			wantError: `user alice grants subscribe ">"`,
+		},
+		{
+			name:     "allowlisted roles and their users pass",
+			roles:    []models.MqttRole{{ID: "r1", Name: "ops", PublishPermissions: subjects(">"), SubscribePermissions: subjects(">")}},
+			users:    []models.MqttUser{testUser("u1", "alice", "r1")},
+			patterns: []string{">"},
+			allowed:  []string{"ops"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultPub := tt.defaultPub
+			if defaultPub == nil {
+				defaultPub = "GLOBAL.pub"
+			}
+			g := NewGenerator(defaultPub, []interface{}{"GLOBAL.sub", "_INBOX.>"}, zap.NewNop())
+			g.SetPermissionPolicy(PermissionPolicy{
+				ForbiddenPatterns: tt.patterns,
+				AllowedRoles:      tt.allowed,
+				Action:            PolicyActionFail,
+			})
+
+			_, err := g.GenerateConfigData(tt.roles, tt.users)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("GenerateConfigData: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// Subject prefix modes
+const (
+	SubjectPrefixEnforce = "enforce" // Fail generation on a subject outside the prefix
+	SubjectPrefixAuto    = "auto"    // Prepend the prefix to subjects outside it
+)
+
+// prefixViolation is a subject from PocketBase that is outside the subject prefix
+type prefixViolation struct {
+	kind    string // "role" or "user"
+	name    string
+	field   string
+	subject string
+}
+
+// SetSubjectPrefix scopes every subject permission read from PocketBase under prefix,
+// e.g. "prod.", so PocketBase data cannot grant access outside its environment.
+// An empty prefix disables the check.
+func (g *Generator) SetSubjectPrefix(prefix, mode string) {
+	g.subjectPrefix = prefix
+	g.subjectPrefixMode = mode
+}
+
+// ApplySubjectPrefix checks or rewrites the permission fields of roles and users against the
+// subject prefix. The inputs are not modified; in auto mode rewritten copies are returned.
+// Subjects from the configuration, such as default_permissions, are not affected.
+func (g *Generator) ApplySubjectPrefix(roles []models.MqttRole, users []models.MqttUser) ([]models.MqttRole, []models.MqttUser, error) {
+	if g.subjectPrefix == "" {
+		return roles, users, nil
+	}
+
+	var violations []prefixViolation
+	prefixedRoles := make([]models.MqttRole, len(roles))
+	for i, role := range roles {
+		for _, field := range []struct {
+			name  string
+			value *json.RawMessage
+		}{
+			{"publish_permissions", &role.PublishPermissions},
+			{"subscribe_permissions", &role.SubscribePermissions},
+			{"default_publish_permissions", &role.DefaultPublishPermissions},
+			{"default_subscribe_permissions", &role.DefaultSubscribePermissions},
+			{"publish_deny", &role.PublishDenyPermissions},
+			{"subscribe_deny", &role.SubscribeDenyPermissions},
+		} {
+			var outside []string
+			*field.value, outside = g.prefixPermissions(*field.value)
+			for _, subject := range outside {
+				violations = append(violations, prefixViolation{"role", role.Name, field.name, subject})
+			}
+		}
+		prefixedRoles[i] = role
+	}
+
+	prefixedUsers := make([]models.MqttUser, len(users))
+	for i, user := range users {
+		for _, field := range []struct {
+			name  string
+			value *json.RawMessage
+		}{
+			{"publish_permissions", &user.PublishPermissions},
+			{"subscribe_permissions", &user.SubscribePermissions},
+		} {
+			var outside []string
+			*field.value, outside = g.prefixPermissions(*field.value)
+			for _, subject := range outside {
+				violations = append(violations, prefixViolation{"user", user.Username, field.name, subject})
+			}
+		}
+		prefixedUsers[i] = user
+	}
+
+	if len(violations) == 0 {
+		return prefixedRoles, prefixedUsers, nil
+	}
+
+	if g.subjectPrefixMode == SubjectPrefixAuto {
+		for _, v := range violations {
+			g.logger.Debug("Prefixed subject outside the subject prefix",
+				zap.String(v.kind, v.name),
+				zap.String("field", v.field),
+				zap.String("subject", v.subject))
+		}
+		g.logger.Info("Prefixed subjects outside the subject prefix",
+			zap.String("prefix", g.subjectPrefix),
+			zap.Int("count", len(violations)))
+		return prefixedRoles, prefixedUsers, nil
+	}
+
+	for _, v := range violations {
+		g.logger.Warn("Subject is outside the subject prefix",
+			zap.String(v.kind, v.name),
+			zap.String("field", v.field),
+			zap.String("subject", v.subject),
+			zap.String("prefix", g.subjectPrefix))
+	}
+	v := violations[0]
+	return nil, nil, fmt.Errorf("subject prefix violated: %s %s grants %q in %s outside %q (%d violation(s) in total)",
+		v.kind, v.name, v.subject, v.field, g.subjectPrefix, len(violations))
+}
+
+// prefixPermissions returns the field with the subjects outside the prefix, and in auto
+// mode the field with those subjects prefixed. Queue groups after the subject are kept.
+// Malformed fields are returned unchanged; the generator already reports them.
+func (g *Generator) prefixPermissions(field json.RawMessage) (json.RawMessage, []string) {
+	if models.CheckPermissions(field) != nil {
+		return field, nil
+	}
+	subjects := models.ParsePermissions(field)
+
+	var outside []string
+	for i, entry := range subjects {
+		subject := strings.TrimSpace(entry)
+		if strings.HasPrefix(subject, g.subjectPrefix) {
+			continue
+		}
+		outside = append(outside, entry)
+		subjects[i] = g.subjectPrefix + subject
+	}
+	if len(outside) == 0 || g.subjectPrefixMode != SubjectPrefixAuto {
+		return field, outside
+	}
+
+	// Marshalling a string slice cannot fail
+	prefixed, _ := json.Marshal(subjects)
+	return prefixed, outside
+}
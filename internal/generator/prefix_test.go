@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+)
+
+func TestSubjectPrefix(t *testing.T) {
+	role := models.MqttRole{
+		ID:                       "r1",
+		Name:                     "sensors",
+		PublishPermissions:       subjects("sensors.>", "prod.events"),
+		PublishDenyPermissions:   subjects("sensors.admin.>"),
+		SubscribeDenyPermissions: subjects("prod.secrets.>"),
+	}
+	users := []models.MqttUser{testUser("u1", "alice", "r1")}
+
+	tests := []struct {
+		name      string
+		mode      string
+		wantErr   bool
+		wantLines []string
+	}{
+		{
+			name: "auto prefixes allow and deny lists",
+			mode: SubjectPrefixAuto,
+			wantLines: []string{
+				`publish = {allow: ["prod.sensors.>", "prod.events"], deny: "prod.sensors.admin.>"}`,
+				`subscribe = {allow: ["GLOBAL.sub", "_INBOX.>"], deny: "prod.secrets.>"}`,
+			},
+		},
+		{name: "enforce rejects subjects outside the prefix", mode: SubjectPrefixEnforce, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGenerator()
+			g.SetSubjectPrefix("prod.", tt.mode)
+
+			config, err := g.GenerateConfig([]models.MqttRole{role}, users)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("GenerateConfig accepted subjects outside the prefix")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateConfig: %v", err)
+			}
+			for _, line := range tt.wantLines {
+				if !strings.Contains(config, line) {
+					t.Errorf("config lacks %q:\n%s", line, config)
+				}
+			}
+		})
+	}
+}
+
+func TestSubjectPrefixEnforcesDenyLists(t *testing.T) {
+	role := models.MqttRole{
+		ID:                     "r1",
+		Name:                   "sensors",
+		PublishPermissions:     subjects("prod.sensors.>"),
+		PublishDenyPermissions: subjects("sensors.admin.>"),
+	}
+
+	g := newTestGenerator()
+	g.SetSubjectPrefix("prod.", SubjectPrefixEnforce)
+	_, _, err := g.ApplySubjectPrefix([]models.MqttRole{role}, nil)
+	if err == nil || !strings.Contains(err.Error(), "publish_deny") {
+		t.Errorf("ApplySubjectPrefix error = %v, want a publish_deny violation", err)
+	}
+}
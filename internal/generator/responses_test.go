@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestAllowResponsesForms(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string // Raw allow_responses field as PocketBase returns it
+		want     string // Formatted value, empty when no allow_responses is emitted
+		wantWarn bool   // A malformed value is logged and ignored
+	}{
+		{name: "bare true", value: `true`, want: "true"},
+		{name: "object with max and expires", value: `{"max": 2, "expires": "30s"}`, want: `{max: 2, expires: "30s"}`},
+		{name: "object with max only", value: `{"max": 5}`, want: "{max: 5}"},
+		{name: "object with expires only", value: `{"expires": "1m"}`, want: `{expires: "1m"}`},
+		{name: "empty object uses the NATS defaults", value: `{}`, want: "true"},
+		{name: "false", value: `false`},
+		{name: "null", value: `null`},
+		{name: "unset", value: ``},
+		{name: "unknown key", value: `{"maximum": 2}`, wantWarn: true},
+		{name: "negative max", value: `{"max": -1}`, wantWarn: true},
+		{name: "invalid expires", value: `{"expires": "soon"}`, wantWarn: true},
+		{name: "string", value: `"true"`, wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := models.MqttRole{ID: "r1", Name: "responder", PublishPermissions: subjects("svc.events")}
+			if tt.value != "" {
+				role.AllowResponses = json.RawMessage(tt.value)
+			}
+			inline := testUser("u2", "inline", "r1")
+			inline.PublishPermissions = subjects("svc.status")
+			users := []models.MqttUser{testUser("u1", "byrole", "r1"), inline}
+
+			g, logs := newObservedGenerator(zap.WarnLevel)
+			data := mustGenerate(t, g, []models.MqttRole{role}, users)
+
+			if got := data.Roles[0].AllowResponses; got != tt.want {
+				t.Errorf("role allow_responses = %q, want %q", got, tt.want)
+			}
+			warned := logs.FilterMessage("Malformed allow_responses field, ignoring it").Len() > 0
+			if warned != tt.wantWarn {
+				t.Errorf("malformed warning logged = %v, want %v", warned, tt.wantWarn)
+			}
+
+			config, err := g.RenderConfig(data)
+			if err != nil {
+				t.Fatalf("RenderConfig: %v", err)
+			}
+			roleLine := "allow_responses = " + tt.want
+			inlineField := "allow_responses: " + tt.want
+			if tt.want == "" {
+				if strings.Contains(config, "allow_responses") {
+					t.Errorf("config emits allow_responses, want none:\n%s", config)
+				}
+				return
+			}
+			if !strings.Contains(config, roleLine) {
+				t.Errorf("config lacks %q in the role block:\n%s", roleLine, config)
+			}
+			if !strings.Contains(config, inlineField) {
+				t.Errorf("config lacks %q in the inline permissions:\n%s", inlineField, config)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package generator
+
+// SchemaVersion is the schema version of the generated config. Bump it when the
+// generated config changes in a way older instances must not reload over.
+const SchemaVersion = 1
+
+// SetSchemaVersion marks the generated config with a "# schema: N" comment.
+// Zero disables the marker.
+func (g *Generator) SetSchemaVersion(version int) {
+	g.schemaVersion = version
+}
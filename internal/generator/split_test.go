@@ -0,0 +1,42 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+)
+
+func TestGenerateSplitConfig(t *testing.T) {
+	roles := []models.MqttRole{
+		{ID: "r1", Name: "sensors", PublishPermissions: subjects("sensors.>")},
+		{ID: "r2", Name: "admins", PublishPermissions: subjects(">")},
+	}
+	users := []models.MqttUser{testUser("u1", "alice", "r1"), testUser("u2", "bob", "r2")}
+
+	g := newTestGenerator()
+	if _, _, err := g.GenerateSplitConfig(roles, users, "accounts"); err == nil {
+		t.Fatal("GenerateSplitConfig succeeded outside accounts mode")
+	}
+
+	g.SetOutputMode(OutputModeAccounts)
+	config, files, err := g.GenerateSplitConfig(roles, users, "accounts")
+	if err != nil {
+		t.Fatalf("GenerateSplitConfig: %v", err)
+	}
+	for _, line := range []string{`include "accounts/ADMINS.conf"`, `include "accounts/SENSORS.conf"`} {
+		if !strings.Contains(config, line) {
+			t.Errorf("main config lacks %q:\n%s", line, config)
+		}
+	}
+	if strings.Contains(config, "alice") || strings.Contains(config, "bob") {
+		t.Errorf("main config still lists users:\n%s", config)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("got %d account files, want 2", len(files))
+	}
+	if !strings.Contains(files["SENSORS"], `user: "alice"`) || strings.Contains(files["SENSORS"], "bob") {
+		t.Errorf("SENSORS file does not hold exactly its own user:\n%s", files["SENSORS"])
+	}
+}
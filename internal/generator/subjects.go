@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// Policies for roles and users granting a malformed subject
+const (
+	InvalidSubjectSkip  = "skip"  // Leave out the role with its users, or the user
+	InvalidSubjectError = "error" // Abort config generation
+)
+
+// invalidSubject is a malformed subject found in a permission field
+type invalidSubject struct {
+	field string
+	entry string
+	err   error
+}
+
+// SetInvalidSubjectPolicy sets how roles and users granting a malformed subject are
+// handled. NATS rejects a config with such a subject on reload.
+func (g *Generator) SetInvalidSubjectPolicy(policy string) {
+	g.invalidSubjectPolicy = policy
+}
+
+// checkRoleSubjects validates every subject permission field of a role
+func checkRoleSubjects(role models.MqttRole) []invalidSubject {
+	return checkSubjects([]permissionField{
+		{"publish_permissions", role.PublishPermissions},
+		{"subscribe_permissions", role.SubscribePermissions},
+		{"default_publish_permissions", role.DefaultPublishPermissions},
+		{"default_subscribe_permissions", role.DefaultSubscribePermissions},
+		{"publish_deny", role.PublishDenyPermissions},
+		{"subscribe_deny", role.SubscribeDenyPermissions},
+	})
+}
+
+// checkUserSubjects validates the inline subject permission fields of a user
+func checkUserSubjects(user models.MqttUser) []invalidSubject {
+	return checkSubjects([]permissionField{
+		{"publish_permissions", user.PublishPermissions},
+		{"subscribe_permissions", user.SubscribePermissions},
+	})
+}
+
+// permissionField is a named JSON permission field
+type permissionField struct {
+	name  string
+	value json.RawMessage
+}
+
+// checkSubjects returns the malformed subjects of the fields. Fields that are not a list
+// of subjects are reported by warnMalformedPermissions instead.
+func checkSubjects(fields []permissionField) []invalidSubject {
+	var invalid []invalidSubject
+	for _, field := range fields {
+		for _, entry := range models.ParsePermissions(field.value) {
+			if err := models.ValidatePermissionSubject(entry); err != nil {
+				invalid = append(invalid, invalidSubject{field.name, entry, err})
+			}
+		}
+	}
+	return invalid
+}
+
+// rejectInvalidSubjects logs the malformed subjects of a role or user. Under the error
+// policy it returns an error naming the first one; otherwise the caller skips the record.
+func (g *Generator) rejectInvalidSubjects(kind, name string, invalid []invalidSubject) error {
+	for _, subject := range invalid {
+		g.logger.Warn("Invalid subject in permission field",
+			zap.String(kind, name),
+			zap.String("field", subject.field),
+			zap.String("subject", subject.entry),
+			zap.Error(subject.err))
+	}
+	if g.invalidSubjectPolicy == InvalidSubjectError {
+		first := invalid[0]
+		return fmt.Errorf("%s %s has an invalid subject in %s: %w", kind, name, first.field, first.err)
+	}
+	return nil
+}
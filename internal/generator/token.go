@@ -0,0 +1,58 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"nats-pocketbase-sync/internal/models"
+)
+
+// authTokenVar is the secrets file variable holding the shared token
+const authTokenVar = "AUTH_TOKEN"
+
+// SetAuthToken switches authorization mode to a shared token that every client presents,
+// with the default permissions. NATS rejects a token next to users or accounts, so
+// generation fails when any user would be emitted. An empty token disables the mode.
+func (g *Generator) SetAuthToken(token string) {
+	g.authToken = token
+}
+
+// ValidateAuthToken checks that a token can be emitted as a quoted config string
+func ValidateAuthToken(token string) error {
+	if strings.TrimSpace(token) == "" {
+		return fmt.Errorf("token is empty")
+	}
+	if strings.ContainsAny(token, " \t\r\n\"\\") {
+		return fmt.Errorf("token contains whitespace, quotes or backslashes")
+	}
+	return nil
+}
+
+// applyAuthToken replaces the roles and users of the config data with the shared token,
+// failing when anything NATS rejects next to a token would be emitted
+func (g *Generator) applyAuthToken(configData *models.NatsConfigData) error {
+	if g.authToken == "" {
+		return nil
+	}
+	if err := ValidateAuthToken(g.authToken); err != nil {
+		return fmt.Errorf("invalid auth token: %w", err)
+	}
+
+	switch {
+	case configData.AccountsMode || configData.WrapAccount != "":
+		return fmt.Errorf("token authorization can't be combined with accounts")
+	case configData.MonitoringUser != nil:
+		return fmt.Errorf("token authorization can't be combined with the monitoring user, whose account NATS rejects next to a token")
+	case len(configData.Users) > 0:
+		return fmt.Errorf("token authorization can't be combined with users, but %d user(s) would be generated, e.g. %s",
+			len(configData.Users), configData.Users[0].Name)
+	}
+
+	configData.AuthToken = g.authToken
+	configData.Roles = nil // Role variables are only referenced by users
+	if configData.SecretsInclude != "" {
+		configData.AuthTokenVar = authTokenVar
+		configData.Secrets = append(configData.Secrets, models.NatsSecret{Name: authTokenVar, Value: g.authToken})
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+)
+
+func TestAuthToken(t *testing.T) {
+	roles := []models.MqttRole{{ID: "r1", Name: "sensors", PublishPermissions: subjects("sensors.>")}}
+
+	g := newTestGenerator()
+	g.SetAuthToken("s3cr3t")
+	config, err := g.GenerateConfig(roles, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfig: %v", err)
+	}
+	if !strings.Contains(config, `token: "s3cr3t"`) || !strings.Contains(config, "default_permissions") {
+		t.Errorf("config lacks the token or the default permissions:\n%s", config)
+	}
+	// NATS rejects a token next to a users array, even an empty one
+	if strings.Contains(config, "users =") || strings.Contains(config, "SENSORS") {
+		t.Errorf("token config has users or roles:\n%s", config)
+	}
+
+	// The token moves to the secrets file with the passwords
+	g.SetSecretsInclude("secrets.conf")
+	config, err = g.GenerateConfig(roles, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfig with secrets: %v", err)
+	}
+	if !strings.Contains(config, "token: $AUTH_TOKEN") || !strings.Contains(g.SecretsFile(), `AUTH_TOKEN: "s3cr3t"`) {
+		t.Errorf("token not referenced from the secrets file:\n%s\n%s", config, g.SecretsFile())
+	}
+}
+
+func TestAuthTokenRejectsUsers(t *testing.T) {
+	roles := []models.MqttRole{{ID: "r1", Name: "sensors", PublishPermissions: subjects("sensors.>")}}
+
+	tests := []struct {
+		name      string
+		token     string
+		setup     func(g *Generator)
+		users     []models.MqttUser
+		wantError string
+	}{
+		{
+			name:      "users",
+			token:     "s3cr3t",
+			users:     []models.MqttUser{testUser("u1", "alice", "r1")},
+			wantError: "1 user(s) would be generated, e.g. alice",
+		},
+		{
+			name:      "accounts mode",
+			token:     "s3cr3t",
+			setup:     func(g *Generator) { g.SetOutputMode(OutputModeAccounts) },
+			wantError: "can't be combined with accounts",
+		},
+		{
+			name:  "monitoring user",
+			token: "s3cr3t",
+			setup: func(g *Generator) {
+				g.SetMonitoringUser(MonitoringUser{Account: "SYS", Username: "monitor", Password: "pw"})
+			},
+			wantError: "monitoring user",
+		},
+		{
+			name:      "quoted token",
+			token:     `s3"cr3t`,
+			wantError: "invalid auth token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGenerator()
+			g.SetAuthToken(tt.token)
+			if tt.setup != nil {
+				tt.setup(g)
+			}
+			_, err := g.GenerateConfig(roles, tt.users)
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+		})
+	}
+}
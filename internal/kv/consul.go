@@ -0,0 +1,170 @@
+package kv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ConsulConfig contains the settings for writing the config to a Consul KV key
+type ConsulConfig struct {
+	Address    string // Consul HTTP address, e.g. http://127.0.0.1:8500
+	Key        string // KV key the config is stored under
+	Token      string // Optional ACL token
+	Datacenter string // Optional datacenter
+}
+
+// ConsulWriter stores the generated config in a Consul KV key using check-and-set writes
+type ConsulWriter struct {
+	cfg        ConsulConfig
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// consulEntry is a KV entry as returned by the Consul HTTP API
+type consulEntry struct {
+	ModifyIndex uint64 `json:"ModifyIndex"`
+	Value       string `json:"Value"` // Base64 encoded
+}
+
+// NewConsulWriter creates a new ConsulWriter
+func NewConsulWriter(cfg ConsulConfig, logger *zap.Logger) *ConsulWriter {
+	cfg.Address = strings.TrimRight(cfg.Address, "/")
+	cfg.Key = strings.TrimLeft(cfg.Key, "/")
+	return &ConsulWriter{
+		cfg: cfg,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		logger: logger,
+	}
+}
+
+// WriteIfChanged stores content under the key if its hash differs from the stored value.
+// The write is a check-and-set against the index that was read, so a concurrent
+// modification fails the write instead of being overwritten.
+func (w *ConsulWriter) WriteIfChanged(content string) (bool, error) {
+	current, index, err := w.get()
+	if err != nil {
+		return false, err
+	}
+
+	if hashValue(current) == hashValue([]byte(content)) {
+		w.logger.Debug("Consul key unchanged", zap.String("key", w.cfg.Key))
+		return false, nil
+	}
+
+	ok, err := w.put([]byte(content), index)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, fmt.Errorf("consul key %s was modified concurrently (cas index %d)", w.cfg.Key, index)
+	}
+
+	w.logger.Info("Wrote config to Consul",
+		zap.String("key", w.cfg.Key),
+		zap.Uint64("cas_index", index),
+		zap.String("hash", hashValue([]byte(content))[:12]))
+	return true, nil
+}
+
+// Current returns the stored config, or an empty string if the key doesn't exist
+func (w *ConsulWriter) Current() (string, error) {
+	value, _, err := w.get()
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// get returns the stored value and its modify index. A missing key has index 0,
+// which makes the following check-and-set only succeed if the key is still absent.
+func (w *ConsulWriter) get() ([]byte, uint64, error) {
+	resp, err := w.do(http.MethodGet, nil, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read consul key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, 0, nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("consul read failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var entries []consulEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode consul response: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, 0, nil
+	}
+
+	value, err := base64.StdEncoding.DecodeString(entries[0].Value)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode consul value: %w", err)
+	}
+	return value, entries[0].ModifyIndex, nil
+}
+
+// put writes the value with a check-and-set on index and reports whether it was applied
+func (w *ConsulWriter) put(value []byte, index uint64) (bool, error) {
+	query := url.Values{}
+	query.Set("cas", strconv.FormatUint(index, 10))
+
+	resp, err := w.do(http.MethodPut, query, value)
+	if err != nil {
+		return false, fmt.Errorf("failed to write consul key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("consul write failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return strings.TrimSpace(string(body)) == "true", nil
+}
+
+// do sends a request for the configured key
+func (w *ConsulWriter) do(method string, query url.Values, body []byte) (*http.Response, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if w.cfg.Datacenter != "" {
+		query.Set("dc", w.cfg.Datacenter)
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/kv/%s", w.cfg.Address, w.cfg.Key)
+	if encoded := query.Encode(); encoded != "" {
+		endpoint += "?" + encoded
+	}
+
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if w.cfg.Token != "" {
+		req.Header.Set("X-Consul-Token", w.cfg.Token)
+	}
+	return w.httpClient.Do(req)
+}
+
+// hashValue returns the hex SHA-256 of a value
+func hashValue(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Outcomes of a recorded sync cycle
+const (
+	OutcomeSuccess = "success" // The cycle ran to completion
+	OutcomeSkipped = "skipped" // Frozen, or the version record was unchanged
+	OutcomeFailed  = "failed"  // The cycle returned an error
+	OutcomeAborted = "aborted" // The cycle was interrupted by shutdown
+)
+
+// Cycle is the result of one sync cycle as kept in the history
+type Cycle struct {
+	Time     time.Time `json:"time"`
+	Outcome  string    `json:"outcome"`
+	Changed  bool      `json:"changed"`
+	Duration float64   `json:"duration_seconds"`
+	Users    *int      `json:"users,omitempty"` // Nil when the cycle did not fetch users
+	Roles    *int      `json:"roles,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// History keeps the most recent sync cycles in a fixed-size ring buffer
+type History struct {
+	mutex  sync.Mutex
+	cycles []Cycle
+	next   int  // Index the next cycle is written to
+	full   bool // Whether the buffer has wrapped around
+}
+
+// NewHistory creates a history holding the last size cycles
+func NewHistory(size int) *History {
+	return &History{cycles: make([]Cycle, size)}
+}
+
+// Record adds a cycle, overwriting the oldest once the buffer is full
+func (h *History) Record(cycle Cycle) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.cycles[h.next] = cycle
+	h.next = (h.next + 1) % len(h.cycles)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Cycles returns the recorded cycles, newest first
+func (h *History) Cycles() []Cycle {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.cycles)
+	}
+	cycles := make([]Cycle, 0, count)
+	for i := 1; i <= count; i++ {
+		cycles = append(cycles, h.cycles[(h.next-i+len(h.cycles))%len(h.cycles)])
+	}
+	return cycles
+}
+
+// ServeHTTP writes the recorded cycles as JSON, newest first
+func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(struct {
+		Size   int     `json:"size"`
+		Cycles []Cycle `json:"cycles"`
+	}{len(h.cycles), h.Cycles()})
+}
@@ -0,0 +1,250 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// namespace prefixes every exported metric name
+const namespace = "nats_pocketbase_sync"
+
+// durationBuckets are the upper bounds, in seconds, of the cycle duration histogram
+var durationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics tracks sync health and renders it in the Prometheus text exposition format.
+// It has no dependency on the Prometheus client library.
+type Metrics struct {
+	mutex       sync.Mutex
+	cycles      uint64
+	failures    uint64
+	lastSuccess time.Time
+	users       int
+	roles       int
+	fingerprint string // Fingerprint of the config in place, empty before the first write
+
+	// Cumulative histogram of cycle durations
+	bucketCounts  []uint64
+	durationSum   float64
+	durationCount uint64
+
+	// Outcomes of the clusters applied on their own, by cluster name
+	clusters map[string]*ClusterHealth
+}
+
+// ClusterHealth is the state of one cluster as served at the cluster health endpoint
+type ClusterHealth struct {
+	Name                string     `json:"name"`
+	Healthy             bool       `json:"healthy"` // The last apply succeeded
+	Applies             uint64     `json:"applies"`
+	Failures            uint64     `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"` // Nil before the first success
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// New creates an empty set of metrics
+func New() *Metrics {
+	return &Metrics{
+		bucketCounts: make([]uint64, len(durationBuckets)),
+		clusters:     make(map[string]*ClusterHealth),
+	}
+}
+
+// ObserveCluster records one apply of a cluster's config and whether it failed
+func (m *Metrics) ObserveCluster(name string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	c, ok := m.clusters[name]
+	if !ok {
+		c = &ClusterHealth{Name: name}
+		m.clusters[name] = c
+	}
+	c.Applies++
+	c.Healthy = err == nil
+	if err != nil {
+		c.Failures++
+		c.ConsecutiveFailures++
+		c.LastError = err.Error()
+		return
+	}
+	now := time.Now()
+	c.ConsecutiveFailures = 0
+	c.LastSuccess = &now
+	c.LastError = ""
+}
+
+// Clusters returns the state of every observed cluster, sorted by name
+func (m *Metrics) Clusters() []ClusterHealth {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.sortedClusters()
+}
+
+// sortedClusters copies the cluster states in name order. The caller holds the mutex.
+func (m *Metrics) sortedClusters() []ClusterHealth {
+	clusters := make([]ClusterHealth, 0, len(m.clusters))
+	for _, c := range m.clusters {
+		clusters = append(clusters, *c)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+	return clusters
+}
+
+// ClusterHealthHandler serves the state of every cluster as JSON. The status is
+// 503 while any cluster's last apply failed, so it can back a health check.
+func (m *Metrics) ClusterHealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clusters := m.Clusters()
+		status := http.StatusOK
+		for _, c := range clusters {
+			if !c.Healthy {
+				status = http.StatusServiceUnavailable
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(struct {
+			Clusters []ClusterHealth `json:"clusters"`
+		}{clusters})
+	})
+}
+
+// ObserveCycle records a finished sync cycle and whether it failed
+func (m *Metrics) ObserveCycle(duration time.Duration, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.cycles++
+	if err != nil {
+		m.failures++
+	} else {
+		m.lastSuccess = time.Now()
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			m.bucketCounts[i]++
+		}
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+// SetConfigFingerprint records the fingerprint of the config now in place
+func (m *Metrics) SetConfigFingerprint(fingerprint string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.fingerprint = fingerprint
+}
+
+// SetCounts records the number of users and roles fetched from PocketBase
+func (m *Metrics) SetCounts(users, roles int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.users = users
+	m.roles = roles
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var lastSuccess float64
+	if !m.lastSuccess.IsZero() {
+		lastSuccess = float64(m.lastSuccess.UnixNano()) / 1e9
+	}
+
+	cw := &countingWriter{w: w}
+	writeMetric(cw, "cycles_total", "counter", "Sync cycles run, including failed ones.", float64(m.cycles))
+	writeMetric(cw, "cycle_failures_total", "counter", "Sync cycles that failed.", float64(m.failures))
+	writeMetric(cw, "last_success_timestamp_seconds", "gauge", "Unix time of the last successful sync cycle, 0 before the first.", lastSuccess)
+	writeMetric(cw, "users", "gauge", "Active users fetched from PocketBase in the last cycle.", float64(m.users))
+	writeMetric(cw, "roles", "gauge", "Roles fetched from PocketBase in the last cycle.", float64(m.roles))
+	if m.fingerprint != "" {
+		name := namespace + "_config_info"
+		fmt.Fprintf(cw, "# HELP %s Fingerprint of the config in place, as a label.\n# TYPE %s gauge\n%s{fingerprint=%q} 1\n",
+			name, name, name, m.fingerprint)
+	}
+
+	name := namespace + "_cycle_duration_seconds"
+	fmt.Fprintf(cw, "# HELP %s Duration of sync cycles.\n# TYPE %s histogram\n", name, name)
+	for i, bound := range durationBuckets {
+		fmt.Fprintf(cw, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), m.bucketCounts[i])
+	}
+	fmt.Fprintf(cw, "%s_bucket{le=\"+Inf\"} %d\n", name, m.durationCount)
+	fmt.Fprintf(cw, "%s_sum %s\n%s_count %d\n", name, formatFloat(m.durationSum), name, m.durationCount)
+
+	if clusters := m.sortedClusters(); len(clusters) > 0 {
+		writeClusterMetric(cw, clusters, "cluster_applies_total", "counter", "Config applies per cluster, including failed ones.",
+			func(c ClusterHealth) float64 { return float64(c.Applies) })
+		writeClusterMetric(cw, clusters, "cluster_failures_total", "counter", "Failed config applies per cluster.",
+			func(c ClusterHealth) float64 { return float64(c.Failures) })
+		writeClusterMetric(cw, clusters, "cluster_healthy", "gauge", "1 when the cluster's last apply succeeded, 0 when it failed.",
+			func(c ClusterHealth) float64 {
+				if c.Healthy {
+					return 1
+				}
+				return 0
+			})
+		writeClusterMetric(cw, clusters, "cluster_last_success_timestamp_seconds", "gauge", "Unix time of the cluster's last successful apply, 0 before the first.",
+			func(c ClusterHealth) float64 {
+				if c.LastSuccess == nil {
+					return 0
+				}
+				return float64(c.LastSuccess.UnixNano()) / 1e9
+			})
+	}
+	return cw.n, cw.err
+}
+
+// writeClusterMetric writes a counter or gauge with one sample per cluster, labelled by name
+func writeClusterMetric(w io.Writer, clusters []ClusterHealth, name, kind, help string, value func(ClusterHealth) float64) {
+	name = namespace + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, c := range clusters {
+		fmt.Fprintf(w, "%s{cluster=%q} %s\n", name, c.Name, formatFloat(value(c)))
+	}
+}
+
+// writeMetric writes a single unlabelled counter or gauge with its help and type lines
+func writeMetric(w io.Writer, name, kind, help string, value float64) {
+	name = namespace + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, kind, name, formatFloat(value))
+}
+
+// formatFloat formats a sample value the way Prometheus parses it
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// countingWriter counts written bytes and keeps the first write error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
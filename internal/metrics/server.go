@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// shutdownTimeout bounds how long in-flight scrapes may take when the server stops
+const shutdownTimeout = 5 * time.Second
+
+// Server serves the metrics endpoint and any other status handlers
+type Server struct {
+	server   *http.Server
+	mux      *http.ServeMux
+	listener net.Listener
+	logger   *zap.Logger
+}
+
+// NewServer creates a server listening on addr, e.g. ":9090"
+func NewServer(addr string, logger *zap.Logger) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		mux:    mux,
+		logger: logger,
+	}
+}
+
+// Handle registers a handler for the given path. Call it before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start binds the address and serves in the background.
+// Binding happens before it returns, so an address in use is reported at once.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	s.listener = listener
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Metrics server failed", zap.Error(err))
+		}
+	}()
+
+	s.logger.Info("Serving metrics", zap.String("addr", listener.Addr().String()))
+	return nil
+}
+
+// Shutdown stops accepting connections and waits briefly for in-flight requests
+func (s *Server) Shutdown() {
+	if s.listener == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.Warn("Failed to shut down metrics server", zap.Error(err))
+	}
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"bytes"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -11,7 +13,31 @@ import (
 const NatsConfigTemplate = `
 # MQTT Authentication Configuration
 # Auto-generated by nats-pocketbase-sync
-
+{{ if .SchemaVersion }}
+# schema: {{ .SchemaVersion }}
+{{ end }}
+{{ with .SecretsInclude }}
+include "{{ . }}"
+{{ end }}
+{{ if .WrapAccount }}
+accounts {
+  # All users, wrapped in one account
+  {{ .WrapAccount }} = {
+    default_permissions = {
+      publish = {{ .DefaultPublish }}
+      subscribe = {{ .DefaultSubscribe }}
+    }
+    users = [
+      {{ range .Users }}
+      { {{- template "credentials" . }}, permissions: {publish: {{ .PublishPermissions }}, subscribe: {{ .SubscribePermissions }}{{ template "allow_responses" . }}}{{ template "connection_types" . }}}{{ if not .IsLast }},{{ end }}
+      {{ end }}
+    ]
+  }
+  {{ with .MonitoringUser }}
+  {{ template "monitoring_account" . }}
+  {{ end }}
+}
+{{ else }}
 authorization {
   # Default permissions applied to all users
   default_permissions = {
@@ -19,21 +45,148 @@ authorization {
     subscribe = {{ .DefaultSubscribe }}
   }
 
+  {{ if .AuthToken }}
+  # Shared token authorizing every client
+  token: {{ with .AuthTokenVar }}${{ . }}{{ else }}"{{ .AuthToken }}"{{ end }}
+  {{ else }}
   # Role definitions
   {{ range .Roles }}
+  {{ range .Comments }}
+  # {{ . }}
+  {{ end }}
   {{ .Name }} = {
     publish = {{ .PublishPermissions }}
     subscribe = {{ .SubscribePermissions }}
+    {{ with .AllowResponses }}
+    allow_responses = {{ . }}
+    {{ end }}
   }
   {{ end }}
 
   # User definitions
   users = [
     {{ range .Users }}
-    {user: {{ .Username }}, password: "{{ .Password }}", permissions: ${{ .RoleName }}}{{ if not .IsLast }},{{ end }}
+    { {{- template "credentials" . }}, permissions: {{ if .InlinePermissions }}{publish: {{ .PublishPermissions }}, subscribe: {{ .SubscribePermissions }}{{ template "allow_responses" . }}}{{ else }}${{ .RoleName }}{{ end }}{{ template "connection_types" . }}}{{ if not .IsLast }},{{ end }}
     {{ end }}
   ]
+  {{ end }}
+}
+{{ with .MonitoringUser }}
+accounts {
+  {{ template "monitoring_account" . }}
+}
+{{ end }}
+{{ end }}
+{{ with .Leafnodes }}
+{{ template "leafnodes" . }}
+{{ end }}
+`
+
+// NatsAccountsConfigTemplate is the template for the NATS configuration file in accounts mode
+const NatsAccountsConfigTemplate = `
+# MQTT Authentication Configuration
+# Auto-generated by nats-pocketbase-sync
+{{ if .SchemaVersion }}
+# schema: {{ .SchemaVersion }}
+{{ end }}
+{{ with .SecretsInclude }}
+include "{{ . }}"
+{{ end }}
+accounts {
+  {{ range .Accounts }}
+  {{ if .GroupHeader }}
+  # ==== {{ with .Group }}{{ . }}{{ else }}ungrouped{{ end }} ====
+  {{ end }}
+  {{ template "account" . }}
+  {{ end }}
+  {{ range .AccountIncludes }}
+  include "{{ . }}"
+  {{ end }}
+  {{ with .MonitoringUser }}
+  {{ template "monitoring_account" . }}
+  {{ end }}
+}
+{{ with .SystemAccount }}
+system_account: "{{ . }}"
+{{ end }}
+{{ with .Leafnodes }}
+{{ template "leafnodes" . }}
+{{ end }}
+`
+
+// NatsAccountFileTemplate is the template for a single account include file
+const NatsAccountFileTemplate = `
+# Account {{ .Name }}
+# Auto-generated by nats-pocketbase-sync
+
+{{ template "account" . }}
+`
+
+// NatsSecretsTemplate is the template for the secrets include file defining password variables
+const NatsSecretsTemplate = `
+# MQTT Authentication Secrets
+# Auto-generated by nats-pocketbase-sync
+{{ range . }}
+{{ .Name }}: "{{ .Value }}"
+{{ end }}
+`
+
+// natsSharedTemplates contains the blocks shared by the config templates
+const natsSharedTemplates = `
+{{ define "connection_types" }}{{ with .AllowedConnectionTypes }}, allowed_connection_types: {{ . }}{{ end }}{{ end }}
+{{ define "allow_responses" }}{{ with .AllowResponses }}, allow_responses: {{ . }}{{ end }}{{ end }}
+{{ define "credentials" }}{{ if .NKey }}nkey: "{{ .NKey }}"{{ else }}user: {{ .Username }}, password: {{ template "password" . }}{{ end }}{{ end }}
+{{ define "password" }}{{ if .PasswordVar }}${{ .PasswordVar }}{{ else }}"{{ .Password }}"{{ end }}{{ end }}
+{{ define "account" }}
+  {{ range .Comments }}
+  # {{ . }}
+  {{ end }}
+  {{ .Name }} = {
+    users = [
+      {{ range .Users }}
+      { {{- template "credentials" . }}, permissions: {publish: {{ .PublishPermissions }}, subscribe: {{ .SubscribePermissions }}{{ template "allow_responses" . }}}{{ template "connection_types" . }}}{{ if not .IsLast }},{{ end }}
+      {{ end }}
+    ]
+    {{ with .Limits }}
+    limits {
+      {{ with .MaxConnections }}max_connections: {{ . }}{{ end }}
+      {{ with .MaxSubscriptions }}max_subscriptions: {{ . }}{{ end }}
+      {{ with .MaxPayload }}max_payload: {{ . }}{{ end }}
+      {{ with .MaxLeafnodes }}max_leafnodes: {{ . }}{{ end }}
+    }
+    {{ end }}
+    {{ with .Mappings }}
+    mappings = {
+      {{ range . }}
+      "{{ .From }}": {{ .Destinations }}
+      {{ end }}
+    }
+    {{ end }}
+  }
+{{ end }}
+
+{{ define "leafnodes" }}
+# Leafnode connections from edge servers
+leafnodes {
+  port: {{ .Port }}
+  authorization {
+    users = [
+      {{ range .Users }}
+      {user: {{ .Username }}, password: {{ template "password" . }}{{ if $.AccountsMode }}, account: "{{ .RoleName }}"{{ else }}{{ with $.Account }}, account: "{{ . }}"{{ end }}{{ end }}}{{ if not .IsLast }},{{ end }}
+      {{ end }}
+    ]
+  }
 }
+{{ end }}
+
+{{ define "monitoring_account" }}
+  # System account monitoring user (read-only)
+  {{ .Account }} = {
+    users = [
+      {user: {{ .Username }}, password: {{ template "password" . }}, permissions: {publish: {deny: ">"}, subscribe: {{ .SubscribePermissions }}}}
+    ]
+  }
+{{ end }}
 `
 
 // NatsConfigData contains the data for the NATS configuration template
@@ -42,29 +195,138 @@ type NatsConfigData struct {
 	DefaultSubscribe string
 	Roles           []NatsRole
 	Users           []NatsUser
+	MonitoringUser  *NatsMonitoringUser
+	SecretsInclude  string       // Include path of the secrets file when passwords are variables
+	Secrets         []NatsSecret // Password variables defined in the secrets file
+
+	// Accounts mode: each role becomes an account containing its users
+	AccountsMode    bool
+	Accounts        []NatsAccount
+	AccountIncludes []string // Include paths for accounts written to separate files
+	SystemAccount   string   // Account designated as the NATS system account
+	Leafnodes       *NatsLeafnodes // Hub-side leafnode users, if enabled
+	SchemaVersion   int            // Schema version marked in the config, 0 for no marker
+	WrapAccount     string         // Account wrapping all users instead of the authorization block, empty for none
+	AuthToken       string         // Shared token emitted instead of users, empty for user authorization
+	AuthTokenVar    string         // Variable holding the token, if secrets are split out
+}
+
+// NatsLeafnodes represents the hub-side leafnodes block. Leafnode users authenticate
+// edge servers and are bound to their role's account in accounts mode.
+type NatsLeafnodes struct {
+	Port         int
+	AccountsMode bool
+	Account      string // Account all leafnode users are bound to when users are wrapped in one account
+	Users        []NatsUser
+}
+
+// NatsSecret is a password variable defined in the secrets file
+type NatsSecret struct {
+	Name  string
+	Value string
+}
+
+// NatsAccount represents an account in the NATS configuration
+type NatsAccount struct {
+	Name                 string
+	PublishPermissions   string
+	SubscribePermissions string
+	Users                []NatsUser
+	Mappings             []NatsMapping
+	Comments             []string // Operator annotations emitted above the account
+	SortOrder            int      // Priority from the role, lower first
+	Group                string   // Group from the role, empty when ungrouped
+	GroupHeader          bool     // First account of its group, emitted with a separator comment
+	IsLast               bool     // Last account in the output
+	Limits               *NatsAccountLimits // Aggregate limits, nil when none are set
+}
+
+// NatsAccountLimits are aggregate limits enforced across all users of an account.
+// Zero fields are omitted.
+type NatsAccountLimits struct {
+	MaxConnections   int
+	MaxSubscriptions int
+	MaxPayload       int
+	MaxLeafnodes     int
+}
+
+// NatsMapping represents a subject mapping within an account
+type NatsMapping struct {
+	From         string
+	Destinations string // A quoted subject or a list of weighted destinations
+}
+
+// NatsMonitoringUser represents a static read-only user in the system account
+type NatsMonitoringUser struct {
+	Account              string
+	Username             string
+	Password             string
+	PasswordVar          string // Variable holding the password, if secrets are split out
+	SubscribePermissions string
 }
 
 // NatsRole represents a role in the NATS configuration
 type NatsRole struct {
 	Name                string
-	PublishPermissions  string
+	PublishPermissions  string // Allowed subjects, combined with PublishDeny when it is set
 	SubscribePermissions string
+	PublishDeny         string // Denied subjects, also applied to users with inline permissions
+	SubscribeDeny       string
+	AllowResponses      string // Formatted response permission, empty when replies are not allowed
+	Comments            []string // Operator annotations emitted above the role
+	SortOrder           int      // Account priority in accounts mode
+	Group               string   // Account group in accounts mode
+	Limits              *NatsAccountLimits // Account limits in accounts mode
 }
 
 // NatsUser represents a user in the NATS configuration
 type NatsUser struct {
-	Username string
+	Username string // Quoted for the config file
+	Name     string // Username as stored in PocketBase
+	RecordID string // PocketBase record ID, used as a sort tiebreaker
 	Password string
+	PasswordVar string // Variable holding the password, if secrets are split out
+	ClientPassword string // Plaintext for client credentials when Password is a generated hash
+	NKey     string // Public user nkey, emitted instead of the username and password when set
 	RoleName string
 	IsLast   bool
+	Leaf     bool // Also emitted as a leafnode user
+	AllowedConnectionTypes string // Formatted list of connection types, empty when unrestricted
+
+	// Effective permissions after applying the precedence chain
+	PublishPermissions   string
+	SubscribePermissions string
+	InlinePermissions    bool // The user overrides its role, so permissions are emitted inline
+	AllowResponses       string // The role's response permission, emitted with inline permissions
 }
 
 // FormatConfigFile formats the NATS configuration file using the template and data
 func FormatConfigFile(data *NatsConfigData) (string, error) {
-	tmpl, err := template.New("nats_config").Parse(NatsConfigTemplate)
+	if data.AccountsMode {
+		return renderTemplate(NatsAccountsConfigTemplate, data)
+	}
+	return renderTemplate(NatsConfigTemplate, data)
+}
+
+// FormatAccountFile formats a single account as a standalone include file
+func FormatAccountFile(account *NatsAccount) (string, error) {
+	return renderTemplate(NatsAccountFileTemplate, account)
+}
+
+// FormatSecretsFile formats the secrets include file
+func FormatSecretsFile(secrets []NatsSecret) (string, error) {
+	return renderTemplate(NatsSecretsTemplate, secrets)
+}
+
+// renderTemplate executes a config template with the shared blocks and cleans up the output
+func renderTemplate(text string, data interface{}) (string, error) {
+	tmpl, err := template.New("nats_config").Parse(text)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %w", err)
 	}
+	if _, err := tmpl.Parse(natsSharedTemplates); err != nil {
+		return "", fmt.Errorf("failed to parse shared templates: %w", err)
+	}
 
 	var output bytes.Buffer
 	if err := tmpl.Execute(&output, data); err != nil {
@@ -84,6 +346,122 @@ func FormatConfigFile(data *NatsConfigData) (string, error) {
 	return strings.Join(cleanedLines, "\n"), nil
 }
 
+// FormatPermissionList formats a list of subjects as a single quoted subject or an array
+func FormatPermissionList(permissions []string) string {
+	if len(permissions) == 0 {
+		return `""`
+	}
+
+	if len(permissions) == 1 {
+		return `"` + permissions[0] + `"`
+	}
+
+	quoted := make([]string, len(permissions))
+	for i, perm := range permissions {
+		quoted[i] = `"` + perm + `"`
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// FormatPermissionBlock combines formatted allow and deny lists into one direction of a
+// NATS permission block. Without a deny list the allow list is used as is, so no empty
+// deny block is ever emitted.
+func FormatPermissionBlock(allow, deny string) string {
+	if deny == "" || deny == `""` {
+		return allow
+	}
+	if allow == "" || allow == `""` {
+		return "{deny: " + deny + "}"
+	}
+	return "{allow: " + allow + ", deny: " + deny + "}"
+}
+
+// permissionTokens matches the keys and quoted subjects of a formatted permission
+var permissionTokens = regexp.MustCompile(`allow:|deny:|"[^"]*"`)
+
+// AllowedSubjects returns the subjects a formatted permission, as built by
+// FormatPermissionList or FormatPermissionBlock, allows. Denied subjects and
+// queue groups are left out.
+func AllowedSubjects(permission string) []string {
+	var subjects []string
+	deny := false
+	for _, token := range permissionTokens.FindAllString(permission, -1) {
+		switch token {
+		case "allow:":
+			deny = false
+		case "deny:":
+			deny = true
+		default:
+			subject, _, _ := strings.Cut(strings.Trim(token, `"`), " ")
+			if !deny && subject != "" {
+				subjects = append(subjects, subject)
+			}
+		}
+	}
+	return subjects
+}
+
+// ValidateSubject checks that a subject has no empty tokens, no whitespace or quotes, uses
+// wildcards only as whole tokens, and uses ">" only as its last token. NATS itself accepts
+// a token like "foo*", but as a literal rather than a wildcard, so it is most likely a typo.
+func ValidateSubject(subject string) error {
+	if subject == "" {
+		return fmt.Errorf("subject is empty")
+	}
+	if strings.ContainsAny(subject, " \t\r\n\"") {
+		return fmt.Errorf("subject %q contains whitespace or quotes", subject)
+	}
+
+	tokens := strings.Split(subject, ".")
+	for i, token := range tokens {
+		switch {
+		case token == "":
+			return fmt.Errorf("subject %q has an empty token", subject)
+		case token == ">" && i != len(tokens)-1:
+			return fmt.Errorf("subject %q uses > before the last token", subject)
+		case token != "*" && token != ">" && strings.ContainsAny(token, "*>"):
+			return fmt.Errorf("subject %q uses a wildcard inside the token %q", subject, token)
+		}
+	}
+	return nil
+}
+
+// ValidatePermissionSubject checks a subject permission entry, which may name a queue
+// group after the subject, e.g. "orders.* workers"
+func ValidatePermissionSubject(entry string) error {
+	subject, queue, hasQueue := strings.Cut(entry, " ")
+	if err := ValidateSubject(subject); err != nil {
+		return err
+	}
+	if hasQueue && (queue == "" || strings.ContainsAny(queue, " \t\r\n\"")) {
+		return fmt.Errorf("permission %q must be a subject optionally followed by one queue group", entry)
+	}
+	return nil
+}
+
+// PermissionList converts a configured permission (a string or a list of strings) to a list of subjects
+func PermissionList(permission interface{}) []string {
+	switch p := permission.(type) {
+	case string:
+		if p == "" {
+			return nil
+		}
+		return []string{p}
+	case []interface{}:
+		var subjects []string
+		for _, item := range p {
+			if subject, ok := item.(string); ok {
+				subjects = append(subjects, subject)
+			}
+		}
+		return subjects
+	case []string:
+		return p
+	default:
+		return nil
+	}
+}
+
 // FormatDefaultPermissions formats the default permissions for NATS config
 func FormatDefaultPermissions(publish, subscribe interface{}) (string, string) {
 	// Format publish permission
@@ -134,3 +512,21 @@ func FormatDefaultPermissions(publish, subscribe interface{}) (string, string) {
 
 	return publishStr, subscribeStr
 }
+
+
+// ParseSchemaMarker returns the version in a config's "# schema: N" comment, or false
+// if the config has none
+func ParseSchemaMarker(content string) (int, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(line), "# schema:")
+		if !ok {
+			continue
+		}
+		version, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return 0, false
+		}
+		return version, true
+	}
+	return 0, false
+}
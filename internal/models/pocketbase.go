@@ -1,7 +1,9 @@
 package models
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -67,13 +69,43 @@ func (ft FlexibleTime) Time() time.Time {
 	return time.Time(ft)
 }
 
+// FlexibleStringList decodes a PocketBase select field, which is a string when the field
+// allows a single choice and an array when it allows several
+type FlexibleStringList []string
+
+// UnmarshalJSON accepts a string, an array of strings or null
+func (l *FlexibleStringList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = list
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %w", err)
+	}
+	*l = nil
+	if single != "" {
+		*l = FlexibleStringList{single}
+	}
+	return nil
+}
+
 // MqttUser represents a user in the PocketBase MQTT users collection
 type MqttUser struct {
 	ID              string        `json:"id"`
 	Username        string        `json:"username"`
 	Password        string        `json:"password"`
+	NKey            string        `json:"nkey,omitempty"` // Optional public user nkey, used instead of the password
 	RoleID          string        `json:"role_id"`
 	Active          bool          `json:"active"`
+	PublishPermissions   json.RawMessage `json:"publish_permissions,omitempty"`   // Optional, overrides the role
+	SubscribePermissions json.RawMessage `json:"subscribe_permissions,omitempty"` // Optional, overrides the role
+	PreviousPassword string       `json:"previous_password,omitempty"` // Not emitted, see README
+	ExpiresAt       FlexibleTime  `json:"expires_at"` // Optional, zero means the user never expires
+	Leaf            bool          `json:"leaf,omitempty"` // Optional, also authenticates leafnode connections
+	AllowedConnectionTypes FlexibleStringList `json:"allowed_connection_types,omitempty"` // Optional multi-select, empty means unrestricted
 	CollectionID    string        `json:"collectionId,omitempty"`
 	CollectionName  string        `json:"collectionName,omitempty"`
 	Created         FlexibleTime  `json:"created"`
@@ -86,12 +118,47 @@ type MqttRole struct {
 	Name                 string        `json:"name"`
 	PublishPermissions   json.RawMessage `json:"publish_permissions"`
 	SubscribePermissions json.RawMessage `json:"subscribe_permissions"`
+	DefaultPublishPermissions   json.RawMessage `json:"default_publish_permissions,omitempty"`   // Used when publish_permissions is empty
+	DefaultSubscribePermissions json.RawMessage `json:"default_subscribe_permissions,omitempty"` // Used when subscribe_permissions is empty
+	PublishDenyPermissions      json.RawMessage `json:"publish_deny,omitempty"`   // Optional, denied even where publishing is allowed
+	SubscribeDenyPermissions    json.RawMessage `json:"subscribe_deny,omitempty"` // Optional, denied even where subscribing is allowed
+	AllowResponses              json.RawMessage `json:"allow_responses,omitempty"` // Optional, true or {"max": n, "expires": "1m"}
+	ParentRoleID         string        `json:"parent_role,omitempty"` // Optional relation, see README
+	Mappings             json.RawMessage `json:"mappings,omitempty"`
+	Enabled              *bool         `json:"enabled,omitempty"` // Missing means enabled
+	Description          string        `json:"description,omitempty"`
+	Metadata             map[string]interface{} `json:"metadata,omitempty"` // Free-form operator metadata, e.g. owner or ticket
+	SortOrder            int           `json:"sort_order,omitempty"` // Optional priority, lower accounts are emitted first
+	Group                string        `json:"group,omitempty"`      // Optional account group, see README
+
+	// Optional limits, aggregate for the role's account in accounts mode and per user in
+	// resolver scope templates, 0 when unset. PocketBase number fields may hold fractions,
+	// so they are validated where they are applied.
+	MaxConnections   float64 `json:"max_connections,omitempty"`
+	MaxSubscriptions float64 `json:"max_subscriptions,omitempty"`
+	MaxPayload       float64 `json:"max_payload,omitempty"`
+	MaxLeafnodes     float64 `json:"max_leafnodes,omitempty"`
 	CollectionID         string        `json:"collectionId,omitempty"`
 	CollectionName       string        `json:"collectionName,omitempty"`
 	Created              FlexibleTime  `json:"created"`
 	Updated              FlexibleTime  `json:"updated"`
 }
 
+// SubjectMapping is a subject transform applied within an account.
+// Weight is a percentage; mappings sharing a From subject with weights split traffic.
+type SubjectMapping struct {
+	From   string `json:"from" mapstructure:"from"`
+	To     string `json:"to" mapstructure:"to"`
+	Weight int    `json:"weight,omitempty" mapstructure:"weight"`
+}
+
+// ResponsePermission lets users of a role reply to requests on subjects they could not
+// otherwise publish to. Zero fields fall back to the NATS defaults.
+type ResponsePermission struct {
+	MaxMsgs int    `json:"max"`     // Replies allowed per request
+	Expires string `json:"expires"` // How long a reply subject stays usable, e.g. "1m"
+}
+
 // PocketBaseListResponse represents a generic list response from PocketBase
 type PocketBaseListResponse[T any] struct {
 	Page       int    `json:"page"`
@@ -112,6 +179,11 @@ type PocketBaseAuthResponse struct {
 	Record interface{} `json:"record"`
 }
 
+// IsEnabled reports whether the role should be emitted. Roles without the field are enabled.
+func (r *MqttRole) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
 // NormalizeRoleName ensures the role name is valid for NATS config
 func (r *MqttRole) NormalizeRoleName() string {
 	// Convert to uppercase and replace spaces/special chars with underscores
@@ -132,7 +204,7 @@ func (r *MqttRole) NormalizeRoleName() string {
 // GetPublishPermissions extracts the string array from JSON field
 func (r *MqttRole) GetPublishPermissions() ([]string, error) {
 	var permissions []string
-	if len(r.PublishPermissions) == 0 {
+	if isEmptyJSON(r.PublishPermissions) {
 		return permissions, nil
 	}
 	
@@ -145,7 +217,7 @@ func (r *MqttRole) GetPublishPermissions() ([]string, error) {
 // GetSubscribePermissions extracts the string array from JSON field
 func (r *MqttRole) GetSubscribePermissions() ([]string, error) {
 	var permissions []string
-	if len(r.SubscribePermissions) == 0 {
+	if isEmptyJSON(r.SubscribePermissions) {
 		return permissions, nil
 	}
 	
@@ -155,6 +227,85 @@ func (r *MqttRole) GetSubscribePermissions() ([]string, error) {
 	return permissions, nil
 }
 
+// GetPublishDenyPermissions extracts the denied publish subjects from the JSON field
+func (r *MqttRole) GetPublishDenyPermissions() ([]string, error) {
+	var permissions []string
+	if isEmptyJSON(r.PublishDenyPermissions) {
+		return permissions, nil
+	}
+
+	if err := json.Unmarshal(r.PublishDenyPermissions, &permissions); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// GetSubscribeDenyPermissions extracts the denied subscribe subjects from the JSON field
+func (r *MqttRole) GetSubscribeDenyPermissions() ([]string, error) {
+	var permissions []string
+	if isEmptyJSON(r.SubscribeDenyPermissions) {
+		return permissions, nil
+	}
+
+	if err := json.Unmarshal(r.SubscribeDenyPermissions, &permissions); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// GetMappings extracts the subject mappings from the JSON field
+func (r *MqttRole) GetMappings() ([]SubjectMapping, error) {
+	var mappings []SubjectMapping
+	if len(r.Mappings) == 0 || string(r.Mappings) == "null" {
+		return mappings, nil
+	}
+
+	if err := json.Unmarshal(r.Mappings, &mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+// ParsePermissions extracts a subject list from a JSON permission field.
+// Empty, null and malformed fields yield no subjects; use CheckPermissions to tell them apart.
+func ParsePermissions(field json.RawMessage) []string {
+	var permissions []string
+	if isEmptyJSON(field) {
+		return nil
+	}
+	if err := json.Unmarshal(field, &permissions); err != nil {
+		return nil
+	}
+	return permissions
+}
+
+// CheckPermissions reports whether a JSON permission field is malformed.
+// Missing and null fields mean no permissions and are not an error.
+func CheckPermissions(field json.RawMessage) error {
+	if isEmptyJSON(field) {
+		return nil
+	}
+	var permissions []string
+	if err := json.Unmarshal(field, &permissions); err != nil {
+		return fmt.Errorf("expected a JSON array of subjects, got %s", truncate(string(field), 64))
+	}
+	return nil
+}
+
+// isEmptyJSON reports whether a JSON field is missing or explicitly null
+func isEmptyJSON(field json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(field)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+// truncate shortens s to at most n bytes for log messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
 // FormatPublishPermissions formats the publish permissions for NATS config
 func (r *MqttRole) FormatPublishPermissions() string {
 	permissions, err := r.GetPublishPermissions()
@@ -212,3 +363,77 @@ func (r *MqttRole) FormatSubscribePermissions() string {
 	
 	return result.String()
 }
+
+// FormatPublishDenyPermissions formats the denied publish subjects for NATS config,
+// `""` when there are none
+func (r *MqttRole) FormatPublishDenyPermissions() string {
+	permissions, err := r.GetPublishDenyPermissions()
+	if err != nil {
+		return `""`
+	}
+	return FormatPermissionList(permissions)
+}
+
+// FormatSubscribeDenyPermissions formats the denied subscribe subjects for NATS config,
+// `""` when there are none
+func (r *MqttRole) FormatSubscribeDenyPermissions() string {
+	permissions, err := r.GetSubscribeDenyPermissions()
+	if err != nil {
+		return `""`
+	}
+	return FormatPermissionList(permissions)
+}
+
+// GetAllowResponses extracts the response permission from the JSON field, nil when the
+// field is missing, null or false. A bare true yields a permission with zero fields.
+func (r *MqttRole) GetAllowResponses() (*ResponsePermission, error) {
+	if isEmptyJSON(r.AllowResponses) {
+		return nil, nil
+	}
+
+	var enabled bool
+	if err := json.Unmarshal(r.AllowResponses, &enabled); err == nil {
+		if !enabled {
+			return nil, nil
+		}
+		return &ResponsePermission{}, nil
+	}
+
+	var permission ResponsePermission
+	decoder := json.NewDecoder(bytes.NewReader(r.AllowResponses))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&permission); err != nil {
+		return nil, fmt.Errorf("expected true or an object with max and expires, got %s", truncate(string(r.AllowResponses), 64))
+	}
+	if permission.MaxMsgs < 0 {
+		return nil, fmt.Errorf("max must not be negative, got %d", permission.MaxMsgs)
+	}
+	if permission.Expires != "" {
+		expires, err := time.ParseDuration(permission.Expires)
+		if err != nil || expires <= 0 {
+			return nil, fmt.Errorf("expires must be a positive duration, got %q", permission.Expires)
+		}
+	}
+	return &permission, nil
+}
+
+// FormatAllowResponses formats the response permission for NATS config, empty when the
+// role has none. Malformed fields are treated as unset; the generator reports them.
+func (r *MqttRole) FormatAllowResponses() string {
+	permission, err := r.GetAllowResponses()
+	if err != nil || permission == nil {
+		return ""
+	}
+
+	var fields []string
+	if permission.MaxMsgs > 0 {
+		fields = append(fields, fmt.Sprintf("max: %d", permission.MaxMsgs))
+	}
+	if permission.Expires != "" {
+		fields = append(fields, fmt.Sprintf("expires: %q", permission.Expires))
+	}
+	if len(fields) == 0 {
+		return "true"
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
@@ -0,0 +1,53 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	natsclient "github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// ErrConnectCheckFailed is returned by a reload when the canary user cannot connect afterwards
+var ErrConnectCheckFailed = errors.New("post-reload connect check failed")
+
+// ConnectCheck is a user that must be able to connect to NATS after every reload
+type ConnectCheck struct {
+	URL      string
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// SetConnectCheck enables connecting to NATS as a canary user after each reload.
+// A failed connection makes the reload return ErrConnectCheckFailed.
+func (r *Reloader) SetConnectCheck(check ConnectCheck) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.connectCheck = &check
+}
+
+// checkConnect connects and flushes as the canary user to confirm it authenticates
+func (r *Reloader) checkConnect() error {
+	check := r.connectCheck
+	conn, err := natsclient.Connect(check.URL,
+		natsclient.Name("nats-pocketbase-sync connect check"),
+		natsclient.UserInfo(check.Username, check.Password),
+		natsclient.Timeout(check.Timeout),
+		natsclient.NoReconnect())
+	if err != nil {
+		return fmt.Errorf("%w: user %q: %v", ErrConnectCheckFailed, check.Username, err)
+	}
+	defer conn.Close()
+
+	// A round trip confirms the server accepted the connection
+	if err := conn.FlushTimeout(check.Timeout); err != nil {
+		return fmt.Errorf("%w: user %q: %v", ErrConnectCheckFailed, check.Username, err)
+	}
+
+	r.logger.Info("Connect check succeeded",
+		zap.String("url", check.URL),
+		zap.String("username", check.Username))
+	return nil
+}
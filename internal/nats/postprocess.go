@@ -0,0 +1,60 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PostProcessor pipes the generated config through an external command, such as a
+// formatter or policy checker. The command's stdout becomes the config that is written.
+type PostProcessor struct {
+	command string
+	timeout time.Duration
+	logger  *zap.Logger
+}
+
+// NewPostProcessor creates a PostProcessor running command, killed after timeout
+func NewPostProcessor(command string, timeout time.Duration, logger *zap.Logger) *PostProcessor {
+	return &PostProcessor{command: command, timeout: timeout, logger: logger}
+}
+
+// Process runs the command with content on stdin and returns its stdout. A non-zero
+// exit status or empty output is an error, so nothing is written. Stderr is logged,
+// or included in the error when the command fails.
+func (p *PostProcessor) Process(content string) (string, error) {
+	parts := strings.Fields(p.command)
+	if len(parts) == 0 {
+		return "", fmt.Errorf("empty post-generate command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	message := strings.TrimSpace(stderr.String())
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("post-generate command timed out after %s, stderr: %s", p.timeout, message)
+	}
+	if err != nil {
+		return "", fmt.Errorf("post-generate command failed: %w, stderr: %s", err, message)
+	}
+	if message != "" {
+		p.logger.Info("Post-generate command output", zap.String("stderr", message))
+	}
+	if strings.TrimSpace(stdout.String()) == "" {
+		return "", fmt.Errorf("post-generate command produced no output")
+	}
+	return stdout.String(), nil
+}
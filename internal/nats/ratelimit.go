@@ -0,0 +1,81 @@
+package nats
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tokenBucket limits how many reloads run per hour while allowing short bursts
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	rate     float64 // Tokens added per second
+	last     time.Time
+}
+
+// newTokenBucket creates a full bucket allowing perHour reloads per hour
+func newTokenBucket(perHour int) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(perHour),
+		tokens:   float64(perHour),
+		rate:     float64(perHour) / time.Hour.Seconds(),
+		last:     time.Now(),
+	}
+}
+
+// take consumes a token if one is available, otherwise it returns how long until one is
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// SetMaxReloadsPerHour limits reloads with a token bucket holding up to max reloads,
+// refilled evenly over an hour. Reloads beyond the limit are deferred until a token is
+// available. Zero disables the limit.
+func (r *Reloader) SetMaxReloadsPerHour(max int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if max <= 0 {
+		r.bucket = nil
+		return
+	}
+	r.bucket = newTokenBucket(max)
+}
+
+// ThrottledReloads returns how many reload requests were deferred by the hourly limit
+func (r *Reloader) ThrottledReloads() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.throttled
+}
+
+// throttle reports whether the hourly limit is exhausted, deferring the reload if so.
+// The caller must hold the mutex.
+func (r *Reloader) throttle() bool {
+	if r.bucket == nil {
+		return false
+	}
+
+	ok, wait := r.bucket.take(time.Now())
+	if ok {
+		return false
+	}
+
+	r.throttled++
+	r.logger.Warn("Reload limit reached, deferring reload",
+		zap.Float64("max_per_hour", r.bucket.capacity),
+		zap.Duration("wait", wait),
+		zap.Uint64("throttled_total", r.throttled))
+	r.deferReload(wait, "hourly reload limit")
+	return true
+}
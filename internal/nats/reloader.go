@@ -17,14 +17,32 @@ type Reloader struct {
 	lastReload    time.Time
 	mutex         sync.Mutex
 	minInterval   time.Duration // Minimum time between reloads
+	ssh           *SSHConfig    // Remote host to run the reload command on, if set
+	skipMode      string        // What to do with a reload requested within minInterval
+	pending       *time.Timer   // Deferred reload waiting for minInterval or the hourly limit
+	owed          bool          // A requested reload was deferred or dropped and has not run since
+	monitorURL    string        // NATS monitoring endpoint used to verify reloads, if set
+	verifyTimeout time.Duration // How long to wait for a reload to show up in /varz
+	bucket        *tokenBucket  // Hourly reload limit, if set
+	throttled     uint64        // Reloads deferred by the hourly limit
+	connectCheck  *ConnectCheck // Canary user that must connect after each reload, if set
+	windows       []ReloadWindow // Periods during which reloads may run, any time when empty
+	windowLocation *time.Location // Time zone the reload windows are evaluated in
 }
 
+// Skip modes for reloads requested within the minimum interval
+const (
+	SkipModeDrop  = "drop"  // Skip the reload; the next change triggers one
+	SkipModeDefer = "defer" // Run the reload once the minimum interval has elapsed
+)
+
 // NewReloader creates a new NATS Reloader
 func NewReloader(reloadCommand string, logger *zap.Logger) *Reloader {
 	return &Reloader{
 		reloadCommand: reloadCommand,
 		logger:        logger,
 		minInterval:   5 * time.Second, // Default minimum interval between reloads
+		skipMode:      SkipModeDrop,
 	}
 }
 
@@ -33,17 +51,128 @@ func (r *Reloader) ReloadConfig() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	return r.tryReload()
+}
+
+// tryReload reloads unless the reload windows, the minimum interval or the hourly
+// limit say otherwise. The caller must hold the mutex.
+func (r *Reloader) tryReload() error {
+	// Change management: outside the reload windows the config waits on disk
+	if r.outsideWindow() {
+		r.owed = true
+		return nil
+	}
+
 	// Check if we've reloaded recently
-	if time.Since(r.lastReload) < r.minInterval {
+	if wait := r.minInterval - time.Since(r.lastReload); wait > 0 {
+		r.owed = true
+		if r.skipMode == SkipModeDefer {
+			r.deferReload(wait, "minimum interval")
+			return nil
+		}
 		r.logger.Debug("Skipping reload, too soon since last reload")
 		return nil
 	}
 
+	// Protect NATS from reload storms; the config on disk stays current
+	if r.throttle() {
+		r.owed = true
+		return nil
+	}
+
+	return r.reload()
+}
+
+// reload runs the reload command. The caller must hold the mutex.
+func (r *Reloader) reload() error {
+	// A reload now also covers any deferred one
+	if r.pending != nil {
+		r.pending.Stop()
+		r.pending = nil
+	}
+
+	// Record the current load time so the reload can be confirmed afterwards
+	var previousLoad time.Time
+	if r.monitorURL != "" {
+		var err error
+		previousLoad, err = r.configLoadTime()
+		if err != nil {
+			r.logger.Warn("Failed to read config load time before reload", zap.Error(err))
+		}
+	}
+
+	output, err := r.runCommand()
+	if err != nil {
+		return fmt.Errorf("reload command failed: %w, output: %s", err, output)
+	}
+
+	// Update last reload time
+	r.lastReload = time.Now()
+	r.owed = false
+
+	r.logger.Info("Successfully reloaded NATS configuration", zap.String("output", output))
+
+	if r.monitorURL != "" {
+		if err := r.waitForReload(previousLoad); err != nil {
+			return err
+		}
+	}
+	if r.connectCheck != nil {
+		return r.checkConnect()
+	}
+	return nil
+}
+
+// ReloadNow reloads immediately, ignoring the minimum interval and the hourly limit,
+// e.g. after rolling back a config that failed its checks
+func (r *Reloader) ReloadNow() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.reload()
+}
+
+// deferReload schedules a reload once wait has elapsed.
+// The caller must hold the mutex.
+func (r *Reloader) deferReload(wait time.Duration, reason string) {
+	if r.pending != nil {
+		r.logger.Debug("Reload already deferred")
+		return
+	}
+
+	r.logger.Info("Deferring reload", zap.String("reason", reason), zap.Duration("wait", wait))
+	var timer *time.Timer
+	timer = time.AfterFunc(wait, func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		// The reload was superseded or cancelled
+		if r.pending != timer {
+			return
+		}
+		r.pending = nil
+
+		if err := r.tryReload(); err != nil {
+			r.logger.Error("Deferred reload failed", zap.Error(err))
+		}
+	})
+	r.pending = timer
+}
+
+// runCommand executes the reload command locally or on the configured SSH host
+func (r *Reloader) runCommand() (string, error) {
+	if strings.TrimSpace(r.reloadCommand) == "" {
+		return "", fmt.Errorf("empty reload command")
+	}
+
+	if r.ssh != nil {
+		r.logger.Debug("Running reload command over SSH",
+			zap.String("host", r.ssh.Host),
+			zap.String("user", r.ssh.User))
+		return runRemoteCommand(*r.ssh, r.reloadCommand)
+	}
+
 	// Split command and arguments
 	parts := strings.Fields(r.reloadCommand)
-	if len(parts) == 0 {
-		return fmt.Errorf("empty reload command")
-	}
 
 	// Extract command and arguments
 	cmdName := parts[0]
@@ -57,15 +186,7 @@ func (r *Reloader) ReloadConfig() error {
 
 	// Capture output
 	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("reload command failed: %w, output: %s", err, string(output))
-	}
-
-	// Update last reload time
-	r.lastReload = time.Now()
-
-	r.logger.Info("Successfully reloaded NATS configuration", zap.String("output", string(output)))
-	return nil
+	return string(output), err
 }
 
 // SetMinimumInterval sets the minimum interval between reloads
@@ -74,3 +195,35 @@ func (r *Reloader) SetMinimumInterval(interval time.Duration) {
 	defer r.mutex.Unlock()
 	r.minInterval = interval
 }
+
+// Pending reports whether a requested reload was deferred or dropped and has not run
+// since, so the config on disk is not the one NATS is running
+func (r *Reloader) Pending() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.owed
+}
+
+// SetSkipMode sets whether a reload requested within the minimum interval is dropped or deferred
+func (r *Reloader) SetSkipMode(mode string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.skipMode = mode
+}
+
+// Stop cancels any deferred reload
+func (r *Reloader) Stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.pending != nil {
+		r.pending.Stop()
+		r.pending = nil
+	}
+}
+
+// SetSSHTarget configures the reload command to run on a remote host over SSH
+func (r *Reloader) SetSSHTarget(cfg SSHConfig) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.ssh = &cfg
+}
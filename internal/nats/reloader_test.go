@@ -0,0 +1,52 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestPendingAfterHeldBackReload(t *testing.T) {
+	t.Run("minimum interval", func(t *testing.T) {
+		r := NewReloader("true", zap.NewNop())
+		r.SetMinimumInterval(time.Hour)
+
+		if err := r.ReloadConfig(); err != nil {
+			t.Fatalf("first reload: %v", err)
+		}
+		if r.Pending() {
+			t.Fatal("Pending after a reload that ran")
+		}
+
+		if err := r.ReloadConfig(); err != nil {
+			t.Fatalf("second reload: %v", err)
+		}
+		if !r.Pending() {
+			t.Fatal("not Pending after a reload dropped within the minimum interval")
+		}
+
+		if err := r.ReloadNow(); err != nil {
+			t.Fatalf("ReloadNow: %v", err)
+		}
+		if r.Pending() {
+			t.Error("still Pending after ReloadNow")
+		}
+	})
+
+	t.Run("outside reload windows", func(t *testing.T) {
+		r := NewReloader("true", zap.NewNop())
+		defer r.Stop()
+
+		// A window that only opens on a day other than today
+		other := (time.Now().Weekday() + 3) % 7
+		r.SetReloadWindows([]ReloadWindow{{Days: []time.Weekday{other}, Start: 0, End: time.Hour}}, time.Local)
+
+		if err := r.ReloadConfig(); err != nil {
+			t.Fatalf("ReloadConfig: %v", err)
+		}
+		if !r.Pending() {
+			t.Error("not Pending after a reload deferred to the next window")
+		}
+	})
+}
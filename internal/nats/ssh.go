@@ -0,0 +1,107 @@
+package nats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConfig contains the settings for running the reload command on a remote host
+type SSHConfig struct {
+	Host                  string
+	Port                  int
+	User                  string
+	KeyPath               string
+	KnownHostsFile        string
+	InsecureIgnoreHostKey bool
+	Timeout               time.Duration
+}
+
+// clientConfig builds the SSH client configuration from the settings
+func (c SSHConfig) clientConfig() (*ssh.ClientConfig, error) {
+	key, err := os.ReadFile(c.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key: %w", err)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case c.KnownHostsFile != "":
+		hostKeyCallback, err = knownhosts.New(c.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known hosts file: %w", err)
+		}
+	case c.InsecureIgnoreHostKey:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("SSH known hosts file is required unless host key checking is disabled")
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	}, nil
+}
+
+// address returns the host:port to dial
+func (c SSHConfig) address() string {
+	port := c.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// runRemoteCommand runs a command on the remote host and returns its combined output
+func runRemoteCommand(cfg SSHConfig, command string) (string, error) {
+	clientConfig, err := cfg.clientConfig()
+	if err != nil {
+		return "", err
+	}
+
+	client, err := ssh.Dial("tcp", cfg.address(), clientConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to %s: %w", cfg.address(), err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	// Capture stdout and stderr together like the local command
+	var output bytes.Buffer
+	session.Stdout = &output
+	session.Stderr = &output
+
+	if err := session.Run(command); err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return output.String(), fmt.Errorf("remote command exited with status %d", exitErr.ExitStatus())
+		}
+		return output.String(), fmt.Errorf("remote command failed: %w", err)
+	}
+
+	return output.String(), nil
+}
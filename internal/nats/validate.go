@@ -0,0 +1,60 @@
+package nats
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ConfigPlaceholder is replaced with the path of the config under test in the validate command
+const ConfigPlaceholder = "{config}"
+
+// Validator checks a generated config with an external command such as nats-server -t
+type Validator struct {
+	command string
+	dir     string
+}
+
+// NewValidator creates a Validator running command, which must contain ConfigPlaceholder.
+// Candidate configs are written to dir, normally the directory of the config file,
+// so relative includes resolve as they would for the real file.
+func NewValidator(command, dir string) *Validator {
+	return &Validator{command: command, dir: dir}
+}
+
+// Validate writes content to a temporary file and runs the validate command on it
+func (v *Validator) Validate(content string) error {
+	file, err := os.CreateTemp(v.dir, ".nats-validate-*.conf")
+	if err != nil {
+		return fmt.Errorf("failed to create validation file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write validation file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close validation file: %w", err)
+	}
+
+	return v.ValidateFile(file.Name())
+}
+
+// ValidateFile runs the validate command on a config file that is already on disk
+func (v *Validator) ValidateFile(path string) error {
+	parts := strings.Fields(v.command)
+	if len(parts) == 0 {
+		return fmt.Errorf("empty validate command")
+	}
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(part, ConfigPlaceholder, path)
+	}
+
+	output, err := exec.Command(parts[0], parts[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("config failed validation: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Backoff bounds between /varz polls while waiting for a reload to take effect
+const (
+	verifyInitialBackoff = 100 * time.Millisecond
+	verifyMaxBackoff     = time.Second
+)
+
+// varz is the subset of the NATS /varz monitoring response used for verification
+type varz struct {
+	ConfigLoadTime time.Time `json:"config_load_time"`
+	Tags           []string  `json:"tags"`
+}
+
+// SetVerification enables confirming each reload through the NATS monitoring endpoint.
+// After the reload command runs, /varz is polled until config_load_time advances or the timeout elapses.
+func (r *Reloader) SetVerification(monitorURL string, timeout time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.monitorURL = strings.TrimRight(monitorURL, "/")
+	r.verifyTimeout = timeout
+}
+
+// fetchVarz fetches the server's /varz monitoring response
+func (r *Reloader) fetchVarz() (varz, error) {
+	var v varz
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(r.monitorURL + "/varz")
+	if err != nil {
+		return v, fmt.Errorf("failed to query varz: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return v, fmt.Errorf("varz request failed with status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return v, fmt.Errorf("failed to decode varz response: %w", err)
+	}
+	return v, nil
+}
+
+// configLoadTime fetches the server's current config_load_time from /varz
+func (r *Reloader) configLoadTime() (time.Time, error) {
+	v, err := r.fetchVarz()
+	return v.ConfigLoadTime, err
+}
+
+// waitForReload polls /varz with backoff until config_load_time is after previous
+func (r *Reloader) waitForReload(previous time.Time) error {
+	deadline := time.Now().Add(r.verifyTimeout)
+	backoff := verifyInitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		loadTime, err := r.configLoadTime()
+		r.logger.Debug("Polled NATS config load time",
+			zap.Int("attempt", attempt),
+			zap.Time("config_load_time", loadTime),
+			zap.Error(err))
+
+		if err == nil && loadTime.After(previous) {
+			r.logger.Info("Verified NATS reload",
+				zap.Int("attempts", attempt),
+				zap.Time("config_load_time", loadTime))
+			return nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			r.logger.Info("NATS reload not verified before timeout",
+				zap.Int("attempts", attempt),
+				zap.Duration("timeout", r.verifyTimeout))
+			if err != nil {
+				return fmt.Errorf("reload not verified within %s: %w", r.verifyTimeout, err)
+			}
+			return fmt.Errorf("reload not verified within %s: config_load_time did not advance", r.verifyTimeout)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > verifyMaxBackoff {
+			backoff = verifyMaxBackoff
+		}
+	}
+}
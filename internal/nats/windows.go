@@ -0,0 +1,93 @@
+package nats
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ReloadWindow is a recurring period during which NATS may be reloaded.
+// A window whose end is not after its start runs past midnight into the next day.
+type ReloadWindow struct {
+	Days  []time.Weekday // Days the window opens on, every day when empty
+	Start time.Duration  // Opening time as an offset from midnight
+	End   time.Duration  // Closing time as an offset from midnight
+}
+
+// opensOn reports whether the window opens on the given weekday
+func (w ReloadWindow) opensOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether t falls inside the window
+func (w ReloadWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	if w.Start < w.End {
+		return w.opensOn(t.Weekday()) && offset >= w.Start && offset < w.End
+	}
+	// Overnight: the evening part belongs to today, the early part to yesterday's window
+	if offset >= w.Start {
+		return w.opensOn(t.Weekday())
+	}
+	return offset < w.End && w.opensOn(midnight.AddDate(0, 0, -1).Weekday())
+}
+
+// nextOpen returns the first time after t at which the window opens
+func (w ReloadWindow) nextOpen(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for day := 0; day <= 7; day++ {
+		date := midnight.AddDate(0, 0, day)
+		open := date.Add(w.Start)
+		if open.After(t) && w.opensOn(date.Weekday()) {
+			return open
+		}
+	}
+	return time.Time{}
+}
+
+// SetReloadWindows restricts reloads to the given windows, evaluated in loc. Outside
+// them a reload is deferred until the next window opens. No windows means any time.
+func (r *Reloader) SetReloadWindows(windows []ReloadWindow, loc *time.Location) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.windows = windows
+	r.windowLocation = loc
+}
+
+// outsideWindow reports whether reloads are currently blocked by the reload windows,
+// deferring the reload to the next window if so. The caller must hold the mutex.
+func (r *Reloader) outsideWindow() bool {
+	if len(r.windows) == 0 {
+		return false
+	}
+
+	now := time.Now().In(r.windowLocation)
+	var next time.Time
+	for _, window := range r.windows {
+		if window.contains(now) {
+			return false
+		}
+		if open := window.nextOpen(now); !open.IsZero() && (next.IsZero() || open.Before(next)) {
+			next = open
+		}
+	}
+	if next.IsZero() {
+		r.logger.Warn("Reload outside reload windows and no window opens within a week, not reloading")
+		return true
+	}
+
+	r.logger.Info("Outside reload windows, deferring reload",
+		zap.Time("next_window", next))
+	r.deferReload(next.Sub(now), "outside reload window")
+	return true
+}
@@ -0,0 +1,84 @@
+package pocketbase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// ErrForbidden is returned when the authenticated identity may not list a collection
+var ErrForbidden = errors.New("permission denied")
+
+// forbiddenError explains a 403 on a collection. PocketBase returns 403 when the list
+// API rule denies the identity, while a rule that matches no records returns 200 with
+// no items, so the two cases must not be confused.
+func forbiddenError(collection string) error {
+	return fmt.Errorf("collection %s: %w: the authenticated identity may not list records, "+
+		"check the collection's List API rule or authenticate as a superuser", collection, ErrForbidden)
+}
+
+// CheckAccess verifies that the users and roles collections can be listed, telling a
+// permission problem apart from a collection that is genuinely empty. It returns an
+// error for a 403 or a missing collection and logs a warning for empty collections.
+func (c *Client) CheckAccess(ctx context.Context) error {
+	if c.authToken == "" {
+		return fmt.Errorf("not authenticated")
+	}
+
+	for _, collection := range []string{c.collections.users, c.collections.roles} {
+		total, err := c.countRecords(ctx, collection)
+		if err != nil {
+			return err
+		}
+		if total == 0 {
+			c.logger.Warn("Collection is readable but contains no records",
+				zap.String("collection", collection))
+			continue
+		}
+		c.logger.Info("Collection access verified",
+			zap.String("collection", collection),
+			zap.Int("records", total))
+	}
+	return nil
+}
+
+// countRecords fetches a single record of a collection and returns its total item count
+func (c *Client) countRecords(ctx context.Context, collection string) (int, error) {
+	endpoint := fmt.Sprintf("%s/api/collections/%s/records?page=1&perPage=1", c.readBaseURL(), collection)
+	resp, err := c.doAuthorized(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create access check request: %w", err)
+		}
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to send access check request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return 0, forbiddenError(collection)
+	case http.StatusNotFound:
+		return 0, fmt.Errorf("collection %s does not exist", collection)
+	default:
+		return 0, fmt.Errorf("collection %s: access check failed with status %d: %s", collection, resp.StatusCode, string(body))
+	}
+
+	var listResp struct {
+		TotalItems int `json:"totalItems"`
+	}
+	if err := json.Unmarshal(body, &listResp); err != nil {
+		return 0, fmt.Errorf("collection %s: failed to decode access check response: %w", collection, err)
+	}
+	return listResp.TotalItems, nil
+}
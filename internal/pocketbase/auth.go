@@ -0,0 +1,59 @@
+package pocketbase
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Backoff bounds between authentication attempts
+const (
+	authInitialBackoff = 500 * time.Millisecond
+	authMaxBackoff     = 10 * time.Second
+)
+
+// ErrCredentialsRejected is returned when PocketBase answers an authentication
+// request with a client error, which retrying cannot fix
+var ErrCredentialsRejected = errors.New("credentials rejected")
+
+// AuthenticateWithRetry authenticates, retrying with jittered exponential backoff
+// until it succeeds, the credentials are rejected, ctx is cancelled or timeout has
+// elapsed. It lets the service wait for a PocketBase that is still starting.
+func (c *Client) AuthenticateWithRetry(ctx context.Context, email, password string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := authInitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := c.Authenticate(ctx, email, password)
+		if err == nil || errors.Is(err, ErrCredentialsRejected) || ctx.Err() != nil {
+			return err
+		}
+
+		// Sleep between half and all of the backoff, so instances restarted together spread out
+		wait := backoff/2 + rand.N(backoff/2+1)
+		if time.Now().Add(wait).After(deadline) {
+			c.logger.Error("Giving up authenticating with PocketBase",
+				zap.Int("attempts", attempt),
+				zap.Duration("auth_retry_timeout", timeout),
+				zap.Error(err))
+			return err
+		}
+		c.logger.Warn("Failed to authenticate with PocketBase, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", wait),
+			zap.Error(err))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+		if backoff > authMaxBackoff {
+			backoff = authMaxBackoff
+		}
+	}
+}
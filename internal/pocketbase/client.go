@@ -2,7 +2,9 @@ package pocketbase
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -19,26 +21,50 @@ func min(x, y int) int {
 	return int(math.Min(float64(x), float64(y)))
 }
 
+// PasswordFunc returns the password to authenticate with. It is called on every
+// (re-)authentication so rotated credentials are picked up without a restart.
+type PasswordFunc func() (string, error)
+
 // Client is a PocketBase API client
 type Client struct {
 	baseURL     string
+	readURL     string // Optional read replica for record fetches
 	httpClient  *http.Client
+	transport   *http.Transport
 	authToken   string
+	identity    string
+	password    PasswordFunc
 	logger      *zap.Logger
+	maxUsers    int    // Cap on fetched users, 0 for unlimited
+	maxRoles    int    // Cap on fetched roles, 0 for unlimited
+	limitAction string // What to do when a cap is exceeded
+	pageSize    int    // Records requested per page
+	authCollection string // Auth collection credentials are checked against
 	collections struct {
 		users string
 		roles string
 	}
 }
 
+// DefaultAuthCollection is the collection authenticated against unless configured otherwise
+const DefaultAuthCollection = "_superusers"
+
+// DefaultTimeout bounds each PocketBase request unless configured otherwise
+const DefaultTimeout = 10 * time.Second
+
 // NewClient creates a new PocketBase client
 func NewClient(baseURL, userCollection, roleCollection string, logger *zap.Logger) *Client {
+	transport := newTransport()
 	return &Client{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   DefaultTimeout,
+			Transport: transport,
 		},
-		logger: logger,
+		transport: transport,
+		logger:    logger,
+		pageSize:  DefaultPageSize,
+		authCollection: DefaultAuthCollection,
 		collections: struct {
 			users string
 			roles string
@@ -49,8 +75,47 @@ func NewClient(baseURL, userCollection, roleCollection string, logger *zap.Logge
 	}
 }
 
+// SetTimeout sets how long a single request may take, including reading the response
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.httpClient.Timeout = timeout
+}
+
+// SetAuthCollection sets the auth collection to authenticate against, e.g. a collection
+// holding a read-only service account. An empty name keeps _superusers.
+func (c *Client) SetAuthCollection(collection string) {
+	if collection == "" {
+		collection = DefaultAuthCollection
+	}
+	c.authCollection = collection
+}
+
+// SetReadURL sets a read replica that user, role and record fetches are sent to.
+// Authentication and schema checks keep using the primary URL.
+func (c *Client) SetReadURL(readURL string) {
+	c.readURL = readURL
+}
+
+// readBaseURL returns the URL record fetches are sent to
+func (c *Client) readBaseURL() string {
+	if c.readURL != "" {
+		return c.readURL
+	}
+	return c.baseURL
+}
+
+// SetCredentials sets the identity and password source used when re-authenticating
+func (c *Client) SetCredentials(identity string, password PasswordFunc) {
+	c.identity = identity
+	c.password = password
+}
+
 // Authenticate authenticates with PocketBase using credentials
-func (c *Client) Authenticate(email, password string) error {
+func (c *Client) Authenticate(ctx context.Context, email, password string) error {
+	// Remember static credentials so the client can re-authenticate later
+	if c.password == nil {
+		c.SetCredentials(email, func() (string, error) { return password, nil })
+	}
+
 	data := map[string]string{
 		"identity":    email,    // PocketBase uses "identity" for username/email
 		"password": password,
@@ -62,10 +127,10 @@ func (c *Client) Authenticate(email, password string) error {
 	}
 
 	// Use the correct authentication endpoint for collections
-	authEndpoint := fmt.Sprintf("%s/api/collections/_superusers/auth-with-password", c.baseURL)
+	authEndpoint := fmt.Sprintf("%s/api/collections/%s/auth-with-password", c.baseURL, c.authCollection)
 	c.logger.Debug("Authenticating with PocketBase", zap.String("endpoint", authEndpoint))
 
-	req, err := http.NewRequest("POST", authEndpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", authEndpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create auth request: %w", err)
 	}
@@ -79,6 +144,9 @@ func (c *Client) Authenticate(email, password string) error {
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return fmt.Errorf("authentication failed with status %d: %w: %s", resp.StatusCode, ErrCredentialsRejected, string(body))
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("authentication failed with status %d: %s", resp.StatusCode, string(body))
 	}
@@ -93,126 +161,199 @@ func (c *Client) Authenticate(email, password string) error {
 	return nil
 }
 
-// GetAllMqttUsers retrieves all MQTT users from PocketBase
-func (c *Client) GetAllMqttUsers() ([]models.MqttUser, error) {
-	if c.authToken == "" {
-		return nil, fmt.Errorf("not authenticated")
+// reauthenticate obtains a fresh auth token using the current credentials
+func (c *Client) reauthenticate(ctx context.Context) error {
+	if c.password == nil {
+		return fmt.Errorf("no credentials available for re-authentication")
 	}
 
-	// Construct URL with filters for active users
-	endpoint := fmt.Sprintf("%s/api/collections/%s/records", c.baseURL, c.collections.users)
-	reqURL, err := url.Parse(endpoint)
+	password, err := c.password()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse URL: %w", err)
+		if password == "" {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		c.logger.Warn("Failed to re-read password, using cached value", zap.Error(err))
 	}
 
-	query := reqURL.Query()
-	query.Set("filter", "active=true")
-	query.Set("perPage", "100") // Adjust based on expected user count
-	reqURL.RawQuery = query.Encode()
+	return c.Authenticate(ctx, c.identity, password)
+}
 
-	c.logger.Debug("Fetching MQTT users", 
-		zap.String("url", reqURL.String()),
-		zap.String("auth_token_prefix", c.authToken[:10]+"...")) // Log only prefix for security
+// doAuthorized sends an authorized request, re-authenticating once if the token was rejected.
+// Responses are requested gzip-compressed and decompressed before being returned.
+// newRequest should build requests with ctx so they are cancelled along with it.
+func (c *Client) doAuthorized(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	requestGzip(req)
 
-	req, err := http.NewRequest("GET", reqURL.String(), nil)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create users request: %w", err)
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		if err := c.decompressResponse(resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
 	}
+	resp.Body.Close()
 
-	// Create a consistent output format
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
+	c.logger.Info("PocketBase rejected auth token, re-authenticating")
+	if err := c.reauthenticate(ctx); err != nil {
+		return nil, fmt.Errorf("re-authentication failed: %w", err)
+	}
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	requestGzip(req)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err = c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send users request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	if err := c.decompressResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("users request failed with status %d: %s", resp.StatusCode, string(body))
+// GetAllMqttUsers retrieves all MQTT users from PocketBase
+func (c *Client) GetAllMqttUsers(ctx context.Context) ([]models.MqttUser, error) {
+	if c.authToken == "" {
+		return nil, fmt.Errorf("not authenticated")
 	}
 
-	var usersResp models.PocketBaseListResponse[models.MqttUser]
-	if err := json.Unmarshal(body, &usersResp); err != nil {
-		return nil, fmt.Errorf("failed to decode users response: %w", err)
+	c.logger.Debug("Fetching MQTT users",
+		zap.String("collection", c.collections.users),
+		zap.String("auth_token_prefix", c.authToken[:10]+"...")) // Log only prefix for security
+
+	// Only active users are fetched
+	users, err := fetchAllRecords[models.MqttUser](ctx, c, "users", c.collections.users, "active=true", c.maxUsers)
+	if err != nil {
+		return nil, err
 	}
 
-	c.logger.Info("Retrieved MQTT users from PocketBase", zap.Int("count", len(usersResp.Items)))
-	return usersResp.Items, nil
+	c.logger.Info("Retrieved MQTT users from PocketBase", zap.Int("count", len(users)))
+	return users, nil
 }
 
 // GetAllMqttRoles retrieves all MQTT roles from PocketBase
-func (c *Client) GetAllMqttRoles() ([]models.MqttRole, error) {
+func (c *Client) GetAllMqttRoles(ctx context.Context) ([]models.MqttRole, error) {
 	if c.authToken == "" {
 		return nil, fmt.Errorf("not authenticated")
 	}
 
-	endpoint := fmt.Sprintf("%s/api/collections/%s/records", c.baseURL, c.collections.roles)
-	c.logger.Debug("Fetching MQTT roles", zap.String("url", endpoint))
-	
-	req, err := http.NewRequest("GET", endpoint, nil)
+	c.logger.Debug("Fetching MQTT roles", zap.String("collection", c.collections.roles))
+
+	roles, err := fetchAllRecords[models.MqttRole](ctx, c, "roles", c.collections.roles, "", c.maxRoles)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create roles request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	c.logger.Info("Retrieved MQTT roles from PocketBase", zap.Int("count", len(roles)))
+	return roles, nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// GetRoleByID retrieves a specific role by ID
+func (c *Client) GetRoleByID(ctx context.Context, roleID string) (*models.MqttRole, error) {
+	if c.authToken == "" {
+		return nil, fmt.Errorf("not authenticated")
+	}
+
+	endpoint := fmt.Sprintf("%s/api/collections/%s/records/%s", c.readBaseURL(), c.collections.roles, roleID)
+	resp, err := c.doAuthorized(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create role request: %w", err)
+		}
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send roles request: %w", err)
+		return nil, fmt.Errorf("failed to send role request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("roles request failed with status %d: %s", resp.StatusCode, string(body))
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("role request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var rolesResp models.PocketBaseListResponse[models.MqttRole]
-	if err := json.Unmarshal(body, &rolesResp); err != nil {
-		c.logger.Error("Failed to decode roles response", 
-			zap.Error(err), 
-			zap.String("response", string(body[:min(len(body), 1000)]))) // Log first 1000 chars
-		return nil, fmt.Errorf("failed to decode roles response: %w", err)
+	var roleResp models.PocketBaseResponse[models.MqttRole]
+	if err := json.NewDecoder(resp.Body).Decode(&roleResp); err != nil {
+		return nil, fmt.Errorf("failed to decode role response: %w", err)
 	}
 
-	c.logger.Info("Retrieved MQTT roles from PocketBase", zap.Int("count", len(rolesResp.Items)))
-	return rolesResp.Items, nil
+	return &roleResp.Item, nil
 }
 
-// GetRoleByID retrieves a specific role by ID
-func (c *Client) GetRoleByID(roleID string) (*models.MqttRole, error) {
+// ErrRecordNotFound is returned when a requested record does not exist
+var ErrRecordNotFound = errors.New("record not found")
+
+// RecordRef identifies a single field of a single PocketBase record
+type RecordRef struct {
+	Collection string
+	ID         string
+	Field      string
+}
+
+// GetRecordField retrieves a single field of a record as a string
+func (c *Client) GetRecordField(ctx context.Context, ref RecordRef) (string, error) {
 	if c.authToken == "" {
-		return nil, fmt.Errorf("not authenticated")
+		return "", fmt.Errorf("not authenticated")
 	}
 
-	endpoint := fmt.Sprintf("%s/api/collections/%s/records/%s", c.baseURL, c.collections.roles, roleID)
-	req, err := http.NewRequest("GET", endpoint, nil)
+	endpoint := fmt.Sprintf("%s/api/collections/%s/records/%s", c.readBaseURL(), ref.Collection, ref.ID)
+	reqURL, err := url.Parse(endpoint)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create role request: %w", err)
+		return "", fmt.Errorf("failed to parse URL: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.authToken)
+	// Only fetch the field we need
+	query := reqURL.Query()
+	query.Set("fields", ref.Field)
+	reqURL.RawQuery = query.Encode()
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doAuthorized(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", reqURL.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create record request: %w", err)
+		}
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send role request: %w", err)
+		return "", fmt.Errorf("failed to send record request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrRecordNotFound
+	}
+
+	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("role request failed with status %d: %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("record request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var roleResp models.PocketBaseResponse[models.MqttRole]
-	if err := json.NewDecoder(resp.Body).Decode(&roleResp); err != nil {
-		return nil, fmt.Errorf("failed to decode role response: %w", err)
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(body, &record); err != nil {
+		return "", fmt.Errorf("failed to decode record response: %w", err)
 	}
 
-	return &roleResp.Item, nil
+	value, ok := record[ref.Field]
+	if !ok {
+		return "", fmt.Errorf("record has no field %q", ref.Field)
+	}
+
+	// Compare string values without their JSON quoting
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		return str, nil
+	}
+	return string(value), nil
 }
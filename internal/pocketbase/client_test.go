@@ -0,0 +1,92 @@
+package pocketbase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestSetTimeoutAbortsSlowRequests(t *testing.T) {
+	// The handler answers only after the test is done, long after the client gave up
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(models.PocketBaseAuthResponse{Token: testToken})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(server.URL, "mqtt_users", "mqtt_roles", zap.NewNop())
+	client.SetTimeout(50 * time.Millisecond)
+	if client.httpClient.Timeout != 50*time.Millisecond {
+		t.Fatalf("client timeout = %s, want 50ms", client.httpClient.Timeout)
+	}
+
+	start := time.Now()
+	err := client.Authenticate(context.Background(), "admin@example.com", "secret")
+	if err == nil {
+		t.Fatal("Authenticate succeeded, want a timeout error")
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Authenticate error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request took %s, want it cut off by the 50ms timeout", elapsed)
+	}
+}
+
+func TestNewClientDefaultTimeout(t *testing.T) {
+	client := NewClient("http://localhost:8090", "mqtt_users", "mqtt_roles", zap.NewNop())
+	if client.httpClient.Timeout != DefaultTimeout {
+		t.Errorf("default timeout = %s, want %s", client.httpClient.Timeout, DefaultTimeout)
+	}
+}
+
+func TestAuthenticateUsesAuthCollection(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		wantPath   string
+	}{
+		{"custom collection", "service_accounts", "/api/collections/service_accounts/auth-with-password"},
+		{"empty falls back to superusers", "", "/api/collections/_superusers/auth-with-password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			var gotBody map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				json.NewDecoder(r.Body).Decode(&gotBody)
+				json.NewEncoder(w).Encode(models.PocketBaseAuthResponse{Token: testToken})
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "mqtt_users", "mqtt_roles", zap.NewNop())
+			client.SetAuthCollection(tt.collection)
+			if err := client.Authenticate(context.Background(), "sync@example.com", "secret"); err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+
+			if gotPath != tt.wantPath {
+				t.Errorf("authenticated against %s, want %s", gotPath, tt.wantPath)
+			}
+			if gotBody["identity"] != "sync@example.com" || gotBody["password"] != "secret" {
+				t.Errorf("auth request body = %v, want the configured credentials", gotBody)
+			}
+			if client.authToken != testToken {
+				t.Errorf("auth token = %q, want %q", client.authToken, testToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package pocketbase
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// gzipBody decompresses a gzip response body and logs the transfer sizes when closed
+type gzipBody struct {
+	body         io.ReadCloser
+	compressed   *countingReader
+	decompressed *countingReader
+	gzipReader   *gzip.Reader
+	url          string
+	logger       *zap.Logger
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	return b.decompressed.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	b.logger.Debug("Received compressed PocketBase response",
+		zap.String("url", b.url),
+		zap.Int64("compressed_bytes", b.compressed.count),
+		zap.Int64("decompressed_bytes", b.decompressed.count))
+	b.gzipReader.Close()
+	return b.body.Close()
+}
+
+// requestGzip asks the server for a gzip-compressed response. Setting the header
+// explicitly disables the transport's transparent decompression, so responses
+// must be passed through decompressResponse.
+func requestGzip(req *http.Request) {
+	req.Header.Set("Accept-Encoding", "gzip")
+}
+
+// decompressResponse replaces a gzip-encoded response body with a decompressing reader
+func (c *Client) decompressResponse(resp *http.Response) error {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return nil
+	}
+
+	compressed := &countingReader{reader: resp.Body}
+	gzipReader, err := gzip.NewReader(compressed)
+	if err != nil {
+		resp.Body.Close()
+		return fmt.Errorf("failed to decompress response: %w", err)
+	}
+
+	resp.Body = &gzipBody{
+		body:         resp.Body,
+		compressed:   compressed,
+		decompressed: &countingReader{reader: gzipReader},
+		gzipReader:   gzipReader,
+		url:          resp.Request.URL.String(),
+		logger:       c.logger,
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
@@ -0,0 +1,126 @@
+package pocketbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// DefaultPageSize is the number of records requested per page unless configured otherwise
+const DefaultPageSize = 100
+
+// Actions taken when a collection returns more records than its cap
+const (
+	LimitActionFail     = "fail"     // Abort the sync with an error
+	LimitActionTruncate = "truncate" // Keep the first records up to the cap and warn
+)
+
+// SetLimits caps how many users and roles are fetched. Zero means unlimited.
+func (c *Client) SetLimits(maxUsers, maxRoles int, action string) {
+	c.maxUsers = maxUsers
+	c.maxRoles = maxRoles
+	c.limitAction = action
+}
+
+// SetPageSize sets the number of records requested per page
+func (c *Client) SetPageSize(size int) {
+	c.pageSize = size
+}
+
+// fetchAllRecords fetches every page of a collection, stopping at limit records when limit is positive
+func fetchAllRecords[T any](ctx context.Context, c *Client, kind, collection, filter string, limit int) ([]T, error) {
+	endpoint := fmt.Sprintf("%s/api/collections/%s/records", c.readBaseURL(), collection)
+	reqURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	var items []T
+	lastPage := 1
+	for page := 1; page <= lastPage; page++ {
+		query := reqURL.Query()
+		if filter != "" {
+			query.Set("filter", filter)
+		}
+		query.Set("page", strconv.Itoa(page))
+		query.Set("perPage", strconv.Itoa(c.pageSize))
+		reqURL.RawQuery = query.Encode()
+		pageURL := reqURL.String()
+
+		resp, err := c.doAuthorized(ctx, func() (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create %s request: %w", kind, err)
+			}
+
+			// Create a consistent output format
+			req.Header.Set("Accept", "application/json")
+			req.Header.Set("Content-Type", "application/json")
+			return req, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to send %s request: %w", kind, err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("%s request failed: %w", kind, forbiddenError(collection))
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s request failed with status %d: %s", kind, resp.StatusCode, string(body))
+		}
+
+		var listResp models.PocketBaseListResponse[T]
+		if err := json.Unmarshal(body, &listResp); err != nil {
+			c.logger.Error("Failed to decode "+kind+" response",
+				zap.Error(err),
+				zap.String("response", string(body[:min(len(body), 1000)]))) // Log first 1000 chars
+			return nil, fmt.Errorf("failed to decode %s response: %w", kind, err)
+		}
+		items = append(items, listResp.Items...)
+
+		// Enforce the safety cap before fetching any further pages
+		if limit > 0 && (len(items) > limit || listResp.TotalItems > limit) {
+			total := max(len(items), listResp.TotalItems)
+			if c.limitAction == LimitActionTruncate {
+				c.logger.Warn("Record cap reached, truncating",
+					zap.String("kind", kind),
+					zap.Int("limit", limit),
+					zap.Int("available", total))
+				if len(items) >= limit {
+					return items[:limit], nil
+				}
+			} else {
+				c.logger.Error("Record cap exceeded",
+					zap.String("kind", kind),
+					zap.Int("limit", limit),
+					zap.Int("available", total))
+				return nil, fmt.Errorf("%s count %d exceeds cap of %d", kind, total, limit)
+			}
+		}
+
+		if len(listResp.Items) == 0 || len(items) >= listResp.TotalItems {
+			return items, nil
+		}
+		lastPage = lastPageOf(listResp.TotalPages, listResp.TotalItems, listResp.PerPage)
+	}
+	return items, nil
+}
+
+// lastPageOf returns the last page to fetch: totalPages, but never more pages than
+// totalItems needs at perPage items per page, so a malformed totalPages cannot keep
+// the fetch going
+func lastPageOf(totalPages, totalItems, perPage int) int {
+	if perPage < 1 {
+		return totalPages
+	}
+	return min(totalPages, (totalItems+perPage-1)/perPage)
+}
@@ -0,0 +1,102 @@
+package pocketbase
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// testToken is the auth token handed out by test servers
+const testToken = "test-token-0123456789"
+
+// newAuthenticatedClient starts a test server that accepts any superuser login and passes
+// every other request to handler, and returns a client authenticated against it
+func newAuthenticatedClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/collections/_superusers/auth-with-password", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.PocketBaseAuthResponse{Token: testToken})
+	})
+	mux.HandleFunc("/", handler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, "mqtt_users", "mqtt_roles", zap.NewNop())
+	if err := client.Authenticate(context.Background(), "admin@example.com", "secret"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	return client
+}
+
+func TestGetAllMqttUsersFetchesEveryPage(t *testing.T) {
+	pages := [][]map[string]interface{}{
+		{{"id": "u1", "username": "alice"}, {"id": "u2", "username": "bob"}},
+		{{"id": "u3", "username": "carol"}, {"id": "u4", "username": "dave"}},
+		{{"id": "u5", "username": "erin"}},
+	}
+
+	var requested []int
+	client := newAuthenticatedClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/collections/mqtt_users/records" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer "+testToken {
+			t.Errorf("Authorization = %q, want the auth token", got)
+		}
+		if got := r.URL.Query().Get("perPage"); got != "2" {
+			t.Errorf("perPage = %q, want 2", got)
+		}
+		if got := r.URL.Query().Get("filter"); got != "active=true" {
+			t.Errorf("filter = %q, want active=true", got)
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		requested = append(requested, page)
+		if page < 1 || page > len(pages) {
+			t.Errorf("requested page %d beyond the last page", page)
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(models.PocketBaseListResponse[map[string]interface{}]{
+			Page:       page,
+			PerPage:    2,
+			TotalItems: 5,
+			TotalPages: len(pages),
+			Items:      pages[page-1],
+		})
+	})
+	client.SetPageSize(2)
+
+	users, err := client.GetAllMqttUsers(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllMqttUsers: %v", err)
+	}
+
+	if len(requested) != 3 || requested[0] != 1 || requested[1] != 2 || requested[2] != 3 {
+		t.Errorf("requested pages %v, want [1 2 3]", requested)
+	}
+	want := []string{"u1", "u2", "u3", "u4", "u5"}
+	if len(users) != len(want) {
+		t.Fatalf("got %d users, want %d", len(users), len(want))
+	}
+	for i, user := range users {
+		if user.ID != want[i] {
+			t.Errorf("user %d = %s, want %s", i, user.ID, want[i])
+		}
+	}
+}
+
+func TestNewClientDefaultPageSize(t *testing.T) {
+	client := NewClient("http://localhost:8090", "mqtt_users", "mqtt_roles", zap.NewNop())
+	if client.pageSize != 100 {
+		t.Errorf("default page size = %d, want 100", client.pageSize)
+	}
+}
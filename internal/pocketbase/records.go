@@ -0,0 +1,79 @@
+package pocketbase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CreateRecord creates a record in collection and returns its ID.
+// Writes always go to the primary URL, never the read replica.
+func (c *Client) CreateRecord(ctx context.Context, collection string, record map[string]interface{}) (string, error) {
+	if c.authToken == "" {
+		return "", fmt.Errorf("not authenticated")
+	}
+
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/api/collections/%s/records", c.baseURL, collection)
+	resp, err := c.doAuthorized(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create record request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send create request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("create request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		return "", fmt.Errorf("failed to decode create response: %w", err)
+	}
+	return created.ID, nil
+}
+
+// DeleteRecord deletes a record from collection. A record that no longer exists is not an error.
+func (c *Client) DeleteRecord(ctx context.Context, collection, id string) error {
+	if c.authToken == "" {
+		return fmt.Errorf("not authenticated")
+	}
+
+	endpoint := fmt.Sprintf("%s/api/collections/%s/records/%s", c.baseURL, collection, id)
+	resp, err := c.doAuthorized(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "DELETE", endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create delete request: %w", err)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send delete request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
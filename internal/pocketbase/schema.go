@@ -0,0 +1,138 @@
+package pocketbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// FieldSpec describes a field the sync expects in a collection and the types it accepts
+type FieldSpec struct {
+	Name  string
+	Types []string
+}
+
+// UserFields are the fields required in the users collection
+var UserFields = []FieldSpec{
+	{Name: "username", Types: []string{"text", "email"}},
+	{Name: "password", Types: []string{"text"}},
+	{Name: "role_id", Types: []string{"relation", "text"}},
+	{Name: "active", Types: []string{"bool"}},
+}
+
+// RoleFields are the fields required in the roles collection
+var RoleFields = []FieldSpec{
+	{Name: "name", Types: []string{"text"}},
+	{Name: "publish_permissions", Types: []string{"json"}},
+	{Name: "subscribe_permissions", Types: []string{"json"}},
+}
+
+// collectionField is a field definition in a collection response
+type collectionField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// collectionResponse is a collection definition. PocketBase v0.23+ lists fields
+// under "fields", older versions under "schema".
+type collectionResponse struct {
+	Name   string            `json:"name"`
+	Fields []collectionField `json:"fields"`
+	Schema []collectionField `json:"schema"`
+}
+
+// GetCollectionFields retrieves the field types of a collection, keyed by field name
+func (c *Client) GetCollectionFields(ctx context.Context, collection string) (map[string]string, error) {
+	if c.authToken == "" {
+		return nil, fmt.Errorf("not authenticated")
+	}
+
+	endpoint := fmt.Sprintf("%s/api/collections/%s", c.baseURL, collection)
+	resp, err := c.doAuthorized(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create collection request: %w", err)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send collection request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("collection request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var collResp collectionResponse
+	if err := json.Unmarshal(body, &collResp); err != nil {
+		return nil, fmt.Errorf("failed to decode collection response: %w", err)
+	}
+
+	fields := make(map[string]string)
+	for _, field := range append(collResp.Fields, collResp.Schema...) {
+		fields[field.Name] = field.Type
+	}
+	return fields, nil
+}
+
+// ValidateSchema checks that the users and roles collections contain the expected
+// fields with compatible types. The error lists every missing or mismatched field.
+func (c *Client) ValidateSchema(ctx context.Context) error {
+	var problems []string
+	for _, check := range []struct {
+		collection string
+		fields     []FieldSpec
+	}{
+		{c.collections.users, UserFields},
+		{c.collections.roles, RoleFields},
+	} {
+		fields, err := c.GetCollectionFields(ctx, check.collection)
+		if err != nil {
+			return fmt.Errorf("collection %s: %w", check.collection, err)
+		}
+		problems = append(problems, checkFields(check.collection, fields, check.fields)...)
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("PocketBase schema does not match: %s", strings.Join(problems, "; "))
+	}
+
+	c.logger.Info("PocketBase schema validated",
+		zap.String("users", c.collections.users),
+		zap.String("roles", c.collections.roles))
+	return nil
+}
+
+// checkFields compares actual collection fields against the expected specs
+func checkFields(collection string, actual map[string]string, expected []FieldSpec) []string {
+	var problems []string
+	for _, spec := range expected {
+		fieldType, ok := actual[spec.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s.%s is missing", collection, spec.Name))
+			continue
+		}
+
+		compatible := false
+		for _, t := range spec.Types {
+			if fieldType == t {
+				compatible = true
+				break
+			}
+		}
+		if !compatible {
+			problems = append(problems, fmt.Sprintf("%s.%s has type %s, expected %s",
+				collection, spec.Name, fieldType, strings.Join(spec.Types, " or ")))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,55 @@
+package pocketbase
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TransportOptions tunes connection reuse for PocketBase requests.
+// Zero values keep the net/http defaults.
+type TransportOptions struct {
+	MaxIdleConns        int           // Idle connections kept across all hosts
+	MaxIdleConnsPerHost int           // Idle connections kept per host
+	MaxConnsPerHost     int           // Concurrent connections per host, 0 for unlimited
+	IdleConnTimeout     time.Duration // How long an idle connection is kept open
+}
+
+// newTransport returns a transport with the net/http defaults that can be tuned per client
+func newTransport() *http.Transport {
+	return http.DefaultTransport.(*http.Transport).Clone()
+}
+
+// SetTransportOptions applies connection reuse settings to the client's transport.
+// Call it before the first request.
+func (c *Client) SetTransportOptions(opts TransportOptions) {
+	if opts.MaxIdleConns > 0 {
+		c.transport.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		c.transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.MaxConnsPerHost > 0 {
+		c.transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		c.transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+
+	c.logger.Debug("HTTP transport configured",
+		zap.Int("max_idle_conns", c.transport.MaxIdleConns),
+		zap.Int("max_idle_conns_per_host", c.transport.MaxIdleConnsPerHost),
+		zap.Int("max_conns_per_host", c.transport.MaxConnsPerHost),
+		zap.Duration("idle_conn_timeout", c.transport.IdleConnTimeout))
+}
+
+// SetTLSServerName overrides the name used for SNI and certificate verification,
+// e.g. when PocketBase is reached by IP with a certificate issued for a hostname
+func (c *Client) SetTLSServerName(serverName string) {
+	if c.transport.TLSClientConfig == nil {
+		c.transport.TLSClientConfig = &tls.Config{}
+	}
+	c.transport.TLSClientConfig.ServerName = serverName
+}
@@ -0,0 +1,207 @@
+package resolver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"nats-pocketbase-sync/internal/models"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"go.uber.org/zap"
+)
+
+// Config contains the settings for publishing account JWTs to an account resolver
+type Config struct {
+	URL                string // Resolver base URL, e.g. http://resolver:9090/jwt/v1
+	OperatorSigningKey string // Operator (signing) key seed used to sign account JWTs
+	AccountSeed        string // Account identity seed; its public key is the JWT subject
+	AccountName        string
+	SigningKeys        []SigningKey // Scoped signing keys added to the account
+	UserJWTDir         string       // Directory user JWTs are written to, empty to not issue them
+}
+
+// Publisher builds account JWTs and pushes them to an account resolver
+type Publisher struct {
+	url         string
+	operatorKey nkeys.KeyPair
+	accountKey  nkeys.KeyPair // Signs user JWTs
+	accountPub  string
+	accountName string
+	signingKeys []SigningKey
+	httpClient  *http.Client
+	logger      *zap.Logger
+	lastHash    string
+
+	// Users JWTs are issued for, by public nkey, and the claims hash of each written file
+	userDir    string
+	issued     map[string]string
+	userHashes map[string]string
+}
+
+// NewPublisher creates a new Publisher
+func NewPublisher(cfg Config, logger *zap.Logger) (*Publisher, error) {
+	operatorSeed := []byte(strings.TrimSpace(cfg.OperatorSigningKey))
+	if prefix, _, err := nkeys.DecodeSeed(operatorSeed); err != nil || prefix != nkeys.PrefixByteOperator {
+		return nil, fmt.Errorf("operator signing key must be a valid operator seed")
+	}
+	operatorKey, err := nkeys.FromSeed(operatorSeed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid operator signing key: %w", err)
+	}
+
+	accountKey, err := nkeys.FromSeed([]byte(strings.TrimSpace(cfg.AccountSeed)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid account seed: %w", err)
+	}
+	accountPub, err := accountKey.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive account public key: %w", err)
+	}
+	if !nkeys.IsValidPublicAccountKey(accountPub) {
+		return nil, fmt.Errorf("account seed must be an account seed")
+	}
+	if err := ValidateSigningKeys(cfg.SigningKeys, accountPub); err != nil {
+		return nil, fmt.Errorf("invalid signing keys: %w", err)
+	}
+
+	return &Publisher{
+		url:         strings.TrimRight(cfg.URL, "/"),
+		operatorKey: operatorKey,
+		accountKey:  accountKey,
+		accountPub:  accountPub,
+		accountName: cfg.AccountName,
+		signingKeys: cfg.SigningKeys,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		logger:     logger,
+		userDir:    cfg.UserJWTDir,
+		userHashes: make(map[string]string),
+	}, nil
+}
+
+// Publish builds the account JWT from the default permissions, the roles of the signing
+// keys and the inactive users, and pushes it to the resolver if its claims changed since
+// the last successful push. With a user JWT directory, it then writes a user JWT for every
+// nkey user of the last generated config. It reports whether anything was pushed or written.
+func (p *Publisher) Publish(defaultPublish, defaultSubscribe []string, roles []models.MqttRole, users []models.MqttUser) (bool, error) {
+	scopes, err := resolveScopes(p.signingKeys, roles, defaultPublish, defaultSubscribe)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve signing key scopes: %w", err)
+	}
+
+	// Build every user JWT before pushing, so a malformed user fails the sync up front
+	var userJWTs []userJWT
+	if p.userDir != "" {
+		userJWTs, err = p.buildUsers(roles, users, defaultPublish, defaultSubscribe)
+		if err != nil {
+			return false, fmt.Errorf("failed to build user JWTs: %w", err)
+		}
+	}
+
+	revoked := revocations(users)
+	pushed, err := p.pushAccount(defaultPublish, defaultSubscribe, scopes, revoked)
+	if err != nil || p.userDir == "" {
+		return pushed, err
+	}
+
+	written, err := p.writeUsers(userJWTs)
+	return pushed || written, err
+}
+
+// pushAccount builds the account JWT and pushes it if its claims changed
+func (p *Publisher) pushAccount(defaultPublish, defaultSubscribe []string, scopes []scope, revoked map[string]time.Time) (bool, error) {
+	// Hash the claim inputs rather than the token, which embeds issue time and ID
+	hash := claimsHash(p.accountName, defaultPublish, defaultSubscribe, scopes, revoked)
+	if hash == p.lastHash {
+		p.logger.Debug("Account claims unchanged, skipping resolver push")
+		return false, nil
+	}
+
+	claims := jwt.NewAccountClaims(p.accountPub)
+	claims.Name = p.accountName
+	claims.DefaultPermissions.Pub.Allow.Add(defaultPublish...)
+	claims.DefaultPermissions.Sub.Allow.Add(defaultSubscribe...)
+	for _, s := range scopes {
+		userScope, err := s.userScope()
+		if err != nil {
+			return false, err
+		}
+		claims.SigningKeys.AddScopedSigner(userScope)
+	}
+	for nkey, at := range revoked {
+		claims.RevokeAt(nkey, at)
+	}
+
+	token, err := claims.Encode(p.operatorKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode account JWT: %w", err)
+	}
+
+	if err := p.push(token); err != nil {
+		return false, err
+	}
+
+	p.lastHash = hash
+	p.logger.Info("Pushed account JWT to resolver",
+		zap.String("account", p.accountName),
+		zap.String("public_key", p.accountPub),
+		zap.Int("scoped_signing_keys", len(scopes)),
+		zap.Int("revoked_users", len(revoked)))
+	return true, nil
+}
+
+// push POSTs an account JWT to the resolver
+func (p *Publisher) push(token string) error {
+	endpoint := fmt.Sprintf("%s/accounts/%s", p.url, p.accountPub)
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBufferString(token))
+	if err != nil {
+		return fmt.Errorf("failed to create resolver request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/jwt")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send resolver request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("resolver request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// claimsHash hashes the inputs that determine the account claims
+func claimsHash(name string, publish, subscribe []string, scopes []scope, revoked map[string]time.Time) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(name + "\n"))
+	hasher.Write([]byte(strings.Join(publish, ",") + "\n"))
+	hasher.Write([]byte(strings.Join(subscribe, ",")))
+	for _, s := range scopes {
+		fmt.Fprintf(hasher, "\n%s\n%s\n%s\n%s\n%s\n%s\n%s", s.key, s.role, s.description,
+			strings.Join(s.publish, ","), strings.Join(s.subscribe, ","),
+			strings.Join(s.publishDeny, ","), strings.Join(s.subscribeDeny, ","))
+		fmt.Fprintf(hasher, "\nlimits %d %d", s.maxSubs, s.maxPayload)
+		if s.responses != nil {
+			fmt.Fprintf(hasher, "\nresponses %d %s", s.responses.MaxMsgs, s.responses.Expires)
+		}
+	}
+	revokedKeys := make([]string, 0, len(revoked))
+	for nkey := range revoked {
+		revokedKeys = append(revokedKeys, nkey)
+	}
+	sort.Strings(revokedKeys)
+	for _, nkey := range revokedKeys {
+		fmt.Fprintf(hasher, "\nrevoked %s %d", nkey, revoked[nkey].Unix())
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
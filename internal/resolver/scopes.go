@@ -0,0 +1,216 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"nats-pocketbase-sync/internal/models"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// SigningKey declares an account signing key whose user JWTs are scoped by a PocketBase role
+type SigningKey struct {
+	Key         string // Public account signing key (A...)
+	Role        string // PocketBase role whose permissions become the scope template
+	Description string
+}
+
+// scope is a signing key with the permissions resolved from its role
+type scope struct {
+	key         string
+	role        string
+	description string
+	rolePermissions
+}
+
+// rolePermissions are the permissions and per-user limits a role grants, in their JWT form
+type rolePermissions struct {
+	publish       []string
+	subscribe     []string
+	publishDeny   []string
+	subscribeDeny []string
+	responses     *jwt.ResponsePermission // Nil when the role does not allow responses
+	maxSubs       int64                   // Per-user limits from the role, 0 for no limit
+	maxPayload    int64
+}
+
+// ValidateSigningKeys checks that every key is a distinct account public key with a role,
+// and that none of them is the account's own identity key
+func ValidateSigningKeys(keys []SigningKey, accountPub string) error {
+	seen := make(map[string]bool, len(keys))
+	for i, key := range keys {
+		if !nkeys.IsValidPublicAccountKey(key.Key) {
+			return fmt.Errorf("signing key %d: %q is not an account public key", i+1, key.Key)
+		}
+		if key.Key == accountPub {
+			return fmt.Errorf("signing key %d: must differ from the account identity key", i+1)
+		}
+		if seen[key.Key] {
+			return fmt.Errorf("signing key %d: %s is listed more than once", i+1, key.Key)
+		}
+		seen[key.Key] = true
+		if strings.TrimSpace(key.Role) == "" {
+			return fmt.Errorf("signing key %d: role is required", i+1)
+		}
+	}
+	return nil
+}
+
+// resolveScopes looks up each signing key's role and resolves its permissions, falling
+// back to the role default and then the global default like the config generator does.
+// A direction that resolves to nothing is an error, since an empty scope template
+// would let the key issue users allowed on every subject.
+func resolveScopes(keys []SigningKey, roles []models.MqttRole, defaultPublish, defaultSubscribe []string) ([]scope, error) {
+	scopes := make([]scope, 0, len(keys))
+	for _, key := range keys {
+		role, ok := findRole(roles, key.Role)
+		if !ok {
+			return nil, fmt.Errorf("role %q of signing key %s not found", key.Role, key.Key)
+		}
+		if !role.IsEnabled() {
+			return nil, fmt.Errorf("role %q of signing key %s is disabled", key.Role, key.Key)
+		}
+
+		permissions, err := resolveRole(role, defaultPublish, defaultSubscribe)
+		if err != nil {
+			return nil, err
+		}
+		s := scope{
+			key:             key.Key,
+			role:            role.Name,
+			description:     key.Description,
+			rolePermissions: permissions,
+		}
+		if len(s.publish) == 0 || len(s.subscribe) == 0 {
+			return nil, fmt.Errorf("role %q of signing key %s needs both publish and subscribe permissions", key.Role, key.Key)
+		}
+		scopes = append(scopes, s)
+	}
+	return scopes, nil
+}
+
+// resolveRole validates a role's permission fields and limits and resolves its permissions,
+// falling back to the role default and then the global default
+func resolveRole(role models.MqttRole, defaultPublish, defaultSubscribe []string) (rolePermissions, error) {
+	fields := []struct {
+			name  string
+			value json.RawMessage
+	}{
+		{"publish_permissions", role.PublishPermissions},
+		{"subscribe_permissions", role.SubscribePermissions},
+		{"default_publish_permissions", role.DefaultPublishPermissions},
+		{"default_subscribe_permissions", role.DefaultSubscribePermissions},
+		{"publish_deny", role.PublishDenyPermissions},
+		{"subscribe_deny", role.SubscribeDenyPermissions},
+	}
+	for _, field := range fields {
+		if err := models.CheckPermissions(field.value); err != nil {
+			return rolePermissions{}, fmt.Errorf("role %q has malformed %s: %w", role.Name, field.name, err)
+		}
+	}
+
+	responses, err := scopeResponses(role)
+	if err != nil {
+		return rolePermissions{}, fmt.Errorf("role %q has malformed allow_responses: %w", role.Name, err)
+	}
+
+	maxSubs, err := scopeLimit(role.MaxSubscriptions)
+	if err != nil {
+		return rolePermissions{}, fmt.Errorf("role %q has an invalid max_subscriptions: %w", role.Name, err)
+	}
+	maxPayload, err := scopeLimit(role.MaxPayload)
+	if err != nil {
+		return rolePermissions{}, fmt.Errorf("role %q has an invalid max_payload: %w", role.Name, err)
+	}
+
+	return rolePermissions{
+		publish:       firstList(models.ParsePermissions(role.PublishPermissions), models.ParsePermissions(role.DefaultPublishPermissions), defaultPublish),
+		subscribe:     firstList(models.ParsePermissions(role.SubscribePermissions), models.ParsePermissions(role.DefaultSubscribePermissions), defaultSubscribe),
+		publishDeny:   models.ParsePermissions(role.PublishDenyPermissions),
+		subscribeDeny: models.ParsePermissions(role.SubscribeDenyPermissions),
+		responses:     responses,
+		maxSubs:       maxSubs,
+		maxPayload:    maxPayload,
+	}, nil
+}
+
+// scopeResponses converts the role's response permission to its JWT form. Zero fields are
+// left for the server to default, as in the config file.
+func scopeResponses(role models.MqttRole) (*jwt.ResponsePermission, error) {
+	permission, err := role.GetAllowResponses()
+	if err != nil || permission == nil {
+		return nil, err
+	}
+	responses := &jwt.ResponsePermission{MaxMsgs: permission.MaxMsgs}
+	if permission.Expires != "" {
+		// Already validated as a positive duration
+		responses.Expires, _ = time.ParseDuration(permission.Expires)
+	}
+	return responses, nil
+}
+
+// scopeLimit validates a role limit for a scope template, which must be a whole number.
+// PocketBase number fields may hold fractions.
+func scopeLimit(value float64) (int64, error) {
+	if value < 0 || value != math.Trunc(value) || value > math.MaxInt32 {
+		return 0, fmt.Errorf("must be a whole number of 0 or more, got %v", value)
+	}
+	return int64(value), nil
+}
+
+// findRole returns the role with the given name, matching the PocketBase name or its NATS form
+func findRole(roles []models.MqttRole, name string) (models.MqttRole, bool) {
+	for _, role := range roles {
+		if role.Name == name || role.NormalizeRoleName() == name {
+			return role, true
+		}
+	}
+	return models.MqttRole{}, false
+}
+
+// firstList returns the first non-empty list
+func firstList(candidates ...[]string) []string {
+	for _, candidate := range candidates {
+		if len(candidate) > 0 {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// userScope builds the JWT scope for a resolved signing key, rejecting invalid subjects
+func (s scope) userScope() (*jwt.UserScope, error) {
+	userScope := jwt.NewUserScope()
+	userScope.Key = s.key
+	userScope.Role = s.role
+	userScope.Description = s.description
+	s.applyTo(&userScope.Template)
+
+	vr := jwt.CreateValidationResults()
+	userScope.Validate(vr)
+	userScope.Template.Permissions.Validate(vr)
+	if errs := vr.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid scope for signing key %s: %w", s.key, errors.Join(errs...))
+	}
+	return userScope, nil
+}
+
+// applyTo sets the permissions and the limits that are set on a user's permission limits
+func (r rolePermissions) applyTo(limits *jwt.UserPermissionLimits) {
+	limits.Pub.Allow.Add(r.publish...)
+	limits.Sub.Allow.Add(r.subscribe...)
+	limits.Pub.Deny.Add(r.publishDeny...)
+	limits.Sub.Deny.Add(r.subscribeDeny...)
+	limits.Resp = r.responses
+	if r.maxSubs > 0 {
+		limits.Subs = r.maxSubs
+	}
+	if r.maxPayload > 0 {
+		limits.Payload = r.maxPayload
+	}
+}
@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/internal/models"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// newSigningKey returns a fresh account public key for a scope
+func newSigningKey(t *testing.T) string {
+	t.Helper()
+	kp, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatalf("create signing key: %v", err)
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		t.Fatalf("signing key public key: %v", err)
+	}
+	return pub
+}
+
+func TestScopeLimits(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxSubscriptions float64
+		maxPayload       float64
+		wantSubs         int64
+		wantPayload      int64
+		wantErr          string
+	}{
+		{name: "limits set", maxSubscriptions: 100, maxPayload: 1048576, wantSubs: 100, wantPayload: 1048576},
+		{name: "one limit set", maxPayload: 4096, wantSubs: jwt.NoLimit, wantPayload: 4096},
+		{name: "no limits", wantSubs: jwt.NoLimit, wantPayload: jwt.NoLimit},
+		{name: "fractional limit", maxSubscriptions: 1.5, wantErr: "invalid max_subscriptions"},
+		{name: "negative limit", maxPayload: -1, wantErr: "invalid max_payload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := SigningKey{Key: newSigningKey(t), Role: "sensors"}
+			role := models.MqttRole{
+				ID:                   "r1",
+				Name:                 "sensors",
+				PublishPermissions:   json.RawMessage(`["sensors.>"]`),
+				SubscribePermissions: json.RawMessage(`["sensors.>"]`),
+				MaxSubscriptions:     tt.maxSubscriptions,
+				MaxPayload:           tt.maxPayload,
+			}
+
+			scopes, err := resolveScopes([]SigningKey{key}, []models.MqttRole{role}, nil, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveScopes error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveScopes: %v", err)
+			}
+
+			userScope, err := scopes[0].userScope()
+			if err != nil {
+				t.Fatalf("userScope: %v", err)
+			}
+			if userScope.Template.Subs != tt.wantSubs {
+				t.Errorf("template subs = %d, want %d", userScope.Template.Subs, tt.wantSubs)
+			}
+			if userScope.Template.Payload != tt.wantPayload {
+				t.Errorf("template payload = %d, want %d", userScope.Template.Payload, tt.wantPayload)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package resolver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"nats-pocketbase-sync/internal/models"
+	"github.com/nats-io/jwt/v2"
+	"go.uber.org/zap"
+)
+
+// UserFileSuffix is the extension of written user JWT files
+const UserFileSuffix = ".jwt"
+
+// unsafeFileChars matches characters not allowed in a user JWT file name
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._@-]`)
+
+// userJWT is a user JWT built from PocketBase, with the hash of its claim inputs
+type userJWT struct {
+	name  string
+	file  string
+	token string
+	hash  string
+}
+
+// Capture records the nkey users of a generated config, which are the users a JWT is
+// issued for, so exclusions, expiry and duplicate handling match the config. It is
+// registered as a generator transform and leaves the config data unchanged.
+func (p *Publisher) Capture(data *models.NatsConfigData) error {
+	p.issued = make(map[string]string)
+	for _, user := range data.Users {
+		if user.NKey != "" {
+			p.issued[user.NKey] = user.Name
+		}
+	}
+	return nil
+}
+
+// revocations returns the nkey users that are inactive in PocketBase, revoked as of their
+// last update, which is when they were deactivated. JWTs issued before then stop working.
+func revocations(users []models.MqttUser) map[string]time.Time {
+	revoked := make(map[string]time.Time)
+	for _, user := range users {
+		updated := time.Time(user.Updated)
+		if user.NKey == "" || user.Active || updated.IsZero() {
+			continue
+		}
+		revoked[user.NKey] = updated
+	}
+	return revoked
+}
+
+// buildUsers signs a user JWT with the account key for every captured nkey user. Users get
+// their inline permissions, falling back to their role's, and the role's deny lists,
+// response permission and per-user limits, as in the generated config.
+func (p *Publisher) buildUsers(roles []models.MqttRole, users []models.MqttUser, defaultPublish, defaultSubscribe []string) ([]userJWT, error) {
+	var built []userJWT
+	files := make(map[string]bool)
+	for _, user := range users {
+		name, ok := p.issued[user.NKey]
+		if user.NKey == "" || !ok {
+			continue
+		}
+		role, ok := findRoleByID(roles, user.RoleID)
+		if !ok {
+			return nil, fmt.Errorf("role %s of user %s not found", user.RoleID, name)
+		}
+		permissions, err := resolveRole(role, defaultPublish, defaultSubscribe)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", name, err)
+		}
+		for _, field := range []struct {
+			name  string
+			value []byte
+			list  *[]string
+		}{
+			{"publish_permissions", user.PublishPermissions, &permissions.publish},
+			{"subscribe_permissions", user.SubscribePermissions, &permissions.subscribe},
+		} {
+			if err := models.CheckPermissions(field.value); err != nil {
+				return nil, fmt.Errorf("user %s has malformed %s: %w", name, field.name, err)
+			}
+			if inline := models.ParsePermissions(field.value); len(inline) > 0 {
+				*field.list = inline
+			}
+		}
+
+		claims := jwt.NewUserClaims(user.NKey)
+		claims.Name = name
+		permissions.applyTo(&claims.UserPermissionLimits)
+		claims.AllowedConnectionTypes.Add(user.AllowedConnectionTypes...)
+		if expires := time.Time(user.ExpiresAt); !expires.IsZero() {
+			claims.Expires = expires.Unix()
+		}
+
+		vr := jwt.CreateValidationResults()
+		claims.Validate(vr)
+		if errs := vr.Errors(); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid user JWT for %s: %w", name, errors.Join(errs...))
+		}
+		token, err := claims.Encode(p.accountKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode user JWT for %s: %w", name, err)
+		}
+
+		file := unsafeFileChars.ReplaceAllString(name, "_") + UserFileSuffix
+		if files[file] {
+			p.logger.Warn("User JWT file name collision, skipping user", zap.String("username", name))
+			continue
+		}
+		files[file] = true
+		built = append(built, userJWT{
+			name:  name,
+			file:  file,
+			token: token,
+			hash:  userHash(user.NKey, name, permissions, claims),
+		})
+	}
+	sort.Slice(built, func(i, j int) bool { return built[i].file < built[j].file })
+	return built, nil
+}
+
+// findRoleByID returns the role with the given PocketBase record ID
+func findRoleByID(roles []models.MqttRole, id string) (models.MqttRole, bool) {
+	for _, role := range roles {
+		if role.ID == id {
+			return role, true
+		}
+	}
+	return models.MqttRole{}, false
+}
+
+// userHash hashes the inputs that determine a user's claims, since the token itself
+// embeds its issue time and ID
+func userHash(nkey, name string, permissions rolePermissions, claims *jwt.UserClaims) string {
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s\n%s\n%s\n%s\n%s\n%s\n", nkey, name,
+		strings.Join(permissions.publish, ","), strings.Join(permissions.subscribe, ","),
+		strings.Join(permissions.publishDeny, ","), strings.Join(permissions.subscribeDeny, ","))
+	fmt.Fprintf(hasher, "limits %d %d\nexpires %d\n", permissions.maxSubs, permissions.maxPayload, claims.Expires)
+	fmt.Fprintf(hasher, "connection types %s\n", strings.Join(claims.AllowedConnectionTypes, ","))
+	if permissions.responses != nil {
+		fmt.Fprintf(hasher, "responses %d %s\n", permissions.responses.MaxMsgs, permissions.responses.Expires)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// writeUsers writes the JWT of every user whose claims changed since the last write or
+// whose file is missing, and removes files of users that no longer get one. It reports
+// whether any file was written or removed.
+func (p *Publisher) writeUsers(users []userJWT) (bool, error) {
+	if err := os.MkdirAll(p.userDir, 0700); err != nil {
+		return false, fmt.Errorf("failed to create user JWT directory: %w", err)
+	}
+
+	current := make(map[string]bool, len(users))
+	written := 0
+	for _, user := range users {
+		current[user.file] = true
+		path := filepath.Join(p.userDir, user.file)
+		if _, err := os.Stat(path); err == nil && p.userHashes[user.file] == user.hash {
+			continue
+		}
+		if err := writeFileAtomic(path, []byte(user.token+"\n")); err != nil {
+			return written > 0, fmt.Errorf("failed to write user JWT for %s: %w", user.name, err)
+		}
+		p.userHashes[user.file] = user.hash
+		written++
+	}
+
+	entries, err := os.ReadDir(p.userDir)
+	if err != nil {
+		return written > 0, fmt.Errorf("failed to read user JWT directory: %w", err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), UserFileSuffix) || current[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(p.userDir, entry.Name())); err != nil {
+			return written > 0 || removed > 0, fmt.Errorf("failed to remove stale user JWT: %w", err)
+		}
+		delete(p.userHashes, entry.Name())
+		removed++
+	}
+
+	if written > 0 || removed > 0 {
+		p.logger.Info("Updated user JWTs",
+			zap.String("dir", p.userDir),
+			zap.Int("written", written),
+			zap.Int("removed", removed))
+	}
+	return written > 0 || removed > 0, nil
+}
+
+// writeFileAtomic replaces path with content through a temporary file readable only by the owner
+func writeFileAtomic(path string, content []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "user-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempFilePath := tempFile.Name()
+	defer os.Remove(tempFilePath)
+
+	if _, err := tempFile.Write(content); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to write to temp file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	return os.Rename(tempFilePath, path)
+}
@@ -0,0 +1,144 @@
+package resolver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nats-pocketbase-sync/internal/models"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"go.uber.org/zap"
+)
+
+// newUserKey returns a fresh public user nkey
+func newUserKey(t *testing.T) string {
+	t.Helper()
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("create user key: %v", err)
+	}
+	pub, err := kp.PublicKey()
+	if err != nil {
+		t.Fatalf("user public key: %v", err)
+	}
+	return pub
+}
+
+// seed returns the seed of a fresh key pair created by create
+func seed(t *testing.T, create func() (nkeys.KeyPair, error)) string {
+	t.Helper()
+	kp, err := create()
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	s, err := kp.Seed()
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return string(s)
+}
+
+func TestPublishIssuesUserJWTs(t *testing.T) {
+	var pushed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pushed = append(pushed, string(body))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	p, err := NewPublisher(Config{
+		URL:                server.URL,
+		OperatorSigningKey: seed(t, nkeys.CreateOperator),
+		AccountSeed:        seed(t, nkeys.CreateAccount),
+		AccountName:        "MQTT",
+		UserJWTDir:         dir,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewPublisher: %v", err)
+	}
+
+	roles := []models.MqttRole{{
+		ID:                     "r1",
+		Name:                   "sensors",
+		PublishPermissions:     json.RawMessage(`["sensors.>"]`),
+		SubscribePermissions:   json.RawMessage(`["sensors.>"]`),
+		PublishDenyPermissions: json.RawMessage(`["sensors.admin.>"]`),
+		MaxSubscriptions:       10,
+	}}
+	aliceKey, bobKey, carolKey := newUserKey(t), newUserKey(t), newUserKey(t)
+	deactivated := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	users := []models.MqttUser{
+		{ID: "u1", Username: "alice", NKey: aliceKey, RoleID: "r1", Active: true},
+		{ID: "u2", Username: "bob", NKey: bobKey, RoleID: "r1", Active: true,
+			SubscribePermissions: json.RawMessage(`["bob.>"]`)},
+		{ID: "u3", Username: "carol", NKey: carolKey, RoleID: "r1", Updated: models.FlexibleTime(deactivated)},
+	}
+	// The generated config holds the active users
+	p.Capture(&models.NatsConfigData{Users: []models.NatsUser{
+		{Name: "alice", NKey: aliceKey, RoleName: "SENSORS"},
+		{Name: "bob", NKey: bobKey, RoleName: "SENSORS"},
+	}})
+
+	changed, err := p.Publish([]string{"PUBLIC.>"}, []string{"PUBLIC.>"}, roles, users)
+	if err != nil || !changed {
+		t.Fatalf("Publish = %v, %v, want a change", changed, err)
+	}
+
+	alice := decodeUserFile(t, filepath.Join(dir, "alice.jwt"))
+	if alice.Subject != aliceKey || alice.Name != "alice" || alice.Issuer != p.accountPub {
+		t.Errorf("alice JWT subject %s, name %s, issuer %s", alice.Subject, alice.Name, alice.Issuer)
+	}
+	if !alice.Pub.Allow.Contains("sensors.>") || !alice.Pub.Deny.Contains("sensors.admin.>") || alice.Subs != 10 {
+		t.Errorf("alice JWT has publish %+v and subs %d, want the role's permissions and limit", alice.Pub, alice.Subs)
+	}
+	bob := decodeUserFile(t, filepath.Join(dir, "bob.jwt"))
+	if !bob.Sub.Allow.Contains("bob.>") || bob.Sub.Allow.Contains("sensors.>") {
+		t.Errorf("bob JWT subscribe allow = %v, want the inline permissions", bob.Sub.Allow)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "carol.jwt")); !os.IsNotExist(err) {
+		t.Errorf("inactive user got a JWT file")
+	}
+
+	account, err := jwt.DecodeAccountClaims(pushed[0])
+	if err != nil {
+		t.Fatalf("DecodeAccountClaims: %v", err)
+	}
+	if got := account.Revocations[carolKey]; got != deactivated.Unix() {
+		t.Errorf("carol revoked at %d, want her deactivation at %d", got, deactivated.Unix())
+	}
+
+	// Unchanged records neither push nor write
+	if changed, err := p.Publish([]string{"PUBLIC.>"}, []string{"PUBLIC.>"}, roles, users); err != nil || changed {
+		t.Errorf("second Publish = %v, %v, want no change", changed, err)
+	}
+
+	// A user dropped from the config loses its file
+	p.Capture(&models.NatsConfigData{Users: []models.NatsUser{{Name: "alice", NKey: aliceKey, RoleName: "SENSORS"}}})
+	if changed, err := p.Publish([]string{"PUBLIC.>"}, []string{"PUBLIC.>"}, roles, users); err != nil || !changed {
+		t.Errorf("Publish after dropping bob = %v, %v, want a change", changed, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bob.jwt")); !os.IsNotExist(err) {
+		t.Errorf("bob.jwt still exists after bob was dropped")
+	}
+}
+
+// decodeUserFile decodes the user JWT written to path
+func decodeUserFile(t *testing.T, path string) *jwt.UserClaims {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := jwt.DecodeUserClaims(string(content))
+	if err != nil {
+		t.Fatalf("DecodeUserClaims %s: %v", path, err)
+	}
+	return claims
+}
@@ -0,0 +1,63 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// File is a secret stored in a file, such as a mounted Kubernetes or Docker secret.
+// The last successfully read value is cached so a transient read failure does not
+// lose the credential.
+type File struct {
+	path  string
+	value string
+	mutex sync.Mutex
+}
+
+// NewFile creates a new File for the given path
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Path returns the path of the secret file
+func (f *File) Path() string {
+	return f.path
+}
+
+// Read re-reads the secret file and returns its trimmed content. If the file cannot
+// be read but a previous value was cached, the cached value is returned with the error.
+func (f *File) Read() (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	content, err := ReadFile(f.path)
+	if err != nil {
+		return f.value, err
+	}
+
+	f.value = content
+	return f.value, nil
+}
+
+// Value returns the cached secret without touching the file
+func (f *File) Value() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.value
+}
+
+// ReadFile reads a secret from a file, trimming surrounding whitespace
+func ReadFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file %s: %w", path, err)
+	}
+
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return value, nil
+}
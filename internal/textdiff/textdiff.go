@@ -0,0 +1,215 @@
+// Package textdiff produces line-based unified diffs
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+// maxEdits bounds the work spent finding a minimal diff. Texts differing in more lines
+// are shown as the old lines removed and the new lines added.
+const maxEdits = 2000
+
+// Result is a unified diff with its line counts
+type Result struct {
+	Diff    string // Empty when the texts are equal
+	Added   int
+	Removed int
+}
+
+// op is one line of the edit script
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Unified returns the unified diff from one text to another, labelled with the given names
+func Unified(fromName, toName, from, to string) Result {
+	a, b := splitLines(from), splitLines(to)
+
+	// Only the part between the common prefix and suffix needs diffing
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, op{' ', line})
+	}
+	ops = append(ops, editScript(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, op{' ', line})
+	}
+
+	var result Result
+	for _, o := range ops {
+		switch o.kind {
+		case '+':
+			result.Added++
+		case '-':
+			result.Removed++
+		}
+	}
+	if result.Added == 0 && result.Removed == 0 {
+		return result
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	writeHunks(&sb, ops)
+	result.Diff = sb.String()
+	return result
+}
+
+// splitLines splits text into lines, ignoring the newline that ends the last one
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// editScript returns a shortest edit script from a to b using Myers' algorithm,
+// or all of a removed and all of b added when they differ in more than maxEdits lines
+func editScript(a, b []string) []op {
+	n, m := len(a), len(b)
+	var trace [][]int // Furthest x reached on each diagonal k, indexed k+d, per edit count d
+	var prev []int
+	for d := 0; d <= n+m && d <= maxEdits; d++ {
+		v := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			switch {
+			case d == 0:
+				x = 0
+			case k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]):
+				x = prev[k+1+d-1] // Insertion from diagonal k+1
+			default:
+				x = prev[k-1+d-1] + 1 // Deletion from diagonal k-1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+d] = x
+			if x >= n && y >= m {
+				return backtrack(append(trace, v), a, b)
+			}
+		}
+		trace = append(trace, v)
+		prev = v
+	}
+
+	ops := make([]op, 0, n+m)
+	for _, line := range a {
+		ops = append(ops, op{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, op{'+', line})
+	}
+	return ops
+}
+
+// backtrack walks the trace from the end to recover the edit script
+func backtrack(trace [][]int, a, b []string) []op {
+	x, y := len(a), len(b)
+	var reversed []op
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, op{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, op{'+', b[y-1]})
+			y--
+		} else {
+			reversed = append(reversed, op{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, op{' ', a[x-1]})
+		x--
+		y--
+	}
+
+	ops := make([]op, len(reversed))
+	for i, o := range reversed {
+		ops[len(reversed)-1-i] = o
+	}
+	return ops
+}
+
+// writeHunks writes the changes with their surrounding context, merging changes
+// whose context would overlap into one hunk
+func writeHunks(sb *strings.Builder, ops []op) {
+	// Line numbers in a and b before each op
+	aLine, bLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, o := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if o.kind != '+' {
+			aLine[i+1]++
+		}
+		if o.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk while the next change is within twice the context
+		start := max(0, i-contextLines)
+		end := i + 1
+		for j := end; j < len(ops) && j < end+2*contextLines; j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		end = min(len(ops), end+contextLines)
+
+		fmt.Fprintf(sb, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start]))
+		for _, o := range ops[start:end] {
+			sb.WriteByte(o.kind)
+			sb.WriteString(o.line)
+			sb.WriteByte('\n')
+		}
+		i = end
+	}
+}
+
+// hunkRange formats the start and length of a hunk side the way diff -u does
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
@@ -0,0 +1,94 @@
+// Package generator exposes the NATS config generator to programs embedding it. The
+// types are aliases of the ones the CLI uses, so transforms, loaders and rendering
+// behave exactly as in the synced config.
+package generator
+
+import (
+	"io"
+
+	internal "nats-pocketbase-sync/internal/generator"
+	"nats-pocketbase-sync/internal/models"
+	"go.uber.org/zap"
+)
+
+// Generator builds NATS config from PocketBase roles and users
+type Generator = internal.Generator
+
+// ConfigTransform adjusts the config data after it is built from PocketBase and before
+// it is rendered. Returning an error aborts config generation.
+type ConfigTransform = internal.ConfigTransform
+
+// Generator settings
+type (
+	PermissionPolicy = internal.PermissionPolicy
+	MonitoringUser   = internal.MonitoringUser
+	NatsVersion      = internal.NatsVersion
+)
+
+// PocketBase records
+type (
+	MqttRole           = models.MqttRole
+	MqttUser           = models.MqttUser
+	FlexibleTime       = models.FlexibleTime
+	FlexibleStringList = models.FlexibleStringList
+	SubjectMapping     = models.SubjectMapping
+	ResponsePermission = models.ResponsePermission
+)
+
+// Structured config data passed to transforms and rendered to the config file
+type (
+	NatsConfigData     = models.NatsConfigData
+	NatsRole           = models.NatsRole
+	NatsUser           = models.NatsUser
+	NatsAccount        = models.NatsAccount
+	NatsAccountLimits  = models.NatsAccountLimits
+	NatsMapping        = models.NatsMapping
+	NatsMonitoringUser = models.NatsMonitoringUser
+	NatsLeafnodes      = models.NatsLeafnodes
+	NatsSecret         = models.NatsSecret
+)
+
+// Output modes for the generated config
+const (
+	OutputModeAuthorization = internal.OutputModeAuthorization
+	OutputModeAccounts      = internal.OutputModeAccounts
+)
+
+// Actions for forbidden permission grants
+const (
+	PolicyActionFail = internal.PolicyActionFail
+	PolicyActionWarn = internal.PolicyActionWarn
+)
+
+// SchemaVersion is the schema version of the generated config
+const SchemaVersion = internal.SchemaVersion
+
+// NewGenerator creates a Generator granting the default permissions to roles without their own
+func NewGenerator(defaultPublish, defaultSubscribe interface{}, logger *zap.Logger) *Generator {
+	return internal.NewGenerator(defaultPublish, defaultSubscribe, logger)
+}
+
+// LoadRoles decodes roles from a JSON array or a PocketBase list response
+func LoadRoles(r io.Reader) ([]MqttRole, error) {
+	return internal.LoadRoles(r)
+}
+
+// LoadUsers decodes users from a JSON array or a PocketBase list response
+func LoadUsers(r io.Reader) ([]MqttUser, error) {
+	return internal.LoadUsers(r)
+}
+
+// FormatConfigFile renders config data to the NATS config text
+func FormatConfigFile(data *NatsConfigData) (string, error) {
+	return models.FormatConfigFile(data)
+}
+
+// FormatPermissionList formats subjects the way permission fields of the config data hold them
+func FormatPermissionList(subjects []string) string {
+	return models.FormatPermissionList(subjects)
+}
+
+// AllowedSubjects returns the subjects a formatted permission field allows
+func AllowedSubjects(permission string) []string {
+	return models.AllowedSubjects(permission)
+}
@@ -0,0 +1,65 @@
+package generator_test
+
+import (
+	"strings"
+	"testing"
+
+	"nats-pocketbase-sync/pkg/generator"
+	"go.uber.org/zap"
+)
+
+const testRoles = `[{"id": "r1", "name": "sensors", "publish_permissions": ["sensors.>"], "subscribe_permissions": ["sensors.>"]}]`
+
+const testUsers = `[{"id": "u1", "username": "alice", "password": "secret", "role_id": "r1", "active": true}]`
+
+// addUser returns a transform appending a computed user with inline publish permissions
+func addUser(name string, publish ...string) generator.ConfigTransform {
+	return func(data *generator.NatsConfigData) error {
+		data.Users = append(data.Users, generator.NatsUser{
+			Username:             `"` + name + `"`,
+			Name:                 name,
+			Password:             "computed",
+			RoleName:             "SENSORS",
+			PublishPermissions:   generator.FormatPermissionList(publish),
+			SubscribePermissions: generator.FormatPermissionList([]string{"sensors.>"}),
+			InlinePermissions:    true,
+		})
+		return nil
+	}
+}
+
+func TestTransformAddsUser(t *testing.T) {
+	roles, err := generator.LoadRoles(strings.NewReader(testRoles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := generator.LoadUsers(strings.NewReader(testUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := generator.NewGenerator("PUBLIC.>", []interface{}{"PUBLIC.>"}, zap.NewNop())
+	g.AddTransform(addUser("bridge", "bridge.>"))
+	config, err := g.GenerateConfig(roles, users)
+	if err != nil {
+		t.Fatalf("GenerateConfig: %v", err)
+	}
+	if !strings.Contains(config, `user: "bridge"`) || !strings.Contains(config, `publish: "bridge.>"`) {
+		t.Errorf("config lacks the computed user:\n%s", config)
+	}
+}
+
+func TestPermissionPolicyCoversTransforms(t *testing.T) {
+	roles, _ := generator.LoadRoles(strings.NewReader(testRoles))
+	users, _ := generator.LoadUsers(strings.NewReader(testUsers))
+
+	g := generator.NewGenerator("PUBLIC.>", []interface{}{"PUBLIC.>"}, zap.NewNop())
+	g.SetPermissionPolicy(generator.PermissionPolicy{
+		ForbiddenPatterns: []string{">"},
+		Action:            generator.PolicyActionFail,
+	})
+	g.AddTransform(addUser("bridge", ">"))
+	if _, err := g.GenerateConfig(roles, users); err == nil || !strings.Contains(err.Error(), "user bridge") {
+		t.Errorf("GenerateConfig error = %v, want the transform's user to violate the policy", err)
+	}
+}